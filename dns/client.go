@@ -0,0 +1,299 @@
+package dns
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"github.com/pkg/errors"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// The file listing the nameservers configured on the system
+	resolvConfPath = "/etc/resolv.conf"
+)
+
+// A client sending queries to a DNS server
+type Client struct {
+	// The server to query, as host[:port]. If empty, the nameservers configured on the system are used.
+	Server string
+
+	// If set, queries are sent over TCP right away. Otherwise, UDP is used, falling back to TCP for truncated responses.
+	TCP bool
+
+	// Timeout of a single exchange
+	Timeout time.Duration
+
+	// Number of retries after a failed exchange
+	Retries int
+
+	// The UDP buffer size announced via EDNS0. If zero, EDNS0 is not used.
+	UDPSize uint16
+
+	// If set, DNSSEC records are requested along with the records asked for. This implies EDNS0.
+	DNSSEC bool
+}
+
+// A response, together with some information about how it was received
+type Response struct {
+	*Message
+	Server  string
+	OverTCP bool
+	RTT     time.Duration
+}
+
+// Sends a query for the given name and type, and returns the response
+func (c *Client) Query(name string, rrType uint16) (*Response, error) {
+	return c.Exchange(c.NewQuery(name, rrType))
+}
+
+// Returns a new query for the given name and type, with a random ID and EDNS0 set up as configured
+func (c *Client) NewQuery(name string, rrType uint16) *Message {
+	query := NewQuery(randomID(), name, rrType)
+	if c.UDPSize > 0 {
+		query.SetEDNS0(c.UDPSize)
+	} else if c.DNSSEC {
+		query.SetEDNS0(MinUDPSize)
+	}
+	query.SetDNSSECOK(c.DNSSEC)
+	return query
+}
+
+// Sends the query to the server, retrying and trying other servers if required, and returns the response.
+// Responses indicating a server failure or a refused query are treated as failed exchanges.
+func (c *Client) Exchange(query *Message) (*Response, error) {
+	servers, serversErr := c.servers()
+	if serversErr != nil {
+		return nil, serversErr
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= c.Retries; attempt++ {
+		for _, server := range servers {
+			response, exchangeErr := c.exchangeWith(query, server)
+			if exchangeErr != nil {
+				lastErr = exchangeErr
+				continue
+			}
+
+			// Check if the server was able to handle our query at all
+			if response.Rcode == RcodeServerFailure || response.Rcode == RcodeRefused {
+				lastErr = errors.New(fmt.Sprintf("%s answered with %s", server, RcodeToString(response.Rcode)))
+				continue
+			}
+
+			return response, nil
+		}
+	}
+
+	return nil, lastErr
+}
+
+// Returns the list of servers to query
+func (c *Client) servers() ([]string, error) {
+	if c.Server != "" {
+		return []string{WithDefaultPort(c.Server)}, nil
+	}
+
+	// No server given, ask the system
+	servers, systemErr := SystemServers()
+	if systemErr != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to get nameservers of the system: %s", systemErr.Error()))
+	}
+	if len(servers) == 0 {
+		return nil, errors.New("No nameservers configured on the system")
+	}
+	return servers, nil
+}
+
+// Sends the query to the given server, and returns its response.
+// If the response is truncated, the query is sent again over TCP.
+func (c *Client) exchangeWith(query *Message, server string) (*Response, error) {
+	start := time.Now()
+	overTCP := c.TCP
+
+	var response *Message
+	var exchangeErr error
+	if !overTCP {
+		response, exchangeErr = c.exchangeUDP(query, server)
+		if exchangeErr == nil && response.Truncated {
+			// Didn't fit into a UDP packet, try again over TCP
+			overTCP = true
+		}
+	}
+	if overTCP {
+		response, exchangeErr = c.exchangeTCP(query, server)
+	}
+	if exchangeErr != nil {
+		return nil, exchangeErr
+	}
+
+	return &Response{
+		Message: response,
+		Server:  server,
+		OverTCP: overTCP,
+		RTT:     time.Since(start),
+	}, nil
+}
+
+// Sends the query over UDP, and waits for a matching response
+func (c *Client) exchangeUDP(query *Message, server string) (*Message, error) {
+	packed, packErr := query.Pack()
+	if packErr != nil {
+		return nil, packErr
+	}
+
+	conn, dialErr := net.DialTimeout("udp", server, c.Timeout)
+	if dialErr != nil {
+		return nil, dialErr
+	}
+	defer conn.Close()
+	if c.Timeout > 0 {
+		conn.SetDeadline(time.Now().Add(c.Timeout))
+	}
+
+	if _, writeErr := conn.Write(packed); writeErr != nil {
+		return nil, writeErr
+	}
+
+	// Read until we get a response matching our query, ignoring everything else
+	bufSize := int(c.UDPSize)
+	if bufSize < MinUDPSize {
+		bufSize = MinUDPSize
+	}
+	buf := make([]byte, bufSize)
+	for {
+		length, readErr := conn.Read(buf)
+		if readErr != nil {
+			return nil, readErr
+		}
+
+		response, unpackErr := Unpack(buf[:length])
+		if unpackErr != nil || !isResponseTo(response, query) {
+			continue
+		}
+		return response, nil
+	}
+}
+
+// Sends the query over TCP, and reads the response
+func (c *Client) exchangeTCP(query *Message, server string) (*Message, error) {
+	packed, packErr := query.Pack()
+	if packErr != nil {
+		return nil, packErr
+	}
+
+	conn, dialErr := net.DialTimeout("tcp", server, c.Timeout)
+	if dialErr != nil {
+		return nil, dialErr
+	}
+	defer conn.Close()
+	if c.Timeout > 0 {
+		conn.SetDeadline(time.Now().Add(c.Timeout))
+	}
+
+	if writeErr := WriteTCPMessage(conn, packed); writeErr != nil {
+		return nil, writeErr
+	}
+	raw, readErr := ReadTCPMessage(conn)
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	response, unpackErr := Unpack(raw)
+	if unpackErr != nil {
+		return nil, unpackErr
+	}
+	if !isResponseTo(response, query) {
+		return nil, errors.New(fmt.Sprintf("%s sent a response not matching our query", server))
+	}
+	return response, nil
+}
+
+// Checks if the message is a response to the given query
+func isResponseTo(response *Message, query *Message) bool {
+	if !response.Response || response.ID != query.ID || len(response.Questions) != len(query.Questions) {
+		return false
+	}
+	for i, q := range query.Questions {
+		r := response.Questions[i]
+		if !EqualNames(q.Name, r.Name) || q.Type != r.Type || q.Class != r.Class {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the records of the given type owned by the given name, following CNAME records in the answer section
+func (m *Message) AnswersFor(name string, rrType uint16) []RR {
+	// Collect all names the given name is an alias for
+	names := []string{name}
+	for changed := true; changed; {
+		changed = false
+		for _, a := range m.Answers {
+			cname, isCNAME := a.Data.(*CNAME)
+			if !isCNAME || !containsName(names, a.Name) || containsName(names, cname.Target) {
+				continue
+			}
+			names = append(names, cname.Target)
+			changed = true
+		}
+	}
+
+	var found []RR
+	for _, a := range m.Answers {
+		if a.Type == rrType && containsName(names, a.Name) {
+			found = append(found, a)
+		}
+	}
+	return found
+}
+
+// Returns the nameservers configured on the system
+func SystemServers() ([]string, error) {
+	file, openErr := os.Open(resolvConfPath)
+	if openErr != nil {
+		return nil, openErr
+	}
+	defer file.Close()
+
+	var servers []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			servers = append(servers, WithDefaultPort(fields[1]))
+		}
+	}
+	return servers, scanner.Err()
+}
+
+// Appends the default DNS port to the given address, if it doesn't specify a port yet
+func WithDefaultPort(address string) string {
+	if _, _, splitErr := net.SplitHostPort(address); splitErr == nil {
+		// Already has a port
+		return address
+	}
+	return net.JoinHostPort(strings.Trim(address, "[]"), "53")
+}
+
+// Checks if the name is contained in the list of names
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if EqualNames(n, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns a random message ID, to make spoofing responses a bit harder
+func randomID() uint16 {
+	var buf [2]byte
+	rand.Read(buf[:])
+	return binary.BigEndian.Uint16(buf[:])
+}
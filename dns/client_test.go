@@ -0,0 +1,129 @@
+package dns
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// Answers UDP queries on a loopback port with the given function, until the test ends.
+// Returns the address of the server.
+func serveUDP(t *testing.T, answer func(query *Message) []*Message) string {
+	t.Helper()
+
+	conn, listenErr := net.ListenPacket("udp", "127.0.0.1:0")
+	if listenErr != nil {
+		t.Fatalf("Failed to listen: %s", listenErr.Error())
+	}
+	t.Cleanup(func() {
+		conn.Close()
+	})
+
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			length, addr, readErr := conn.ReadFrom(buf)
+			if readErr != nil {
+				return
+			}
+			query, unpackErr := Unpack(buf[:length])
+			if unpackErr != nil {
+				continue
+			}
+			for _, response := range answer(query) {
+				packed, packErr := response.Pack()
+				if packErr != nil {
+					t.Errorf("Failed to pack response: %s", packErr.Error())
+					return
+				}
+				conn.WriteTo(packed, addr)
+			}
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestClientQuery(t *testing.T) {
+	server := serveUDP(t, func(query *Message) []*Message {
+		// A spoofed response with the wrong ID comes first, and has to be ignored
+		spoofed := NewResponse(query)
+		spoofed.ID++
+		spoofed.Answers = []RR{
+			{Name: query.Questions[0].Name, TTL: 60, Class: ClassINET, Type: TypeMX, Data: &MX{Preference: 0, Exchange: "spoofed.mexico.invalid."}},
+		}
+
+		response := NewResponse(query)
+		response.Authoritative = true
+		response.Answers = []RR{
+			{Name: query.Questions[0].Name, TTL: 60, Class: ClassINET, Type: TypeMX, Data: &MX{Preference: 0, Exchange: "push-1.mexico.invalid."}},
+		}
+		return []*Message{spoofed, response}
+	})
+
+	client := Client{
+		Server:  server,
+		Timeout: time.Second,
+	}
+	response, queryErr := client.Query("fib.mxc.example", TypeMX)
+	if queryErr != nil {
+		t.Fatalf("Query: %s", queryErr.Error())
+	}
+	if response.Server != server || response.OverTCP || !response.Authoritative {
+		t.Errorf("Got response from %s, over TCP %t, authoritative %t", response.Server, response.OverTCP, response.Authoritative)
+	}
+	answers := response.AnswersFor("fib.mxc.example.", TypeMX)
+	if len(answers) != 1 || answers[0].Data.(*MX).Exchange != "push-1.mexico.invalid." {
+		t.Errorf("Got answers %v, want the MX record of the genuine response", answers)
+	}
+}
+
+func TestClientRetriesServerFailures(t *testing.T) {
+	server := serveUDP(t, func(query *Message) []*Message {
+		response := NewResponse(query)
+		response.Rcode = RcodeServerFailure
+		return []*Message{response}
+	})
+
+	client := Client{
+		Server:  server,
+		Timeout: time.Second,
+		Retries: 1,
+	}
+	if _, queryErr := client.Query("fib.mxc.example", TypeMX); queryErr == nil {
+		t.Errorf("Query succeeded, although the server answered with SERVFAIL")
+	}
+}
+
+func TestAnswersForFollowsCNAME(t *testing.T) {
+	message := Message{
+		Answers: []RR{
+			{Name: "www.example.", Class: ClassINET, Type: TypeCNAME, Data: &CNAME{Target: "alias.example."}},
+			{Name: "Alias.Example.", Class: ClassINET, Type: TypeCNAME, Data: &CNAME{Target: "fib.mxc.example."}},
+			{Name: "fib.mxc.example.", Class: ClassINET, Type: TypeMX, Data: &MX{Preference: 0, Exchange: "dup.mexico.invalid."}},
+			{Name: "fib.mxc.example.", Class: ClassINET, Type: TypeNS, Data: &NS{Host: "ns.mxc.example."}},
+			{Name: "other.example.", Class: ClassINET, Type: TypeMX, Data: &MX{Preference: 0, Exchange: "del.mexico.invalid."}},
+			{Name: "loop.example.", Class: ClassINET, Type: TypeCNAME, Data: &CNAME{Target: "www.example."}},
+		},
+	}
+
+	answers := message.AnswersFor("www.example.", TypeMX)
+	if len(answers) != 1 || answers[0].Data.(*MX).Exchange != "dup.mexico.invalid." {
+		t.Errorf("Got answers %v, want the MX record of fib.mxc.example.", answers)
+	}
+}
+
+func TestWithDefaultPort(t *testing.T) {
+	tests := map[string]string{
+		"127.0.0.1":      "127.0.0.1:53",
+		"127.0.0.1:5353": "127.0.0.1:5353",
+		"::1":            "[::1]:53",
+		"[::1]":          "[::1]:53",
+		"[::1]:5353":     "[::1]:5353",
+		"ns.example":     "ns.example:53",
+	}
+	for address, want := range tests {
+		if got := WithDefaultPort(address); got != want {
+			t.Errorf("WithDefaultPort(%q) = %q, want %q", address, got, want)
+		}
+	}
+}
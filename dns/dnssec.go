@@ -0,0 +1,344 @@
+package dns
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"github.com/pkg/errors"
+	"hash"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DNSSEC signing algorithms supported by this package
+const (
+	AlgorithmRSASHA256       uint8 = 8
+	AlgorithmRSASHA512       uint8 = 10
+	AlgorithmECDSAP256SHA256 uint8 = 13
+	AlgorithmECDSAP384SHA384 uint8 = 14
+	AlgorithmED25519         uint8 = 15
+)
+
+// Digest types of DS records supported by this package
+const (
+	DigestSHA1   uint8 = 1
+	DigestSHA256 uint8 = 2
+	DigestSHA384 uint8 = 4
+)
+
+// Flags of DNSKEY records
+const (
+	// The key is a zone key, and may be used to validate RRSIG records
+	FlagZoneKey uint16 = 1 << 8
+
+	// The key is a secure entry point, usually referred to by a DS record of the parent zone
+	FlagSEP uint16 = 1
+)
+
+const (
+	// The only valid value of the protocol field of DNSKEY records
+	dnskeyProtocol = 3
+
+	// The presentation format of signature expiration and inception times
+	signatureTimeFormat = "20060102150405"
+)
+
+// Calculates the key tag of the key, as used by RRSIG and DS records to refer to it
+func (k *DNSKEY) KeyTag() uint16 {
+	wire, _ := canonicalRData(&RR{
+		Type: TypeDNSKEY,
+		Data: k,
+	})
+
+	var sum uint32
+	for i, b := range wire {
+		if i%2 == 0 {
+			sum += uint32(b) << 8
+		} else {
+			sum += uint32(b)
+		}
+	}
+	sum += sum >> 16
+	return uint16(sum)
+}
+
+// Builds the DS record data referring to the key, which is owned by the given zone
+func (k *DNSKEY) ToDS(owner string, digestType uint8) (*DS, error) {
+	var h hash.Hash
+	switch digestType {
+	case DigestSHA1:
+		h = sha1.New()
+	case DigestSHA256:
+		h = sha256.New()
+	case DigestSHA384:
+		h = sha512.New384()
+	default:
+		return nil, errors.New(fmt.Sprintf("Unsupported DS digest type %d", digestType))
+	}
+
+	// The digest covers the owner name and the key data, both in canonical form
+	p := packer{
+		names:     make(map[string]int),
+		canonical: true,
+	}
+	if nameErr := p.name(owner, false); nameErr != nil {
+		return nil, nameErr
+	}
+	rdata, rdataErr := canonicalRData(&RR{
+		Type: TypeDNSKEY,
+		Data: k,
+	})
+	if rdataErr != nil {
+		return nil, rdataErr
+	}
+	h.Write(p.buf)
+	h.Write(rdata)
+
+	return &DS{
+		KeyTag:     k.KeyTag(),
+		Algorithm:  k.Algorithm,
+		DigestType: digestType,
+		Digest:     h.Sum(nil),
+	}, nil
+}
+
+// Checks if the signature is a valid signature of the RRset, made with the given key at the given point in time
+func VerifyRRSIG(rrset []RR, signature *RR, key *DNSKEY, now time.Time) error {
+	sig, isRRSIG := signature.Data.(*RRSIG)
+	if !isRRSIG {
+		return errors.New("Not a RRSIG record")
+	}
+	if len(rrset) == 0 {
+		return errors.New("Can't verify the signature of an empty RRset")
+	}
+	owner := rrset[0].Name
+
+	// Check if signature, RRset and key belong together at all
+	if !EqualNames(signature.Name, owner) || sig.TypeCovered != rrset[0].Type || signature.Class != rrset[0].Class {
+		return errors.New(fmt.Sprintf("Signature doesn't cover %s %s", owner, TypeToString(rrset[0].Type)))
+	}
+	if !IsSubdomain(owner, sig.SignerName) {
+		return errors.New(fmt.Sprintf("%s may not sign records of %s", sig.SignerName, owner))
+	}
+	if key.Protocol != dnskeyProtocol || key.Flags&FlagZoneKey == 0 {
+		return errors.New(fmt.Sprintf("Key %d is not a zone key", key.KeyTag()))
+	}
+	if key.Algorithm != sig.Algorithm || key.KeyTag() != sig.KeyTag {
+		return errors.New(fmt.Sprintf("Signature was not made with key %d", key.KeyTag()))
+	}
+
+	// Check the validity period, using serial number arithmetic as the timestamps wrap around
+	timestamp := uint32(now.Unix())
+	if int32(timestamp-sig.Inception) < 0 {
+		return errors.New(fmt.Sprintf("Signature of %s %s is not valid before %s", owner, TypeToString(sig.TypeCovered), formatSignatureTime(sig.Inception)))
+	}
+	if int32(sig.Expiration-timestamp) < 0 {
+		return errors.New(fmt.Sprintf("Signature of %s %s expired at %s", owner, TypeToString(sig.TypeCovered), formatSignatureTime(sig.Expiration)))
+	}
+
+	data, dataErr := signedData(rrset, sig)
+	if dataErr != nil {
+		return dataErr
+	}
+	if verifyErr := verifySignature(key, data, sig.Signature); verifyErr != nil {
+		return errors.New(fmt.Sprintf("Signature of %s %s is invalid: %s", owner, TypeToString(sig.TypeCovered), verifyErr.Error()))
+	}
+	return nil
+}
+
+// Builds the data covered by the signature: the RRSIG data without the signature itself, followed by the RRset in canonical form
+func signedData(rrset []RR, sig *RRSIG) ([]byte, error) {
+	p := packer{
+		names:     make(map[string]int),
+		canonical: true,
+	}
+	unsigned := *sig
+	unsigned.Signature = nil
+	if rdataErr := p.rdata(&RR{
+		Type: TypeRRSIG,
+		Data: &unsigned,
+	}); rdataErr != nil {
+		return nil, rdataErr
+	}
+
+	// Records expanded from a wildcard are signed with the wildcard as owner
+	owner := rrset[0].Name
+	labels, splitErr := splitName(owner)
+	if splitErr != nil {
+		return nil, splitErr
+	}
+	if len(labels) > 0 && labels[0] == "*" {
+		labels = labels[1:]
+	}
+	if int(sig.Labels) > len(labels) {
+		return nil, errors.New(fmt.Sprintf("Signature of %s has more labels than its owner", owner))
+	} else if int(sig.Labels) < len(labels) {
+		owner = "*." + strings.Join(labels[len(labels)-int(sig.Labels):], ".") + "."
+	}
+
+	// Convert each record to canonical form, with the original TTL
+	var records [][]byte
+	for i := range rrset {
+		r := rrset[i]
+		r.Name = owner
+		r.TTL = sig.OriginalTTL
+		rp := packer{
+			names:     make(map[string]int),
+			canonical: true,
+		}
+		if rrErr := rp.rr(&r); rrErr != nil {
+			return nil, rrErr
+		}
+		records = append(records, rp.buf)
+	}
+
+	// The records are sorted by their data, which starts after owner, type, class, TTL and data length. Duplicates are removed.
+	dataOffset := nameLength(records[0]) + 10
+	sort.Slice(records, func(a, b int) bool {
+		return bytes.Compare(records[a][dataOffset:], records[b][dataOffset:]) < 0
+	})
+	for i, r := range records {
+		if i > 0 && bytes.Equal(r, records[i-1]) {
+			continue
+		}
+		p.buf = append(p.buf, r...)
+	}
+	return p.buf, nil
+}
+
+// Returns the length of the uncompressed name at the start of the given wire data
+func nameLength(wire []byte) int {
+	length := 0
+	for length < len(wire) && wire[length] != 0 {
+		length += int(wire[length]) + 1
+	}
+	return length + 1
+}
+
+// Converts the data of the record into canonical wire format
+func canonicalRData(rr *RR) ([]byte, error) {
+	p := packer{
+		names:     make(map[string]int),
+		canonical: true,
+	}
+	if rdataErr := p.rdata(rr); rdataErr != nil {
+		return nil, rdataErr
+	}
+	return p.buf, nil
+}
+
+// Checks the signature of the data with the public key
+func verifySignature(key *DNSKEY, data []byte, signature []byte) error {
+	switch key.Algorithm {
+	case AlgorithmRSASHA256, AlgorithmRSASHA512:
+		publicKey, keyErr := parseRSAKey(key.PublicKey)
+		if keyErr != nil {
+			return keyErr
+		}
+		hashType := crypto.SHA256
+		if key.Algorithm == AlgorithmRSASHA512 {
+			hashType = crypto.SHA512
+		}
+		h := hashType.New()
+		h.Write(data)
+		return rsa.VerifyPKCS1v15(publicKey, hashType, h.Sum(nil), signature)
+	case AlgorithmECDSAP256SHA256, AlgorithmECDSAP384SHA384:
+		curve := elliptic.P256()
+		hashType := crypto.SHA256
+		if key.Algorithm == AlgorithmECDSAP384SHA384 {
+			curve = elliptic.P384()
+			hashType = crypto.SHA384
+		}
+
+		// Both the key and the signature consist of two integers of the curve size
+		size := curve.Params().BitSize / 8
+		if len(key.PublicKey) != 2*size {
+			return errors.New("Invalid ECDSA key length")
+		}
+		if len(signature) != 2*size {
+			return errors.New("Invalid ECDSA signature length")
+		}
+		publicKey := ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(key.PublicKey[:size]),
+			Y:     new(big.Int).SetBytes(key.PublicKey[size:]),
+		}
+		h := hashType.New()
+		h.Write(data)
+		if !ecdsa.Verify(&publicKey, h.Sum(nil), new(big.Int).SetBytes(signature[:size]), new(big.Int).SetBytes(signature[size:])) {
+			return errors.New("Verification failed")
+		}
+		return nil
+	case AlgorithmED25519:
+		if len(key.PublicKey) != ed25519.PublicKeySize {
+			return errors.New("Invalid Ed25519 key length")
+		}
+		if !ed25519.Verify(key.PublicKey, data, signature) {
+			return errors.New("Verification failed")
+		}
+		return nil
+	}
+	return errors.New(fmt.Sprintf("Unsupported algorithm %d", key.Algorithm))
+}
+
+// Parses a RSA public key in the format of RFC 3110
+func parseRSAKey(raw []byte) (*rsa.PublicKey, error) {
+	if len(raw) < 1 {
+		return nil, errors.New("Invalid RSA key length")
+	}
+
+	// The exponent length is stored in one byte, or in the two following bytes if the first one is zero
+	exponentLength := int(raw[0])
+	offset := 1
+	if exponentLength == 0 {
+		if len(raw) < 3 {
+			return nil, errors.New("Invalid RSA key length")
+		}
+		exponentLength = int(raw[1])<<8 | int(raw[2])
+		offset = 3
+	}
+	if exponentLength == 0 || exponentLength > 4 || len(raw) <= offset+exponentLength {
+		return nil, errors.New("Unsupported RSA exponent")
+	}
+
+	exponent := 0
+	for _, b := range raw[offset : offset+exponentLength] {
+		exponent = exponent<<8 | int(b)
+	}
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(raw[offset+exponentLength:]),
+		E: exponent,
+	}, nil
+}
+
+// Converts a signature timestamp into its presentation format
+func formatSignatureTime(t uint32) string {
+	return time.Unix(int64(t), 0).UTC().Format(signatureTimeFormat)
+}
+
+// Parses a signature timestamp, given either in its presentation format or as plain number of seconds
+func parseSignatureTime(s string) (uint32, error) {
+	if len(s) == len(signatureTimeFormat) {
+		parsed, parseErr := time.Parse(signatureTimeFormat, s)
+		if parseErr != nil {
+			return 0, errors.New(fmt.Sprintf("Invalid signature time '%s'", s))
+		}
+		return uint32(parsed.Unix()), nil
+	}
+
+	seconds, atoiErr := strconv.ParseUint(s, 10, 32)
+	if atoiErr != nil {
+		return 0, errors.New(fmt.Sprintf("Invalid signature time '%s'", s))
+	}
+	return uint32(seconds), nil
+}
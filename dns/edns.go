@@ -0,0 +1,67 @@
+package dns
+
+const (
+	// The UDP buffer size we announce via EDNS0
+	DefaultEDNSSize = 1232
+
+	// The DNSSEC OK bit in the extended flags, which are stored in the TTL of the OPT record
+	flagDNSSECOK = 1 << 15
+)
+
+// Adds an EDNS0 OPT pseudo-record to the message, announcing the given UDP buffer size.
+// If the message already carries an OPT record, it is replaced.
+func (m *Message) SetEDNS0(udpSize uint16) {
+	// Remove existing OPT records first
+	var additional []RR
+	for _, a := range m.Additional {
+		if a.Type != TypeOPT {
+			additional = append(additional, a)
+		}
+	}
+
+	m.Additional = append(additional, RR{
+		Name:  ".",
+		Type:  TypeOPT,
+		Class: udpSize,
+		Data:  &OPT{},
+	})
+}
+
+// Returns the EDNS0 OPT pseudo-record of the message, or nil if there is none
+func (m *Message) EDNS0() *RR {
+	for i := range m.Additional {
+		if m.Additional[i].Type == TypeOPT {
+			return &m.Additional[i]
+		}
+	}
+	return nil
+}
+
+// Returns the UDP buffer size announced by the sender of the message, or the minimum size if EDNS0 is not used
+func (m *Message) UDPSize() int {
+	opt := m.EDNS0()
+	if opt == nil || opt.Class < MinUDPSize {
+		return MinUDPSize
+	}
+	return int(opt.Class)
+}
+
+// Sets or clears the DNSSEC OK bit, telling the server whether to include DNSSEC records in the response.
+// This requires an EDNS0 OPT record, so SetEDNS0() has to be called first.
+func (m *Message) SetDNSSECOK(ok bool) {
+	opt := m.EDNS0()
+	if opt == nil {
+		return
+	}
+	if ok {
+		opt.TTL |= flagDNSSECOK
+	} else {
+		opt.TTL &^= flagDNSSECOK
+	}
+}
+
+// Checks if the DNSSEC OK bit is set, meaning that the sender is interested in DNSSEC records
+func (m *Message) DNSSECOK() bool {
+	opt := m.EDNS0()
+	return opt != nil && opt.TTL&flagDNSSECOK != 0
+}
@@ -0,0 +1,138 @@
+package dns
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"encoding/base64"
+	"fmt"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	// Mapping of the supported signing algorithms to the mnemonics used in key files
+	algorithmNames = map[uint8]string{
+		AlgorithmECDSAP256SHA256: "ECDSAP256SHA256",
+		AlgorithmED25519:         "ED25519",
+	}
+)
+
+// Reads a key pair in the format written by BIND's dnssec-keygen, i.e. a ".key" file holding the DNSKEY record and a ".private" file holding the private key.
+// The given path may point to either of them, or omit the extension.
+func ReadKey(path string) (*SigningKey, error) {
+	base := strings.TrimSuffix(strings.TrimSuffix(path, ".key"), ".private")
+
+	// Read the public part first
+	zone, readErr := ReadZoneFile(base+".key", "")
+	if readErr != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to read public key %s.key: %s", base, readErr.Error()))
+	}
+	var key SigningKey
+	for _, r := range zone.Records {
+		if dnskey, isDNSKEY := r.Data.(*DNSKEY); isDNSKEY {
+			key.Zone = strings.ToLower(Fqdn(r.Name))
+			key.DNSKEY = *dnskey
+			break
+		}
+	}
+	if key.Zone == "" {
+		return nil, errors.New(fmt.Sprintf("No DNSKEY record found in %s.key", base))
+	}
+
+	// Now the private part, consisting of "Field: value" lines
+	file, openErr := os.Open(base + ".private")
+	if openErr != nil {
+		return nil, openErr
+	}
+	defer file.Close()
+	fields := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if parts := strings.SplitN(scanner.Text(), ":", 2); len(parts) == 2 {
+			fields[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+	}
+	if scanErr := scanner.Err(); scanErr != nil {
+		return nil, scanErr
+	}
+
+	algorithm := strings.Fields(fields["Algorithm"])
+	if len(algorithm) == 0 || algorithm[0] != fmt.Sprint(key.DNSKEY.Algorithm) {
+		return nil, errors.New(fmt.Sprintf("Algorithm of %s.private doesn't match the public key", base))
+	}
+	raw, base64Err := base64.StdEncoding.DecodeString(fields["PrivateKey"])
+	if base64Err != nil || len(raw) == 0 {
+		return nil, errors.New(fmt.Sprintf("Invalid private key in %s.private", base))
+	}
+
+	// Restore the private key, and check if it really belongs to the public key
+	var public []byte
+	switch key.DNSKEY.Algorithm {
+	case AlgorithmED25519:
+		if len(raw) != ed25519.SeedSize {
+			return nil, errors.New(fmt.Sprintf("Invalid private key length in %s.private", base))
+		}
+		private := ed25519.NewKeyFromSeed(raw)
+		public = private.Public().(ed25519.PublicKey)
+		key.private = private
+	case AlgorithmECDSAP256SHA256:
+		private := ecdsa.PrivateKey{
+			D: new(big.Int).SetBytes(raw),
+		}
+		private.Curve = elliptic.P256()
+		private.X, private.Y = private.Curve.ScalarBaseMult(raw)
+		public = ecdsaPublicKey(&private.PublicKey)
+		key.private = &private
+	default:
+		return nil, errors.New(fmt.Sprintf("Unsupported algorithm %d for signing", key.DNSKEY.Algorithm))
+	}
+	if !bytes.Equal(public, key.DNSKEY.PublicKey) {
+		return nil, errors.New(fmt.Sprintf("Private key in %s.private doesn't belong to the public key", base))
+	}
+
+	return &key, nil
+}
+
+// Writes the key pair into the given directory, in the format written by BIND's dnssec-keygen.
+// Returns the path of the files, without the ".key" and ".private" extension.
+func (k *SigningKey) WriteFiles(directory string) (string, error) {
+	base := filepath.Join(directory, fmt.Sprintf("K%s+%03d+%05d", k.Zone, k.DNSKEY.Algorithm, k.DNSKEY.KeyTag()))
+
+	// The public part is a zonefile holding the DNSKEY record
+	dnskey := k.DNSKEY
+	record := RR{
+		Name:  k.Zone,
+		Class: ClassINET,
+		Type:  TypeDNSKEY,
+		Data:  &dnskey,
+	}
+	public := fmt.Sprintf("; This is a key for %s, keyid %d\n%s\n", k.Zone, k.DNSKEY.KeyTag(), record.String())
+
+	// The private part is only readable by the owner, for obvious reasons
+	var raw []byte
+	switch private := k.private.(type) {
+	case ed25519.PrivateKey:
+		raw = private.Seed()
+	case *ecdsa.PrivateKey:
+		raw = make([]byte, 32)
+		private.D.FillBytes(raw)
+	default:
+		return "", errors.New("Key has no private part")
+	}
+	private := fmt.Sprintf("Private-key-format: v1.3\nAlgorithm: %d (%s)\nPrivateKey: %s\n", k.DNSKEY.Algorithm, algorithmNames[k.DNSKEY.Algorithm], base64.StdEncoding.EncodeToString(raw))
+
+	if writeErr := ioutil.WriteFile(base+".key", []byte(public), 0644); writeErr != nil {
+		return "", writeErr
+	}
+	if writeErr := ioutil.WriteFile(base+".private", []byte(private), 0600); writeErr != nil {
+		return "", writeErr
+	}
+	return base, nil
+}
@@ -0,0 +1,141 @@
+package dns
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestReadKeyRoundTrip(t *testing.T) {
+	for _, algorithm := range []uint8{AlgorithmED25519, AlgorithmECDSAP256SHA256} {
+		key, generateErr := GenerateKey("mxc.example", algorithm, FlagZoneKey|FlagSEP)
+		if generateErr != nil {
+			t.Fatalf("Algorithm %d: GenerateKey: %s", algorithm, generateErr.Error())
+		}
+		base, writeErr := key.WriteFiles(t.TempDir())
+		if writeErr != nil {
+			t.Fatalf("Algorithm %d: WriteFiles: %s", algorithm, writeErr.Error())
+		}
+
+		// Any of the paths may be given
+		for _, path := range []string{base, base + ".key", base + ".private"} {
+			read, readErr := ReadKey(path)
+			if readErr != nil {
+				t.Errorf("Algorithm %d: ReadKey(%s): %s", algorithm, path, readErr.Error())
+				continue
+			}
+			if read.Zone != "mxc.example." || read.DNSKEY.KeyTag() != key.DNSKEY.KeyTag() {
+				t.Errorf("Algorithm %d: ReadKey(%s) returned key %d of %s", algorithm, path, read.DNSKEY.KeyTag(), read.Zone)
+			}
+		}
+	}
+}
+
+func TestReadKeyCorrupted(t *testing.T) {
+	tests := []struct {
+		name      string
+		algorithm uint8
+
+		// Changes the contents of the .key and .private files
+		public  func(s string) string
+		private func(s string) string
+	}{
+		{
+			name:      "empty public key file",
+			algorithm: AlgorithmED25519,
+			public:    func(s string) string { return "" },
+		},
+		{
+			name:      "garbage in public key file",
+			algorithm: AlgorithmED25519,
+			public:    func(s string) string { return "mxc.example. IN DNSKEY 257 3 15 !!!\n" },
+		},
+		{
+			name:      "short public key",
+			algorithm: AlgorithmECDSAP256SHA256,
+			public:    func(s string) string { return "mxc.example. IN DNSKEY 257 3 13 AAAA\n" },
+		},
+		{
+			name:      "empty private key file",
+			algorithm: AlgorithmED25519,
+			private:   func(s string) string { return "" },
+		},
+		{
+			name:      "algorithm not matching",
+			algorithm: AlgorithmED25519,
+			private:   func(s string) string { return strings.Replace(s, "Algorithm: 15", "Algorithm: 13", 1) },
+		},
+		{
+			name:      "invalid base64",
+			algorithm: AlgorithmED25519,
+			private:   func(s string) string { return strings.Replace(s, "PrivateKey: ", "PrivateKey: !", 1) },
+		},
+		{
+			name:      "truncated Ed25519 key",
+			algorithm: AlgorithmED25519,
+			private:   func(s string) string { return strings.SplitAfter(s, "PrivateKey: ")[0] + "AAAA\n" },
+		},
+		{
+			name:      "zero ECDSA key",
+			algorithm: AlgorithmECDSAP256SHA256,
+			private:   func(s string) string { return strings.SplitAfter(s, "PrivateKey: ")[0] + "AAAA\n" },
+		},
+		{
+			name:      "long ECDSA key",
+			algorithm: AlgorithmECDSAP256SHA256,
+			private: func(s string) string {
+				return strings.SplitAfter(s, "PrivateKey: ")[0] + strings.Repeat("/////", 20) + "\n"
+			},
+		},
+		{
+			name:      "key of another algorithm",
+			algorithm: AlgorithmED25519,
+			public: func(s string) string {
+				return strings.Replace(s, " 15 ", " 13 ", 1)
+			},
+			private: func(s string) string { return strings.Replace(s, "Algorithm: 15", "Algorithm: 13", 1) },
+		},
+	}
+
+	for _, test := range tests {
+		key, generateErr := GenerateKey("mxc.example", test.algorithm, FlagZoneKey|FlagSEP)
+		if generateErr != nil {
+			t.Fatalf("%s: GenerateKey: %s", test.name, generateErr.Error())
+		}
+		base, writeErr := key.WriteFiles(t.TempDir())
+		if writeErr != nil {
+			t.Fatalf("%s: WriteFiles: %s", test.name, writeErr.Error())
+		}
+		corrupt(t, base+".key", test.public)
+		corrupt(t, base+".private", test.private)
+
+		if _, readErr := ReadKey(base); readErr == nil {
+			t.Errorf("%s: ReadKey succeeded", test.name)
+		}
+	}
+
+	// A missing private key file is an error as well
+	key, _ := GenerateKey("mxc.example", AlgorithmED25519, FlagZoneKey|FlagSEP)
+	base, _ := key.WriteFiles(t.TempDir())
+	os.Remove(base + ".private")
+	if _, readErr := ReadKey(base); readErr == nil {
+		t.Errorf("ReadKey succeeded without private key file")
+	}
+}
+
+// Replaces the contents of the file with the result of the given function, if any
+func corrupt(t *testing.T, path string, change func(s string) string) {
+	t.Helper()
+
+	if change == nil {
+		return
+	}
+	contents, readErr := ioutil.ReadFile(path)
+	if readErr != nil {
+		t.Fatalf("Failed to read %s: %s", path, readErr.Error())
+	}
+	if writeErr := ioutil.WriteFile(path, []byte(change(string(contents))), 0600); writeErr != nil {
+		t.Fatalf("Failed to write %s: %s", path, writeErr.Error())
+	}
+}
@@ -0,0 +1,785 @@
+package dns
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"github.com/pkg/errors"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Opcodes known to this package
+const (
+	OpcodeQuery uint8 = 0
+)
+
+// Response codes known to this package
+const (
+	RcodeSuccess        uint8 = 0
+	RcodeFormatError    uint8 = 1
+	RcodeServerFailure  uint8 = 2
+	RcodeNameError      uint8 = 3
+	RcodeNotImplemented uint8 = 4
+	RcodeRefused        uint8 = 5
+)
+
+var (
+	// Mapping of response codes to their mnemonics
+	rcodeNames = map[uint8]string{
+		RcodeSuccess:        "NOERROR",
+		RcodeFormatError:    "FORMERR",
+		RcodeServerFailure:  "SERVFAIL",
+		RcodeNameError:      "NXDOMAIN",
+		RcodeNotImplemented: "NOTIMP",
+		RcodeRefused:        "REFUSED",
+	}
+)
+
+const (
+	// The maximum size of a DNS message over UDP, if the client doesn't announce a bigger buffer via EDNS0
+	MinUDPSize = 512
+
+	// Length of the fixed DNS header
+	headerLength = 12
+
+	// Maximum number of compression pointers to follow, to avoid loops in malicious messages
+	maxPointers = 32
+)
+
+// The header of a DNS message, with the flags already split up
+type Header struct {
+	ID                 uint16
+	Response           bool
+	Opcode             uint8
+	Authoritative      bool
+	Truncated          bool
+	RecursionDesired   bool
+	RecursionAvailable bool
+	Rcode              uint8
+}
+
+// A question, as found in the question section of a DNS message
+type Question struct {
+	Name  string
+	Type  uint16
+	Class uint16
+}
+
+// A complete DNS message
+type Message struct {
+	Header
+	Questions  []Question
+	Answers    []RR
+	Authority  []RR
+	Additional []RR
+}
+
+// Builds up the wire format of a message, remembering names for compression.
+// In canonical mode, as required for DNSSEC, names are neither compressed nor kept in their original case.
+type packer struct {
+	buf       []byte
+	names     map[string]int
+	canonical bool
+}
+
+// Reads the wire format of a message
+type unpacker struct {
+	buf []byte
+	off int
+}
+
+// Returns a new query message for the given name and type, using the given ID
+func NewQuery(id uint16, name string, rrType uint16) *Message {
+	return &Message{
+		Header: Header{
+			ID:               id,
+			Opcode:           OpcodeQuery,
+			RecursionDesired: true,
+		},
+		Questions: []Question{
+			{
+				Name:  Fqdn(name),
+				Type:  rrType,
+				Class: ClassINET,
+			},
+		},
+	}
+}
+
+// Returns a response message for the given query, with ID, opcode, question and RD flag copied over
+func NewResponse(query *Message) *Message {
+	return &Message{
+		Header: Header{
+			ID:               query.ID,
+			Response:         true,
+			Opcode:           query.Opcode,
+			RecursionDesired: query.RecursionDesired,
+		},
+		Questions: query.Questions,
+	}
+}
+
+// Converts the message into its wire format
+func (m *Message) Pack() ([]byte, error) {
+	p := packer{
+		buf:   make([]byte, headerLength, MinUDPSize),
+		names: make(map[string]int),
+	}
+
+	// Write header
+	var flags uint16
+	if m.Response {
+		flags |= 1 << 15
+	}
+	flags |= uint16(m.Opcode&0xF) << 11
+	if m.Authoritative {
+		flags |= 1 << 10
+	}
+	if m.Truncated {
+		flags |= 1 << 9
+	}
+	if m.RecursionDesired {
+		flags |= 1 << 8
+	}
+	if m.RecursionAvailable {
+		flags |= 1 << 7
+	}
+	flags |= uint16(m.Rcode & 0xF)
+	binary.BigEndian.PutUint16(p.buf[0:], m.ID)
+	binary.BigEndian.PutUint16(p.buf[2:], flags)
+	binary.BigEndian.PutUint16(p.buf[4:], uint16(len(m.Questions)))
+	binary.BigEndian.PutUint16(p.buf[6:], uint16(len(m.Answers)))
+	binary.BigEndian.PutUint16(p.buf[8:], uint16(len(m.Authority)))
+	binary.BigEndian.PutUint16(p.buf[10:], uint16(len(m.Additional)))
+
+	// Write questions
+	for _, q := range m.Questions {
+		if nameErr := p.name(q.Name, true); nameErr != nil {
+			return nil, nameErr
+		}
+		p.uint16(q.Type)
+		p.uint16(q.Class)
+	}
+
+	// Write records of all sections
+	for _, section := range [][]RR{m.Answers, m.Authority, m.Additional} {
+		for i := range section {
+			if rrErr := p.rr(&section[i]); rrErr != nil {
+				return nil, rrErr
+			}
+		}
+	}
+
+	return p.buf, nil
+}
+
+// Parses the wire format of a message
+func Unpack(buf []byte) (*Message, error) {
+	if len(buf) < headerLength {
+		return nil, errors.New("Message is shorter than a DNS header")
+	}
+
+	// Read header
+	var m Message
+	flags := binary.BigEndian.Uint16(buf[2:])
+	m.ID = binary.BigEndian.Uint16(buf[0:])
+	m.Response = flags&(1<<15) != 0
+	m.Opcode = uint8(flags>>11) & 0xF
+	m.Authoritative = flags&(1<<10) != 0
+	m.Truncated = flags&(1<<9) != 0
+	m.RecursionDesired = flags&(1<<8) != 0
+	m.RecursionAvailable = flags&(1<<7) != 0
+	m.Rcode = uint8(flags & 0xF)
+	questionCount := int(binary.BigEndian.Uint16(buf[4:]))
+	sectionCounts := []int{
+		int(binary.BigEndian.Uint16(buf[6:])),
+		int(binary.BigEndian.Uint16(buf[8:])),
+		int(binary.BigEndian.Uint16(buf[10:])),
+	}
+
+	u := unpacker{
+		buf: buf,
+		off: headerLength,
+	}
+
+	// Read questions
+	for i := 0; i < questionCount; i++ {
+		name, nameErr := u.name()
+		if nameErr != nil {
+			return nil, nameErr
+		}
+		rrType, typeErr := u.uint16()
+		if typeErr != nil {
+			return nil, typeErr
+		}
+		class, classErr := u.uint16()
+		if classErr != nil {
+			return nil, classErr
+		}
+		m.Questions = append(m.Questions, Question{
+			Name:  name,
+			Type:  rrType,
+			Class: class,
+		})
+	}
+
+	// Read records of all sections
+	sections := []*[]RR{&m.Answers, &m.Authority, &m.Additional}
+	for s, count := range sectionCounts {
+		for i := 0; i < count; i++ {
+			rr, rrErr := u.rr()
+			if rrErr != nil {
+				return nil, rrErr
+			}
+			*sections[s] = append(*sections[s], *rr)
+		}
+	}
+
+	return &m, nil
+}
+
+// Appends a 16 bit value
+func (p *packer) uint16(v uint16) {
+	p.buf = append(p.buf, byte(v>>8), byte(v))
+}
+
+// Appends a 32 bit value
+func (p *packer) uint32(v uint32) {
+	p.buf = append(p.buf, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+// Appends a domain name, compressing it with names written before if allowed
+func (p *packer) name(name string, compress bool) error {
+	labels, splitErr := splitName(name)
+	if splitErr != nil {
+		return splitErr
+	}
+	if p.canonical {
+		for i := range labels {
+			labels[i] = lowerASCII(labels[i])
+		}
+		compress = false
+	}
+
+	for i := range labels {
+		// Check if we already wrote the remaining part of the name somewhere
+		suffix := strings.ToLower(strings.Join(labels[i:], "."))
+		if offset, ok := p.names[suffix]; ok && compress {
+			p.uint16(0xC000 | uint16(offset))
+			return nil
+		}
+
+		// Remember where this suffix starts, if it's reachable by a compression pointer
+		if len(p.buf) < 0x4000 {
+			p.names[suffix] = len(p.buf)
+		}
+
+		p.buf = append(p.buf, byte(len(labels[i])))
+		p.buf = append(p.buf, labels[i]...)
+	}
+
+	// Terminate with the root label
+	p.buf = append(p.buf, 0)
+	return nil
+}
+
+// Appends a resource record
+func (p *packer) rr(rr *RR) error {
+	if nameErr := p.name(rr.Name, true); nameErr != nil {
+		return nameErr
+	}
+	p.uint16(rr.Type)
+	p.uint16(rr.Class)
+	p.uint32(rr.TTL)
+
+	// Reserve space for the data length, and fill it in afterwards
+	lengthOffset := len(p.buf)
+	p.uint16(0)
+	if dataErr := p.rdata(rr); dataErr != nil {
+		return dataErr
+	}
+	dataLength := len(p.buf) - lengthOffset - 2
+	if dataLength > 0xFFFF {
+		return errors.New(fmt.Sprintf("Data of record %s is too long", rr.Name))
+	}
+	binary.BigEndian.PutUint16(p.buf[lengthOffset:], uint16(dataLength))
+	return nil
+}
+
+// Appends the type-specific data of a record
+func (p *packer) rdata(rr *RR) error {
+	switch data := rr.Data.(type) {
+	case *MX:
+		p.uint16(data.Preference)
+		return p.name(data.Exchange, true)
+	case *SOA:
+		if nameErr := p.name(data.MName, true); nameErr != nil {
+			return nameErr
+		}
+		if nameErr := p.name(data.RName, true); nameErr != nil {
+			return nameErr
+		}
+		p.uint32(data.Serial)
+		p.uint32(data.Refresh)
+		p.uint32(data.Retry)
+		p.uint32(data.Expire)
+		p.uint32(data.Minimum)
+	case *NS:
+		return p.name(data.Host, true)
+	case *CNAME:
+		return p.name(data.Target, true)
+	case *A:
+		p.buf = append(p.buf, data.IP.To4()...)
+	case *AAAA:
+		p.buf = append(p.buf, data.IP.To16()...)
+	case *TXT:
+		for _, s := range data.Strings {
+			if len(s) > 255 {
+				return errors.New(fmt.Sprintf("Character string in TXT record of %s is too long", rr.Name))
+			}
+			p.buf = append(p.buf, byte(len(s)))
+			p.buf = append(p.buf, s...)
+		}
+	case *OPT:
+		p.buf = append(p.buf, data.Options...)
+	case *DS:
+		p.uint16(data.KeyTag)
+		p.buf = append(p.buf, data.Algorithm, data.DigestType)
+		p.buf = append(p.buf, data.Digest...)
+	case *RRSIG:
+		p.uint16(data.TypeCovered)
+		p.buf = append(p.buf, data.Algorithm, data.Labels)
+		p.uint32(data.OriginalTTL)
+		p.uint32(data.Expiration)
+		p.uint32(data.Inception)
+		p.uint16(data.KeyTag)
+		if nameErr := p.name(data.SignerName, false); nameErr != nil {
+			return nameErr
+		}
+		p.buf = append(p.buf, data.Signature...)
+	case *NSEC:
+		if nameErr := p.name(data.NextName, false); nameErr != nil {
+			return nameErr
+		}
+		p.buf = append(p.buf, packTypeBitmap(data.Types)...)
+	case *DNSKEY:
+		p.uint16(data.Flags)
+		p.buf = append(p.buf, data.Protocol, data.Algorithm)
+		p.buf = append(p.buf, data.PublicKey...)
+	case *Text:
+		// We can only write data we don't know in detail if it's given in the generic notation of RFC 3597
+		raw, rawErr := parseGenericRData(data.Value)
+		if rawErr != nil {
+			return errors.New(fmt.Sprintf("Can't convert %s record of %s to wire format: %s", TypeToString(rr.Type), rr.Name, rawErr.Error()))
+		}
+		p.buf = append(p.buf, raw...)
+	default:
+		return errors.New(fmt.Sprintf("Can't convert %s record of %s to wire format", TypeToString(rr.Type), rr.Name))
+	}
+	return nil
+}
+
+// Reads a 16 bit value
+func (u *unpacker) uint16() (uint16, error) {
+	if u.off+2 > len(u.buf) {
+		return 0, errors.New("Message is truncated")
+	}
+	v := binary.BigEndian.Uint16(u.buf[u.off:])
+	u.off += 2
+	return v, nil
+}
+
+// Reads a 32 bit value
+func (u *unpacker) uint32() (uint32, error) {
+	if u.off+4 > len(u.buf) {
+		return 0, errors.New("Message is truncated")
+	}
+	v := binary.BigEndian.Uint32(u.buf[u.off:])
+	u.off += 4
+	return v, nil
+}
+
+// Reads a (maybe compressed) domain name
+func (u *unpacker) name() (string, error) {
+	var labels []string
+	off := u.off
+	pointers := 0
+	jumped := false
+
+	for {
+		if off >= len(u.buf) {
+			return "", errors.New("Message is truncated")
+		}
+		length := int(u.buf[off])
+
+		// Check if it's a compression pointer
+		if length&0xC0 == 0xC0 {
+			if off+2 > len(u.buf) {
+				return "", errors.New("Message is truncated")
+			}
+			pointers++
+			if pointers > maxPointers {
+				return "", errors.New("Too many compression pointers in name")
+			}
+			if !jumped {
+				u.off = off + 2
+				jumped = true
+			}
+			off = int(binary.BigEndian.Uint16(u.buf[off:]) & 0x3FFF)
+			continue
+		} else if length&0xC0 != 0 {
+			return "", errors.New("Unsupported label type in name")
+		}
+
+		// It's a normal label
+		off++
+		if length == 0 {
+			break
+		}
+		if off+length > len(u.buf) {
+			return "", errors.New("Message is truncated")
+		}
+		labels = append(labels, escapeLabel(u.buf[off:off+length]))
+		off += length
+	}
+
+	if !jumped {
+		u.off = off
+	}
+	return strings.Join(labels, ".") + ".", nil
+}
+
+// Reads a resource record
+func (u *unpacker) rr() (*RR, error) {
+	var rr RR
+	var readErr error
+	if rr.Name, readErr = u.name(); readErr != nil {
+		return nil, readErr
+	}
+	if rr.Type, readErr = u.uint16(); readErr != nil {
+		return nil, readErr
+	}
+	if rr.Class, readErr = u.uint16(); readErr != nil {
+		return nil, readErr
+	}
+	if rr.TTL, readErr = u.uint32(); readErr != nil {
+		return nil, readErr
+	}
+	dataLength, lengthErr := u.uint16()
+	if lengthErr != nil {
+		return nil, lengthErr
+	}
+	end := u.off + int(dataLength)
+	if end > len(u.buf) {
+		return nil, errors.New("Message is truncated")
+	}
+
+	// Read the type-specific data
+	data, dataErr := u.rdata(rr.Type, end)
+	if dataErr != nil {
+		return nil, errors.New(fmt.Sprintf("Invalid %s record of %s: %s", TypeToString(rr.Type), rr.Name, dataErr.Error()))
+	}
+	if u.off != end {
+		return nil, errors.New(fmt.Sprintf("Invalid %s record of %s: data length mismatch", TypeToString(rr.Type), rr.Name))
+	}
+	rr.Data = data
+	return &rr, nil
+}
+
+// Reads the type-specific data of a record, which ends at the given offset
+func (u *unpacker) rdata(rrType uint16, end int) (RData, error) {
+	var readErr error
+	switch rrType {
+	case TypeMX:
+		var mx MX
+		if mx.Preference, readErr = u.uint16(); readErr != nil {
+			return nil, readErr
+		}
+		if mx.Exchange, readErr = u.name(); readErr != nil {
+			return nil, readErr
+		}
+		return &mx, nil
+	case TypeSOA:
+		var soa SOA
+		if soa.MName, readErr = u.name(); readErr != nil {
+			return nil, readErr
+		}
+		if soa.RName, readErr = u.name(); readErr != nil {
+			return nil, readErr
+		}
+		for _, field := range []*uint32{&soa.Serial, &soa.Refresh, &soa.Retry, &soa.Expire, &soa.Minimum} {
+			if *field, readErr = u.uint32(); readErr != nil {
+				return nil, readErr
+			}
+		}
+		return &soa, nil
+	case TypeNS:
+		var ns NS
+		if ns.Host, readErr = u.name(); readErr != nil {
+			return nil, readErr
+		}
+		return &ns, nil
+	case TypeCNAME:
+		var cname CNAME
+		if cname.Target, readErr = u.name(); readErr != nil {
+			return nil, readErr
+		}
+		return &cname, nil
+	case TypeA, TypeAAAA:
+		length := net.IPv4len
+		if rrType == TypeAAAA {
+			length = net.IPv6len
+		}
+		if end-u.off != length {
+			return nil, errors.New("Invalid address length")
+		}
+		ip := net.IP(append([]byte{}, u.buf[u.off:end]...))
+		u.off = end
+		if rrType == TypeA {
+			return &A{
+				IP: ip,
+			}, nil
+		}
+		return &AAAA{
+			IP: ip,
+		}, nil
+	case TypeTXT:
+		var txt TXT
+		for u.off < end {
+			length := int(u.buf[u.off])
+			if u.off+1+length > end {
+				return nil, errors.New("Character string exceeds record")
+			}
+			txt.Strings = append(txt.Strings, string(u.buf[u.off+1:u.off+1+length]))
+			u.off += 1 + length
+		}
+		return &txt, nil
+	case TypeOPT:
+		opt := OPT{
+			Options: append([]byte{}, u.buf[u.off:end]...),
+		}
+		u.off = end
+		return &opt, nil
+	case TypeDS:
+		if end-u.off < 4 {
+			return nil, errors.New("Record is too short")
+		}
+		ds := DS{
+			KeyTag:     binary.BigEndian.Uint16(u.buf[u.off:]),
+			Algorithm:  u.buf[u.off+2],
+			DigestType: u.buf[u.off+3],
+			Digest:     append([]byte{}, u.buf[u.off+4:end]...),
+		}
+		u.off = end
+		return &ds, nil
+	case TypeRRSIG:
+		if end-u.off < 18 {
+			return nil, errors.New("Record is too short")
+		}
+		rrsig := RRSIG{
+			TypeCovered: binary.BigEndian.Uint16(u.buf[u.off:]),
+			Algorithm:   u.buf[u.off+2],
+			Labels:      u.buf[u.off+3],
+			OriginalTTL: binary.BigEndian.Uint32(u.buf[u.off+4:]),
+			Expiration:  binary.BigEndian.Uint32(u.buf[u.off+8:]),
+			Inception:   binary.BigEndian.Uint32(u.buf[u.off+12:]),
+			KeyTag:      binary.BigEndian.Uint16(u.buf[u.off+16:]),
+		}
+		u.off += 18
+		if rrsig.SignerName, readErr = u.name(); readErr != nil {
+			return nil, readErr
+		}
+		if u.off > end {
+			return nil, errors.New("Signer name exceeds record")
+		}
+		rrsig.Signature = append([]byte{}, u.buf[u.off:end]...)
+		u.off = end
+		return &rrsig, nil
+	case TypeNSEC:
+		var nsec NSEC
+		if nsec.NextName, readErr = u.name(); readErr != nil {
+			return nil, readErr
+		}
+		if u.off > end {
+			return nil, errors.New("Next name exceeds record")
+		}
+		if nsec.Types, readErr = unpackTypeBitmap(u.buf[u.off:end]); readErr != nil {
+			return nil, readErr
+		}
+		u.off = end
+		return &nsec, nil
+	case TypeDNSKEY:
+		if end-u.off < 4 {
+			return nil, errors.New("Record is too short")
+		}
+		dnskey := DNSKEY{
+			Flags:     binary.BigEndian.Uint16(u.buf[u.off:]),
+			Protocol:  u.buf[u.off+2],
+			Algorithm: u.buf[u.off+3],
+			PublicKey: append([]byte{}, u.buf[u.off+4:end]...),
+		}
+		u.off = end
+		return &dnskey, nil
+	}
+
+	// Not a type we know in detail, keep it in the generic notation of RFC 3597
+	raw := u.buf[u.off:end]
+	u.off = end
+	return &Text{
+		Value: fmt.Sprintf("\\# %d %s", len(raw), hex.EncodeToString(raw)),
+	}, nil
+}
+
+// Converts a list of record types into the window bitmap format used by NSEC records
+func packTypeBitmap(types []uint16) []byte {
+	// Collect the bitmaps of all 256 windows first, and only write the used ones afterwards
+	var windows [256][32]byte
+	var lengths [256]int
+	for _, t := range types {
+		window := t >> 8
+		octet := int(t&0xFF) / 8
+		windows[window][octet] |= 0x80 >> (t & 0x7)
+		if octet+1 > lengths[window] {
+			lengths[window] = octet + 1
+		}
+	}
+
+	var bitmap []byte
+	for window, length := range lengths {
+		if length > 0 {
+			bitmap = append(bitmap, byte(window), byte(length))
+			bitmap = append(bitmap, windows[window][:length]...)
+		}
+	}
+	return bitmap
+}
+
+// Parses a list of record types from the window bitmap format used by NSEC records
+func unpackTypeBitmap(bitmap []byte) ([]uint16, error) {
+	var types []uint16
+	for len(bitmap) > 0 {
+		if len(bitmap) < 2 {
+			return nil, errors.New("Type bitmap is truncated")
+		}
+		window := uint16(bitmap[0])
+		length := int(bitmap[1])
+		if length == 0 || length > 32 || len(bitmap) < 2+length {
+			return nil, errors.New("Invalid type bitmap")
+		}
+		for octet, bits := range bitmap[2 : 2+length] {
+			for bit := 0; bit < 8; bit++ {
+				if bits&(0x80>>uint(bit)) != 0 {
+					types = append(types, window<<8|uint16(octet*8+bit))
+				}
+			}
+		}
+		bitmap = bitmap[2+length:]
+	}
+	return types, nil
+}
+
+// Splits the given name into its labels, resolving escape sequences
+func splitName(name string) ([]string, error) {
+	name = Fqdn(name)
+	if name == "." {
+		return nil, nil
+	}
+
+	var labels []string
+	var label []byte
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c == '\\' && i+1 < len(name) {
+			// Escaped character, either as "\X" or as "\DDD"
+			if i+3 < len(name) && isDigit(name[i+1]) && isDigit(name[i+2]) && isDigit(name[i+3]) {
+				value, _ := strconv.Atoi(name[i+1 : i+4])
+				if value > 255 {
+					return nil, errors.New(fmt.Sprintf("Invalid escape sequence in name '%s'", name))
+				}
+				label = append(label, byte(value))
+				i += 3
+			} else {
+				label = append(label, name[i+1])
+				i++
+			}
+			continue
+		}
+
+		if c == '.' {
+			if len(label) == 0 {
+				return nil, errors.New(fmt.Sprintf("Empty label in name '%s'", name))
+			}
+			if len(label) > 63 {
+				return nil, errors.New(fmt.Sprintf("Label too long in name '%s'", name))
+			}
+			labels = append(labels, string(label))
+			label = nil
+			continue
+		}
+		label = append(label, c)
+	}
+
+	return labels, nil
+}
+
+// Converts a label from the wire format into presentation format, escaping special characters
+func escapeLabel(raw []byte) string {
+	var label strings.Builder
+	for _, c := range raw {
+		if c == '.' || c == '\\' || c == '"' || c == '(' || c == ')' || c == ';' || c == '@' || c == '$' {
+			label.WriteByte('\\')
+			label.WriteByte(c)
+		} else if c <= ' ' || c >= 0x7F {
+			label.WriteString(fmt.Sprintf("\\%03d", c))
+		} else {
+			label.WriteByte(c)
+		}
+	}
+	return label.String()
+}
+
+// Parses data in the generic notation of RFC 3597, "\# <length> <hex data>"
+func parseGenericRData(value string) ([]byte, error) {
+	fields := strings.Fields(value)
+	if len(fields) < 2 || fields[0] != "\\#" {
+		return nil, errors.New("Not in generic notation")
+	}
+	length, atoiErr := strconv.Atoi(fields[1])
+	if atoiErr != nil {
+		return nil, errors.New(fmt.Sprintf("Invalid length '%s'", fields[1]))
+	}
+	raw, hexErr := hex.DecodeString(strings.Join(fields[2:], ""))
+	if hexErr != nil {
+		return nil, hexErr
+	}
+	if len(raw) != length {
+		return nil, errors.New("Length doesn't match data")
+	}
+	return raw, nil
+}
+
+// Converts ASCII letters to lower case, leaving all other bytes untouched
+func lowerASCII(s string) string {
+	lower := []byte(s)
+	for i, c := range lower {
+		if c >= 'A' && c <= 'Z' {
+			lower[i] = c + 'a' - 'A'
+		}
+	}
+	return string(lower)
+}
+
+// Returns the mnemonic of the given response code
+func RcodeToString(rcode uint8) string {
+	if name, ok := rcodeNames[rcode]; ok {
+		return name
+	}
+	return fmt.Sprintf("RCODE%d", rcode)
+}
+
+// Checks if the given byte is an ASCII digit
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,205 @@
+package dns
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"testing"
+)
+
+// Returns a response carrying records of all types known to this package, and one it doesn't know
+func testResponse() *Message {
+	response := NewResponse(NewQuery(0x1234, "fib.mxc.example.", TypeMX))
+	response.Authoritative = true
+	response.Answers = []RR{
+		{Name: "fib.mxc.example.", TTL: 300, Class: ClassINET, Type: TypeMX, Data: &MX{Preference: 0, Exchange: "push-1.mexico.invalid."}},
+		{Name: "fib.mxc.example.", TTL: 300, Class: ClassINET, Type: TypeMX, Data: &MX{Preference: 1, Exchange: "dup.mexico.invalid."}},
+		{Name: "fib.mxc.example.", TTL: 300, Class: ClassINET, Type: TypeTXT, Data: &TXT{Strings: []string{"hello", "world"}}},
+		{Name: "Alias.mxc.example.", TTL: 60, Class: ClassINET, Type: TypeCNAME, Data: &CNAME{Target: "fib.mxc.example."}},
+		{Name: "fib.mxc.example.", TTL: 300, Class: ClassINET, Type: TypeRRSIG, Data: &RRSIG{
+			TypeCovered: TypeMX,
+			Algorithm:   15,
+			Labels:      3,
+			OriginalTTL: 300,
+			Expiration:  1700000000,
+			Inception:   1600000000,
+			KeyTag:      6231,
+			SignerName:  "mxc.example.",
+			Signature:   []byte{1, 2, 3, 4},
+		}},
+		{Name: "fib.mxc.example.", TTL: 300, Class: ClassINET, Type: TypeNSEC, Data: &NSEC{NextName: "lib.mxc.example.", Types: []uint16{TypeMX, TypeTXT, TypeRRSIG, TypeNSEC}}},
+		{Name: "fib.mxc.example.", TTL: 300, Class: ClassINET, Type: 65280, Data: &Text{Value: "\\# 3 abcdef"}},
+	}
+	response.Authority = []RR{
+		{Name: "mxc.example.", TTL: 3600, Class: ClassINET, Type: TypeSOA, Data: &SOA{MName: "ns.mxc.example.", RName: "mexico.mxc.example.", Serial: 2026101709, Refresh: 3600, Retry: 600, Expire: 86400, Minimum: 300}},
+		{Name: "mxc.example.", TTL: 3600, Class: ClassINET, Type: TypeNS, Data: &NS{Host: "ns.mxc.example."}},
+		{Name: "mxc.example.", TTL: 3600, Class: ClassINET, Type: TypeDS, Data: &DS{KeyTag: 6231, Algorithm: 15, DigestType: 2, Digest: []byte{0xde, 0xad, 0xbe, 0xef}}},
+		{Name: "mxc.example.", TTL: 3600, Class: ClassINET, Type: TypeDNSKEY, Data: &DNSKEY{Flags: 257, Protocol: 3, Algorithm: 15, PublicKey: []byte{5, 6, 7, 8}}},
+	}
+	response.Additional = []RR{
+		{Name: "ns.mxc.example.", TTL: 3600, Class: ClassINET, Type: TypeA, Data: &A{IP: net.IPv4(192, 0, 2, 53).To4()}},
+		{Name: "ns.mxc.example.", TTL: 3600, Class: ClassINET, Type: TypeAAAA, Data: &AAAA{IP: net.ParseIP("2001:db8::53")}},
+	}
+	return response
+}
+
+func TestPackUnpackRoundTrip(t *testing.T) {
+	message := testResponse()
+	packed, packErr := message.Pack()
+	if packErr != nil {
+		t.Fatalf("Pack: %s", packErr.Error())
+	}
+	unpacked, unpackErr := Unpack(packed)
+	if unpackErr != nil {
+		t.Fatalf("Unpack: %s", unpackErr.Error())
+	}
+	if !reflect.DeepEqual(unpacked, message) {
+		t.Errorf("Round trip changed the message:\ngot  %+v\nwant %+v", unpacked, message)
+	}
+	// Packing again gives the very same bytes
+	repacked, repackErr := unpacked.Pack()
+	if repackErr != nil {
+		t.Fatalf("Pack after Unpack: %s", repackErr.Error())
+	}
+	if !bytes.Equal(repacked, packed) {
+		t.Errorf("Packing the unpacked message gave different bytes")
+	}
+}
+
+func TestPackUnpackEDNS0(t *testing.T) {
+	query := NewQuery(1, "fib.mxc.example.", TypeMX)
+	query.SetEDNS0(DefaultEDNSSize)
+	query.SetDNSSECOK(true)
+
+	packed, packErr := query.Pack()
+	if packErr != nil {
+		t.Fatalf("Pack: %s", packErr.Error())
+	}
+	unpacked, unpackErr := Unpack(packed)
+	if unpackErr != nil {
+		t.Fatalf("Unpack: %s", unpackErr.Error())
+	}
+	if unpacked.UDPSize() != DefaultEDNSSize || !unpacked.DNSSECOK() {
+		t.Errorf("Round trip lost EDNS0: UDP size %d, DO %t", unpacked.UDPSize(), unpacked.DNSSECOK())
+	}
+}
+
+func TestPackCompressesNames(t *testing.T) {
+	query := NewQuery(1, "fib.mxc.example.", TypeMX)
+	response := NewResponse(query)
+	response.Answers = []RR{
+		{Name: "fib.mxc.example.", TTL: 300, Class: ClassINET, Type: TypeMX, Data: &MX{Preference: 0, Exchange: "push-1.mexico.invalid."}},
+	}
+
+	packed, packErr := response.Pack()
+	if packErr != nil {
+		t.Fatalf("Pack: %s", packErr.Error())
+	}
+
+	// The owner of the answer points to the name of the question, right behind the header
+	answer := headerLength + len("\x03fib\x03mxc\x07example\x00") + 4
+	if !bytes.Equal(packed[answer:answer+2], []byte{0xC0, headerLength}) {
+		t.Errorf("Owner name of the answer isn't compressed: % x", packed[answer:answer+2])
+	}
+
+	// Names compare regardless of case when compressing, so the spelling of the first one wins
+	response.Answers[0].Name = "FIB.mxc.example."
+	packed, _ = response.Pack()
+	if !bytes.Equal(packed[answer:answer+2], []byte{0xC0, headerLength}) {
+		t.Errorf("Owner name differing in case isn't compressed: % x", packed[answer:answer+2])
+	}
+}
+
+func TestUnpackMalformed(t *testing.T) {
+	// A header announcing a single question, followed by the given bytes
+	withQuestion := func(question ...byte) []byte {
+		return append([]byte{0, 1, 0x81, 0, 0, 1, 0, 0, 0, 0, 0, 0}, question...)
+	}
+	// A header announcing a single answer, followed by the given bytes
+	withAnswer := func(answer ...byte) []byte {
+		return append([]byte{0, 1, 0x81, 0, 0, 0, 0, 1, 0, 0, 0, 0}, answer...)
+	}
+
+	tests := []struct {
+		name string
+		buf  []byte
+	}{
+		{"empty message", []byte{}},
+		{"short header", []byte{0, 1, 0x81, 0, 0}},
+		{"missing question", withQuestion()},
+		{"label exceeding message", withQuestion(5, 'a', 'b')},
+		{"unterminated name", withQuestion(3, 'f', 'i', 'b')},
+		{"missing question type", withQuestion(3, 'f', 'i', 'b', 0, 0)},
+		{"pointer to itself", withQuestion(0xC0, 12, 0, 15, 0, 1)},
+		{"pointers to each other", withQuestion(0xC0, 14, 0xC0, 12, 0, 15, 0, 1)},
+		{"pointer beyond message", withQuestion(0xC0, 0xFF, 0, 15, 0, 1)},
+		{"truncated pointer", withQuestion(3, 'f', 'i', 'b', 0xC0)},
+		{"reserved label type", withQuestion(0x40, 'a', 0, 0, 15, 0, 1)},
+		{"data exceeding message", withAnswer(0, 0, 1, 0, 1, 0, 0, 0, 60, 0, 4, 192, 0)},
+		{"wrong address length", withAnswer(0, 0, 1, 0, 1, 0, 0, 0, 60, 0, 3, 192, 0, 2)},
+		{"name exceeding data", withAnswer(0, 0, 5, 0, 1, 0, 0, 0, 60, 0, 1, 3, 'f', 'i', 'b', 0)},
+		{"character string exceeding data", withAnswer(0, 0, 16, 0, 1, 0, 0, 0, 60, 0, 2, 5, 'a')},
+		{"short DS record", withAnswer(0, 0, 43, 0, 1, 0, 0, 0, 60, 0, 2, 0, 1)},
+		{"short RRSIG record", withAnswer(0, 0, 46, 0, 1, 0, 0, 0, 60, 0, 4, 0, 15, 15, 3)},
+	}
+
+	for _, test := range tests {
+		if _, unpackErr := Unpack(test.buf); unpackErr == nil {
+			t.Errorf("%s: Unpack succeeded on % x", test.name, test.buf)
+		}
+	}
+}
+
+func TestUnpackFollowsPointerChains(t *testing.T) {
+	// The question points to "fib", which points to "mxc", which points to "example"
+	buf := []byte{0, 1, 0x81, 0, 0, 1, 0, 0, 0, 0, 0, 0,
+		0xC0, 33, 0, 15, 0, 1,
+		7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 0,
+		3, 'm', 'x', 'c', 0xC0, 18,
+		3, 'f', 'i', 'b', 0xC0, 27,
+	}
+
+	message, unpackErr := Unpack(buf)
+	if unpackErr != nil {
+		t.Fatalf("Unpack: %s", unpackErr.Error())
+	}
+	if len(message.Questions) != 1 || message.Questions[0].Name != "fib.mxc.example." || message.Questions[0].Type != TypeMX {
+		t.Errorf("Got questions %+v, want fib.mxc.example. MX", message.Questions)
+	}
+}
+
+func TestUnpackTruncatedMessages(t *testing.T) {
+	packed, packErr := testResponse().Pack()
+	if packErr != nil {
+		t.Fatalf("Pack: %s", packErr.Error())
+	}
+
+	// Every prefix of a valid message is missing some part of it
+	for length := 0; length < len(packed); length++ {
+		if _, unpackErr := Unpack(packed[:length]); unpackErr == nil {
+			t.Errorf("Unpack succeeded on the first %d of %d bytes", length, len(packed))
+		}
+	}
+}
+
+func TestPackInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		rr   RR
+	}{
+		{"long label", RR{Name: "this-label-is-far-too-long-to-fit-into-the-sixty-three-bytes-of-a-label.example.", Class: ClassINET, Type: TypeNS, Data: &NS{Host: "ns.example."}}},
+		{"empty label", RR{Name: "fib..example.", Class: ClassINET, Type: TypeNS, Data: &NS{Host: "ns.example."}}},
+		{"long character string", RR{Name: "fib.example.", Class: ClassINET, Type: TypeTXT, Data: &TXT{Strings: []string{string(make([]byte, 256))}}}},
+		{"long label in data", RR{Name: "fib.example.", Class: ClassINET, Type: TypeCNAME, Data: &CNAME{Target: "this-label-is-far-too-long-to-fit-into-the-sixty-three-bytes-of-a-label.example."}}},
+		{"unknown data", RR{Name: "fib.example.", Class: ClassINET, Type: 65280, Data: &Text{Value: "not generic"}}},
+	}
+
+	for _, test := range tests {
+		message := Message{
+			Answers: []RR{test.rr},
+		}
+		if _, packErr := message.Pack(); packErr == nil {
+			t.Errorf("%s: Pack succeeded", test.name)
+		}
+	}
+}
@@ -0,0 +1,338 @@
+package dns
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Record types known to this package
+const (
+	TypeA      uint16 = 1
+	TypeNS     uint16 = 2
+	TypeCNAME  uint16 = 5
+	TypeSOA    uint16 = 6
+	TypePTR    uint16 = 12
+	TypeMX     uint16 = 15
+	TypeTXT    uint16 = 16
+	TypeAAAA   uint16 = 28
+	TypeOPT    uint16 = 41
+	TypeDS     uint16 = 43
+	TypeRRSIG  uint16 = 46
+	TypeNSEC   uint16 = 47
+	TypeDNSKEY uint16 = 48
+	TypeIXFR   uint16 = 251
+	TypeAXFR   uint16 = 252
+	TypeANY    uint16 = 255
+)
+
+// Record classes known to this package
+const (
+	ClassINET uint16 = 1
+	ClassANY  uint16 = 255
+)
+
+var (
+	// Mapping of record type numbers to their mnemonics, as used in zonefiles
+	typeNames = map[uint16]string{
+		TypeA:      "A",
+		TypeNS:     "NS",
+		TypeCNAME:  "CNAME",
+		TypeSOA:    "SOA",
+		TypePTR:    "PTR",
+		TypeMX:     "MX",
+		TypeTXT:    "TXT",
+		TypeAAAA:   "AAAA",
+		TypeOPT:    "OPT",
+		TypeDS:     "DS",
+		TypeRRSIG:  "RRSIG",
+		TypeNSEC:   "NSEC",
+		TypeDNSKEY: "DNSKEY",
+		TypeIXFR:   "IXFR",
+		TypeAXFR:   "AXFR",
+		TypeANY:    "ANY",
+	}
+
+	// Mapping of record class numbers to their mnemonics, as used in zonefiles
+	classNames = map[uint16]string{
+		ClassINET: "IN",
+		ClassANY:  "ANY",
+	}
+)
+
+// A single resource record, consisting of the common header fields and the type-specific data
+type RR struct {
+	Name  string
+	TTL   uint32
+	Class uint16
+	Type  uint16
+	Data  RData
+}
+
+// The type-specific part of a resource record
+type RData interface {
+	String() string
+}
+
+// Data of a MX record
+type MX struct {
+	Preference uint16
+	Exchange   string
+}
+
+// Data of a SOA record
+type SOA struct {
+	MName   string
+	RName   string
+	Serial  uint32
+	Refresh uint32
+	Retry   uint32
+	Expire  uint32
+	Minimum uint32
+}
+
+// Data of a NS record
+type NS struct {
+	Host string
+}
+
+// Data of a CNAME record
+type CNAME struct {
+	Target string
+}
+
+// Data of an A record
+type A struct {
+	IP net.IP
+}
+
+// Data of an AAAA record
+type AAAA struct {
+	IP net.IP
+}
+
+// Data of a TXT record, consisting of one or more character strings
+type TXT struct {
+	Strings []string
+}
+
+// Data of the EDNS0 OPT pseudo-record. The options are kept in wire format.
+type OPT struct {
+	Options []byte
+}
+
+// Data of a DS record, referring to a DNSKEY of the delegated zone by its digest
+type DS struct {
+	KeyTag     uint16
+	Algorithm  uint8
+	DigestType uint8
+	Digest     []byte
+}
+
+// Data of a RRSIG record, the signature of a RRset
+type RRSIG struct {
+	TypeCovered uint16
+	Algorithm   uint8
+	Labels      uint8
+	OriginalTTL uint32
+	Expiration  uint32
+	Inception   uint32
+	KeyTag      uint16
+	SignerName  string
+	Signature   []byte
+}
+
+// Data of a NSEC record, proving the non-existence of names and types by pointing to the next name of the zone
+type NSEC struct {
+	NextName string
+	Types    []uint16
+}
+
+// Data of a DNSKEY record, a public key of a zone
+type DNSKEY struct {
+	Flags     uint16
+	Protocol  uint8
+	Algorithm uint8
+	PublicKey []byte
+}
+
+// Data of a record type this package doesn't know how to handle in detail, kept in its textual presentation format
+type Text struct {
+	Value string
+}
+
+// Returns the record in zonefile presentation format
+func (r *RR) String() string {
+	return fmt.Sprintf("%s\t%d\t%s %s\t%s", r.Name, r.TTL, ClassToString(r.Class), TypeToString(r.Type), r.Data.String())
+}
+
+func (m *MX) String() string {
+	return fmt.Sprintf("%d %s", m.Preference, m.Exchange)
+}
+
+func (s *SOA) String() string {
+	return fmt.Sprintf("%s %s (%d %d %d %d %d)", s.MName, s.RName, s.Serial, s.Refresh, s.Retry, s.Expire, s.Minimum)
+}
+
+func (n *NS) String() string {
+	return n.Host
+}
+
+func (c *CNAME) String() string {
+	return c.Target
+}
+
+func (a *A) String() string {
+	return a.IP.String()
+}
+
+func (a *AAAA) String() string {
+	return a.IP.String()
+}
+
+func (t *TXT) String() string {
+	quoted := make([]string, len(t.Strings))
+	for i, s := range t.Strings {
+		var q strings.Builder
+		q.WriteByte('"')
+		for _, c := range []byte(s) {
+			if c == '"' || c == '\\' {
+				q.WriteByte('\\')
+				q.WriteByte(c)
+			} else if c < ' ' || c >= 0x7F {
+				q.WriteString(fmt.Sprintf("\\%03d", c))
+			} else {
+				q.WriteByte(c)
+			}
+		}
+		q.WriteByte('"')
+		quoted[i] = q.String()
+	}
+	return strings.Join(quoted, " ")
+}
+
+func (o *OPT) String() string {
+	return fmt.Sprintf("; EDNS0 options: %x", o.Options)
+}
+
+func (d *DS) String() string {
+	return fmt.Sprintf("%d %d %d %s", d.KeyTag, d.Algorithm, d.DigestType, strings.ToUpper(hex.EncodeToString(d.Digest)))
+}
+
+func (r *RRSIG) String() string {
+	return fmt.Sprintf("%s %d %d %d %s %s %d %s %s", TypeToString(r.TypeCovered), r.Algorithm, r.Labels, r.OriginalTTL, formatSignatureTime(r.Expiration), formatSignatureTime(r.Inception), r.KeyTag, r.SignerName, base64.StdEncoding.EncodeToString(r.Signature))
+}
+
+func (n *NSEC) String() string {
+	fields := []string{n.NextName}
+	for _, t := range n.Types {
+		fields = append(fields, TypeToString(t))
+	}
+	return strings.Join(fields, " ")
+}
+
+func (k *DNSKEY) String() string {
+	return fmt.Sprintf("%d %d %d %s", k.Flags, k.Protocol, k.Algorithm, base64.StdEncoding.EncodeToString(k.PublicKey))
+}
+
+func (t *Text) String() string {
+	return t.Value
+}
+
+// Returns the mnemonic of the given record type, or the generic "TYPEn" notation if the type is unknown
+func TypeToString(t uint16) string {
+	if name, ok := typeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("TYPE%d", t)
+}
+
+// Returns the mnemonic of the given record class, or the generic "CLASSn" notation if the class is unknown
+func ClassToString(c uint16) string {
+	if name, ok := classNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("CLASS%d", c)
+}
+
+// Returns the record type for the given mnemonic, and whether the mnemonic is known at all
+func StringToType(s string) (uint16, bool) {
+	s = strings.ToUpper(s)
+	for t, name := range typeNames {
+		if name == s {
+			return t, true
+		}
+	}
+
+	// Maybe it's written in the generic "TYPEn" notation
+	var t uint16
+	if _, scanErr := fmt.Sscanf(s, "TYPE%d", &t); scanErr == nil {
+		return t, true
+	}
+	return 0, false
+}
+
+// Returns the record class for the given mnemonic, and whether the mnemonic is known at all
+func StringToClass(s string) (uint16, bool) {
+	s = strings.ToUpper(s)
+	for c, name := range classNames {
+		if name == s {
+			return c, true
+		}
+	}
+
+	// Maybe it's written in the generic "CLASSn" notation
+	var c uint16
+	if _, scanErr := fmt.Sscanf(s, "CLASS%d", &c); scanErr == nil {
+		return c, true
+	}
+	return 0, false
+}
+
+// Removes the quotes around a character string in presentation format, and resolves escape sequences
+func unquoteString(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		s = s[1 : len(s)-1]
+	}
+
+	var unquoted []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			// Escaped character, either as "\X" or as "\DDD"
+			if i+3 < len(s) && isDigit(s[i+1]) && isDigit(s[i+2]) && isDigit(s[i+3]) {
+				value, _ := strconv.Atoi(s[i+1 : i+4])
+				unquoted = append(unquoted, byte(value))
+				i += 3
+			} else {
+				unquoted = append(unquoted, s[i+1])
+				i++
+			}
+			continue
+		}
+		unquoted = append(unquoted, s[i])
+	}
+	return string(unquoted)
+}
+
+// Appends the root dot to the given name, if it's not already there
+func Fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
+
+// Checks if both names are equal. DNS names are case-insensitive, and the root dot is optional here.
+func EqualNames(a string, b string) bool {
+	return strings.EqualFold(Fqdn(a), Fqdn(b))
+}
+
+// Checks if child is equal to or below parent in the DNS tree
+func IsSubdomain(child string, parent string) bool {
+	child = strings.ToLower(Fqdn(child))
+	parent = strings.ToLower(Fqdn(parent))
+	return parent == "." || child == parent || strings.HasSuffix(child, "."+parent)
+}
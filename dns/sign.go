@@ -0,0 +1,286 @@
+package dns
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"github.com/pkg/errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A key used to sign the records of a zone, consisting of the public DNSKEY and its private counterpart
+type SigningKey struct {
+	// The zone the key belongs to
+	Zone string
+
+	// The public part of the key, as published in the zone
+	DNSKEY DNSKEY
+
+	// The private part of the key, either an ed25519.PrivateKey or an *ecdsa.PrivateKey
+	private crypto.PrivateKey
+}
+
+// Generates a new key for the given zone. Only Ed25519 and ECDSA P-256 keys are supported.
+func GenerateKey(zone string, algorithm uint8, flags uint16) (*SigningKey, error) {
+	key := SigningKey{
+		Zone: strings.ToLower(Fqdn(zone)),
+		DNSKEY: DNSKEY{
+			Flags:     flags,
+			Protocol:  dnskeyProtocol,
+			Algorithm: algorithm,
+		},
+	}
+
+	switch algorithm {
+	case AlgorithmED25519:
+		public, private, generateErr := ed25519.GenerateKey(rand.Reader)
+		if generateErr != nil {
+			return nil, generateErr
+		}
+		key.DNSKEY.PublicKey = public
+		key.private = private
+	case AlgorithmECDSAP256SHA256:
+		private, generateErr := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if generateErr != nil {
+			return nil, generateErr
+		}
+		key.DNSKEY.PublicKey = ecdsaPublicKey(&private.PublicKey)
+		key.private = private
+	default:
+		return nil, errors.New(fmt.Sprintf("Unsupported algorithm %d for signing", algorithm))
+	}
+
+	return &key, nil
+}
+
+// Signs the RRset, with a signature valid between the given points in time
+func (k *SigningKey) Sign(rrset []RR, inception time.Time, expiration time.Time) (RR, error) {
+	if len(rrset) == 0 {
+		return RR{}, errors.New("Can't sign an empty RRset")
+	}
+
+	// Wildcards don't count as label, so they can be expanded by resolvers
+	labels, splitErr := splitName(rrset[0].Name)
+	if splitErr != nil {
+		return RR{}, splitErr
+	}
+	if len(labels) > 0 && labels[0] == "*" {
+		labels = labels[1:]
+	}
+
+	sig := RRSIG{
+		TypeCovered: rrset[0].Type,
+		Algorithm:   k.DNSKEY.Algorithm,
+		Labels:      uint8(len(labels)),
+		OriginalTTL: rrset[0].TTL,
+		Expiration:  uint32(expiration.Unix()),
+		Inception:   uint32(inception.Unix()),
+		KeyTag:      k.DNSKEY.KeyTag(),
+		SignerName:  k.Zone,
+	}
+	data, dataErr := signedData(rrset, &sig)
+	if dataErr != nil {
+		return RR{}, dataErr
+	}
+
+	switch private := k.private.(type) {
+	case ed25519.PrivateKey:
+		sig.Signature = ed25519.Sign(private, data)
+	case *ecdsa.PrivateKey:
+		// The signature consists of both integers, each padded to the size of the curve
+		digest := sha256.Sum256(data)
+		r, s, signErr := ecdsa.Sign(rand.Reader, private, digest[:])
+		if signErr != nil {
+			return RR{}, signErr
+		}
+		sig.Signature = make([]byte, 64)
+		r.FillBytes(sig.Signature[:32])
+		s.FillBytes(sig.Signature[32:])
+	default:
+		return RR{}, errors.New("Key has no private part")
+	}
+
+	return RR{
+		Name:  rrset[0].Name,
+		TTL:   rrset[0].TTL,
+		Class: rrset[0].Class,
+		Type:  TypeRRSIG,
+		Data:  &sig,
+	}, nil
+}
+
+// Signs the zone with the given keys, replacing all DNSSEC records it carried before.
+// This adds the DNSKEY records of the keys, a chain of NSEC records covering all names, and a RRSIG record for every RRset the zone is authoritative for.
+// The DNSKEY RRset is signed with all keys, all other RRsets with the keys which aren't marked as secure entry point - or all keys, if there are none.
+func SignZone(zone *Zone, keys []*SigningKey, inception time.Time, expiration time.Time) error {
+	if len(keys) == 0 {
+		return errors.New("No keys to sign the zone with")
+	}
+	soa := zone.SOA()
+	if soa == nil {
+		return errors.New("Can't sign a zone without SOA record")
+	}
+	origin := zone.Origin
+	if origin == "" {
+		origin = soa.Name
+	}
+	origin = strings.ToLower(Fqdn(origin))
+	for _, k := range keys {
+		if !EqualNames(k.Zone, origin) {
+			return errors.New(fmt.Sprintf("Key %d belongs to %s, not to %s", k.DNSKEY.KeyTag(), k.Zone, origin))
+		}
+	}
+
+	// Select the keys to sign the zone data with
+	var zoneSigningKeys []*SigningKey
+	for _, k := range keys {
+		if k.DNSKEY.Flags&FlagSEP == 0 {
+			zoneSigningKeys = append(zoneSigningKeys, k)
+		}
+	}
+	if len(zoneSigningKeys) == 0 {
+		zoneSigningKeys = keys
+	}
+
+	// Throw away old DNSSEC records, and add the keys
+	var records []RR
+	for _, r := range zone.Records {
+		if r.Type != TypeRRSIG && r.Type != TypeNSEC && r.Type != TypeDNSKEY {
+			records = append(records, r)
+		}
+	}
+	for _, k := range keys {
+		dnskey := k.DNSKEY
+		records = append(records, RR{
+			Name:  origin,
+			TTL:   soa.TTL,
+			Class: soa.Class,
+			Type:  TypeDNSKEY,
+			Data:  &dnskey,
+		})
+	}
+
+	// Find the delegations to other zones. Below them, we only have glue records, which are neither signed nor part of the NSEC chain.
+	var delegations []string
+	for _, r := range records {
+		if r.Type == TypeNS && !EqualNames(r.Name, origin) {
+			delegations = append(delegations, r.Name)
+		}
+	}
+	isGlue := func(name string) bool {
+		for _, d := range delegations {
+			if IsSubdomain(name, d) && !EqualNames(name, d) {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Group the records by name, in canonical order
+	byName := make(map[string][]RR)
+	var names []string
+	var glue []RR
+	for _, r := range records {
+		if !IsSubdomain(r.Name, origin) {
+			return errors.New(fmt.Sprintf("Record %s is not part of zone %s", r.Name, origin))
+		}
+		if isGlue(r.Name) {
+			glue = append(glue, r)
+			continue
+		}
+		name := strings.ToLower(Fqdn(r.Name))
+		if _, known := byName[name]; !known {
+			names = append(names, name)
+		}
+		byName[name] = append(byName[name], r)
+	}
+	sort.Slice(names, func(a, b int) bool {
+		return CompareNames(names[a], names[b]) < 0
+	})
+
+	// Build the signed zone name by name
+	minimum := soa.Data.(*SOA).Minimum
+	var signed []RR
+	for i, name := range names {
+		isDelegation := false
+		for _, d := range delegations {
+			isDelegation = isDelegation || EqualNames(d, name)
+		}
+
+		// The NSEC record points to the next name, and lists the types of this one
+		nsec := NSEC{
+			NextName: names[(i+1)%len(names)],
+			Types:    []uint16{TypeRRSIG, TypeNSEC},
+		}
+		rrsets := SplitRRsets(byName[name])
+		for _, rrset := range rrsets {
+			nsec.Types = append(nsec.Types, rrset[0].Type)
+		}
+		sort.Slice(nsec.Types, func(a, b int) bool {
+			return nsec.Types[a] < nsec.Types[b]
+		})
+		rrsets = append(rrsets, []RR{
+			{
+				Name:  name,
+				TTL:   minimum,
+				Class: soa.Class,
+				Type:  TypeNSEC,
+				Data:  &nsec,
+			},
+		})
+
+		for _, rrset := range rrsets {
+			signed = append(signed, rrset...)
+
+			// At delegations, only the DS records belong to us - and the NSEC record, of course
+			if isDelegation && rrset[0].Type != TypeDS && rrset[0].Type != TypeNSEC {
+				continue
+			}
+
+			signingKeys := zoneSigningKeys
+			if rrset[0].Type == TypeDNSKEY {
+				signingKeys = keys
+			}
+			for _, k := range signingKeys {
+				signature, signErr := k.Sign(rrset, inception, expiration)
+				if signErr != nil {
+					return errors.New(fmt.Sprintf("Failed to sign %s %s: %s", name, TypeToString(rrset[0].Type), signErr.Error()))
+				}
+				signed = append(signed, signature)
+			}
+		}
+	}
+
+	zone.Origin = origin
+	zone.Records = append(signed, glue...)
+	return nil
+}
+
+// Compares two names in the canonical order of DNSSEC, i.e. label by label from the right, ignoring case.
+// Returns a negative number if a comes first, a positive number if b comes first, and zero if both are equal.
+func CompareNames(a string, b string) int {
+	aLabels, _ := splitName(a)
+	bLabels, _ := splitName(b)
+	for i := 1; i <= len(aLabels) && i <= len(bLabels); i++ {
+		compared := strings.Compare(lowerASCII(aLabels[len(aLabels)-i]), lowerASCII(bLabels[len(bLabels)-i]))
+		if compared != 0 {
+			return compared
+		}
+	}
+	return len(aLabels) - len(bLabels)
+}
+
+// Converts an ECDSA public key into the format used by DNSKEY records, both coordinates padded to the size of the curve
+func ecdsaPublicKey(public *ecdsa.PublicKey) []byte {
+	size := public.Curve.Params().BitSize / 8
+	raw := make([]byte, 2*size)
+	public.X.FillBytes(raw[:size])
+	public.Y.FillBytes(raw[size:])
+	return raw
+}
@@ -0,0 +1,33 @@
+package dns
+
+import (
+	"encoding/binary"
+	"github.com/pkg/errors"
+	"io"
+)
+
+// Reads a single message from a TCP stream, where every message is prefixed with its length
+func ReadTCPMessage(reader io.Reader) ([]byte, error) {
+	var lengthBuf [2]byte
+	if _, readErr := io.ReadFull(reader, lengthBuf[:]); readErr != nil {
+		return nil, readErr
+	}
+
+	message := make([]byte, binary.BigEndian.Uint16(lengthBuf[:]))
+	if _, readErr := io.ReadFull(reader, message); readErr != nil {
+		return nil, readErr
+	}
+	return message, nil
+}
+
+// Writes a single message to a TCP stream, prefixed with its length
+func WriteTCPMessage(writer io.Writer, message []byte) error {
+	if len(message) > 0xFFFF {
+		return errors.New("Message is too big for TCP")
+	}
+
+	var lengthBuf [2]byte
+	binary.BigEndian.PutUint16(lengthBuf[:], uint16(len(message)))
+	_, writeErr := writer.Write(append(lengthBuf[:], message...))
+	return writeErr
+}
@@ -0,0 +1,228 @@
+package dns
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"net"
+	"time"
+)
+
+// The result of a zone transfer
+type Transfer struct {
+	// The serial of the zone after the transfer
+	Serial uint32
+
+	// The SOA record of the zone after the transfer
+	SOA RR
+
+	// Whether the server sent the complete zone, rather than a list of changes
+	Full bool
+
+	// All records of the zone, if the server sent the complete zone. The SOA record is the first record.
+	Records []RR
+
+	// The changes to the zone, if the server sent an incremental transfer. Empty if the zone didn't change at all.
+	Diffs []Diff
+}
+
+// A single change of a zone, from one serial to another, as sent in incremental transfers
+type Diff struct {
+	FromSerial uint32
+	ToSerial   uint32
+	Deleted    []RR
+	Added      []RR
+}
+
+// States of the parser reading the records of a zone transfer
+const (
+	transferStart = iota
+	transferFirst
+	transferFull
+	transferDeleting
+	transferAdding
+	transferDone
+)
+
+// Requests the complete zone via AXFR
+func (c *Client) TransferZone(zone string) (*Transfer, error) {
+	return c.transfer(NewQuery(randomID(), zone, TypeAXFR))
+}
+
+// Requests the changes of the zone since the given serial via IXFR.
+// Note that the server may decide to send the complete zone instead.
+func (c *Client) TransferIncremental(zone string, serial uint32) (*Transfer, error) {
+	query := NewQuery(randomID(), zone, TypeIXFR)
+	query.Authority = []RR{
+		{
+			Name:  Fqdn(zone),
+			Class: ClassINET,
+			Type:  TypeSOA,
+			Data: &SOA{
+				MName:  ".",
+				RName:  ".",
+				Serial: serial,
+			},
+		},
+	}
+	return c.transfer(query)
+}
+
+// Sends the transfer query over TCP, and reads the records of all response messages
+func (c *Client) transfer(query *Message) (*Transfer, error) {
+	if c.Server == "" {
+		return nil, errors.New("Zone transfers require a server to be specified")
+	}
+	server := WithDefaultPort(c.Server)
+
+	packed, packErr := query.Pack()
+	if packErr != nil {
+		return nil, packErr
+	}
+
+	conn, dialErr := net.DialTimeout("tcp", server, c.Timeout)
+	if dialErr != nil {
+		return nil, dialErr
+	}
+	defer conn.Close()
+
+	if c.Timeout > 0 {
+		conn.SetDeadline(time.Now().Add(c.Timeout))
+	}
+	if writeErr := WriteTCPMessage(conn, packed); writeErr != nil {
+		return nil, writeErr
+	}
+
+	// Read messages until the parser is satisfied
+	var result Transfer
+	var diff *Diff
+	state := transferStart
+	for state != transferDone {
+		if c.Timeout > 0 {
+			conn.SetDeadline(time.Now().Add(c.Timeout))
+		}
+		raw, readErr := ReadTCPMessage(conn)
+		if readErr != nil {
+			return nil, errors.New(fmt.Sprintf("Transfer from %s ended prematurely: %s", server, readErr.Error()))
+		}
+		response, unpackErr := Unpack(raw)
+		if unpackErr != nil {
+			return nil, unpackErr
+		}
+		if response.ID != query.ID || !response.Response {
+			return nil, errors.New(fmt.Sprintf("%s sent a response not matching our query", server))
+		}
+		if response.Rcode != RcodeSuccess {
+			return nil, errors.New(fmt.Sprintf("%s refused the transfer with %s", server, RcodeToString(response.Rcode)))
+		}
+
+		for _, rr := range response.Answers {
+			soa, isSOA := rr.Data.(*SOA)
+
+			switch state {
+			case transferStart:
+				// Every transfer starts with the current SOA record
+				if !isSOA {
+					return nil, errors.New(fmt.Sprintf("Transfer from %s doesn't start with a SOA record", server))
+				}
+				result.Serial = soa.Serial
+				result.SOA = rr
+				state = transferFirst
+			case transferFirst:
+				// The second record tells us if it's a complete or an incremental transfer
+				if !isSOA {
+					result.Full = true
+					result.Records = []RR{result.SOA, rr}
+					state = transferFull
+				} else if soa.Serial == result.Serial {
+					// A zone consisting of nothing but the SOA record
+					result.Full = true
+					result.Records = []RR{result.SOA}
+					state = transferDone
+				} else {
+					diff = &Diff{
+						FromSerial: soa.Serial,
+					}
+					state = transferDeleting
+				}
+			case transferFull:
+				// The complete zone ends with the SOA record again
+				if isSOA {
+					state = transferDone
+				} else {
+					result.Records = append(result.Records, rr)
+				}
+			case transferDeleting:
+				// Deleted records end with the SOA record of the new version
+				if isSOA {
+					diff.ToSerial = soa.Serial
+					state = transferAdding
+				} else {
+					diff.Deleted = append(diff.Deleted, rr)
+				}
+			case transferAdding:
+				// Added records end with either the next change, or the SOA record of the current version
+				if isSOA {
+					result.Diffs = append(result.Diffs, *diff)
+					if soa.Serial == result.Serial {
+						state = transferDone
+					} else {
+						diff = &Diff{
+							FromSerial: soa.Serial,
+						}
+						state = transferDeleting
+					}
+				} else {
+					diff.Added = append(diff.Added, rr)
+				}
+			case transferDone:
+				return nil, errors.New(fmt.Sprintf("%s sent records after the end of the transfer", server))
+			}
+		}
+
+		// An incremental transfer consisting of a single SOA record means that we're already up to date
+		if state == transferFirst && query.Questions[0].Type == TypeIXFR && len(response.Answers) == 1 {
+			state = transferDone
+		}
+	}
+
+	return &result, nil
+}
+
+// Applies the transfer to the given records of the zone, and returns the updated records.
+// For complete transfers, this simply returns the transferred records.
+func (t *Transfer) Apply(records []RR) []RR {
+	if t.Full {
+		return t.Records
+	}
+
+	// Remove the old SOA record, it's replaced by the new one afterwards
+	var updated []RR
+	for _, r := range records {
+		if r.Type != TypeSOA {
+			updated = append(updated, r)
+		}
+	}
+
+	for _, d := range t.Diffs {
+		// Remove deleted records
+		for _, deleted := range d.Deleted {
+			for i, r := range updated {
+				if EqualRecords(&r, &deleted) {
+					updated = append(updated[:i], updated[i+1:]...)
+					break
+				}
+			}
+		}
+
+		// Append added records
+		updated = append(updated, d.Added...)
+	}
+
+	// The SOA record of the new version goes first, as expected for a zone
+	return append([]RR{t.SOA}, updated...)
+}
+
+// Checks if both records have the same name, class, type and data. The TTL is ignored.
+func EqualRecords(a *RR, b *RR) bool {
+	return EqualNames(a.Name, b.Name) && a.Class == b.Class && a.Type == b.Type && a.Data.String() == b.Data.String()
+}
@@ -0,0 +1,243 @@
+package dns
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/pkg/errors"
+	"strings"
+	"time"
+)
+
+const (
+	// The trust anchor of the root zone, as published by IANA
+	rootTrustAnchor = ". IN DS 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D"
+)
+
+// Validates the DNSSEC signatures of RRsets, following the chain of trust from the signing zone up to a trust anchor
+type Validator struct {
+	// The client used to look up DNSKEY and DS records. It needs to have DNSSEC enabled.
+	Client *Client
+
+	// The DS or DNSKEY records of the zones trusted without further validation
+	Anchors []RR
+
+	// The keys already validated, per zone
+	keys map[string][]DNSKEY
+}
+
+// Returns a new validator, which uses the given client for lookups and trusts the given anchors
+func NewValidator(client *Client, anchors []RR) *Validator {
+	return &Validator{
+		Client:  client,
+		Anchors: anchors,
+		keys:    make(map[string][]DNSKEY),
+	}
+}
+
+// Returns the trust anchor of the root zone
+func RootTrustAnchors() []RR {
+	zone, _ := ParseZone(strings.NewReader(rootTrustAnchor), ".")
+	return zone.Records
+}
+
+// Validates all RRsets in the given records, using the RRSIG records among them.
+// Fails if any RRset is unsigned, or none of its signatures can be traced back to a trust anchor.
+func (v *Validator) Validate(records []RR) error {
+	for _, rrset := range SplitRRsets(records) {
+		if rrset[0].Type == TypeRRSIG {
+			continue
+		}
+		if validateErr := v.validateRRset(rrset, records); validateErr != nil {
+			return validateErr
+		}
+	}
+	return nil
+}
+
+// Validates a single RRset, using the matching signatures of the given records
+func (v *Validator) validateRRset(rrset []RR, records []RR) error {
+	owner := rrset[0].Name
+	rrType := rrset[0].Type
+
+	signed := false
+	var lastErr error
+	for i := range records {
+		sig, isRRSIG := records[i].Data.(*RRSIG)
+		if !isRRSIG || sig.TypeCovered != rrType || !EqualNames(records[i].Name, owner) {
+			continue
+		}
+		signed = true
+
+		// A DS record is signed by the parent zone, never by the zone it points to. Otherwise, we'd go round in circles.
+		if rrType == TypeDS && EqualNames(sig.SignerName, owner) {
+			lastErr = errors.New(fmt.Sprintf("DS record of %s is signed by the zone itself", owner))
+			continue
+		}
+
+		keys, keysErr := v.zoneKeys(sig.SignerName)
+		if keysErr != nil {
+			lastErr = keysErr
+			continue
+		}
+		for k := range keys {
+			if keys[k].KeyTag() != sig.KeyTag || keys[k].Algorithm != sig.Algorithm {
+				continue
+			}
+			verifyErr := VerifyRRSIG(rrset, &records[i], &keys[k], time.Now())
+			if verifyErr == nil {
+				return nil
+			}
+			lastErr = verifyErr
+		}
+		if lastErr == nil {
+			lastErr = errors.New(fmt.Sprintf("No key of %s matches the signature", sig.SignerName))
+		}
+	}
+
+	if !signed {
+		return errors.New(fmt.Sprintf("%s %s is not signed", owner, TypeToString(rrType)))
+	}
+	return errors.New(fmt.Sprintf("Failed to validate %s %s: %s", owner, TypeToString(rrType), lastErr.Error()))
+}
+
+// Returns the validated zone keys of the given zone
+func (v *Validator) zoneKeys(zone string) ([]DNSKEY, error) {
+	zone = strings.ToLower(Fqdn(zone))
+	if keys, known := v.keys[zone]; known {
+		return keys, nil
+	}
+
+	// Fetch the keys of the zone, along with their signatures
+	response, queryErr := v.Client.Query(zone, TypeDNSKEY)
+	if queryErr != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to look up DNSKEY records of %s: %s", zone, queryErr.Error()))
+	}
+	if response.Rcode != RcodeSuccess {
+		return nil, errors.New(fmt.Sprintf("Failed to look up DNSKEY records of %s: %s answered with %s", zone, response.Server, RcodeToString(response.Rcode)))
+	}
+	var dnskeys []RR
+	for _, a := range response.Answers {
+		if a.Type == TypeDNSKEY && EqualNames(a.Name, zone) {
+			dnskeys = append(dnskeys, a)
+		}
+	}
+	if len(dnskeys) == 0 {
+		return nil, errors.New(fmt.Sprintf("Zone %s has no DNSKEY records", zone))
+	}
+
+	// The keys are either trusted directly, or vouched for by the DS records of the parent zone
+	trusted := v.anchorsFor(zone)
+	if len(trusted) == 0 {
+		if zone == "." {
+			return nil, errors.New("No trust anchor for the root zone")
+		}
+		var dsErr error
+		if trusted, dsErr = v.delegation(zone); dsErr != nil {
+			return nil, dsErr
+		}
+	}
+
+	// The key set has to be signed by one of the trusted keys
+	for i := range response.Answers {
+		sig, isRRSIG := response.Answers[i].Data.(*RRSIG)
+		if !isRRSIG || sig.TypeCovered != TypeDNSKEY || !EqualNames(response.Answers[i].Name, zone) {
+			continue
+		}
+		for _, k := range dnskeys {
+			key := k.Data.(*DNSKEY)
+			if !vouchesFor(trusted, zone, key) || VerifyRRSIG(dnskeys, &response.Answers[i], key, time.Now()) != nil {
+				continue
+			}
+
+			// The key set is valid, so all zone keys in it can be used from now on
+			var keys []DNSKEY
+			for _, d := range dnskeys {
+				if zoneKey := d.Data.(*DNSKEY); zoneKey.Flags&FlagZoneKey != 0 {
+					keys = append(keys, *zoneKey)
+				}
+			}
+			v.keys[zone] = keys
+			return keys, nil
+		}
+	}
+	return nil, errors.New(fmt.Sprintf("DNSKEY records of %s are not signed by a trusted key", zone))
+}
+
+// Returns the trust anchors for the given zone
+func (v *Validator) anchorsFor(zone string) []RR {
+	var anchors []RR
+	for _, a := range v.Anchors {
+		if (a.Type == TypeDS || a.Type == TypeDNSKEY) && EqualNames(a.Name, zone) {
+			anchors = append(anchors, a)
+		}
+	}
+	return anchors
+}
+
+// Looks up and validates the DS records of the zone, which are part of its parent zone
+func (v *Validator) delegation(zone string) ([]RR, error) {
+	response, queryErr := v.Client.Query(zone, TypeDS)
+	if queryErr != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to look up DS records of %s: %s", zone, queryErr.Error()))
+	}
+	if response.Rcode != RcodeSuccess {
+		return nil, errors.New(fmt.Sprintf("Failed to look up DS records of %s: %s answered with %s", zone, response.Server, RcodeToString(response.Rcode)))
+	}
+
+	var records []RR
+	hasDS := false
+	for _, a := range response.Answers {
+		if EqualNames(a.Name, zone) && (a.Type == TypeDS || a.Type == TypeRRSIG) {
+			records = append(records, a)
+			hasDS = hasDS || a.Type == TypeDS
+		}
+	}
+	if !hasDS {
+		return nil, errors.New(fmt.Sprintf("Zone %s is not signed, as its parent zone has no DS records for it", zone))
+	}
+
+	if validateErr := v.Validate(records); validateErr != nil {
+		return nil, validateErr
+	}
+	return records, nil
+}
+
+// Checks if any of the trusted DS or DNSKEY records refers to the given key of the zone
+func vouchesFor(trusted []RR, zone string, key *DNSKEY) bool {
+	for _, t := range trusted {
+		switch anchor := t.Data.(type) {
+		case *DNSKEY:
+			if anchor.Flags == key.Flags && anchor.Protocol == key.Protocol && anchor.Algorithm == key.Algorithm && bytes.Equal(anchor.PublicKey, key.PublicKey) {
+				return true
+			}
+		case *DS:
+			if anchor.KeyTag != key.KeyTag() || anchor.Algorithm != key.Algorithm {
+				continue
+			}
+			ds, dsErr := key.ToDS(zone, anchor.DigestType)
+			if dsErr == nil && bytes.Equal(ds.Digest, anchor.Digest) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Splits the records up into RRsets, i.e. groups of records with the same name, class and type, keeping their order
+func SplitRRsets(records []RR) [][]RR {
+	var rrsets [][]RR
+	for _, r := range records {
+		found := false
+		for i, set := range rrsets {
+			if EqualNames(set[0].Name, r.Name) && set[0].Class == r.Class && set[0].Type == r.Type {
+				rrsets[i] = append(rrsets[i], r)
+				found = true
+				break
+			}
+		}
+		if !found {
+			rrsets = append(rrsets, []RR{r})
+		}
+	}
+	return rrsets
+}
@@ -0,0 +1,222 @@
+package dns
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	// The parent zone, delegating mxc.example. to the zone of the program
+	parentFixture = `$ORIGIN example.
+$TTL 3600
+@	IN	SOA	ns.example. hostmaster.example. 1 3600 600 86400 300
+@	IN	NS	ns.example.
+mxc	IN	NS	ns.example.
+`
+
+	// The zone holding the program fib.mxc.example.
+	programFixture = `$ORIGIN mxc.example.
+$TTL 300
+@	IN	SOA	ns.example. hostmaster.example. 1 3600 600 86400 300
+@	IN	NS	ns.example.
+fib	IN	MX	0 push-1.mexico.invalid.
+fib	IN	MX	1 dup.mexico.invalid.
+fib	IN	TXT	"mexico:parts" "1"
+`
+)
+
+// Parses the zone, and fails the test if that doesn't work
+func parseFixture(t *testing.T, text string) *Zone {
+	t.Helper()
+
+	zone, parseErr := ParseZone(strings.NewReader(text), "")
+	if parseErr != nil {
+		t.Fatalf("Failed to parse fixture: %s", parseErr.Error())
+	}
+	return zone
+}
+
+// Generates a key for the zone, and fails the test if that doesn't work
+func generateFixtureKey(t *testing.T, zone string) *SigningKey {
+	t.Helper()
+
+	key, generateErr := GenerateKey(zone, AlgorithmED25519, FlagZoneKey|FlagSEP)
+	if generateErr != nil {
+		t.Fatalf("Failed to generate key: %s", generateErr.Error())
+	}
+	return key
+}
+
+// Answers queries with the matching records of the given zones, and their signatures
+func serveZones(t *testing.T, zones ...*Zone) string {
+	return serveUDP(t, func(query *Message) []*Message {
+		response := NewResponse(query)
+		response.Authoritative = true
+		question := query.Questions[0]
+		for _, zone := range zones {
+			for _, r := range zone.Records {
+				if !EqualNames(r.Name, question.Name) {
+					continue
+				}
+				if sig, isRRSIG := r.Data.(*RRSIG); r.Type == question.Type || (isRRSIG && sig.TypeCovered == question.Type) {
+					response.Answers = append(response.Answers, r)
+				}
+			}
+		}
+		return []*Message{response}
+	})
+}
+
+// Returns a function replacing the signature of the MX records with one valid in the given period
+func resignMX(t *testing.T, inception time.Time, expiration time.Time) func(key *SigningKey, records []RR) []RR {
+	return func(key *SigningKey, records []RR) []RR {
+		var mx, others []RR
+		for _, r := range records {
+			if sig, isRRSIG := r.Data.(*RRSIG); r.Type == TypeMX {
+				mx = append(mx, r)
+			} else if !isRRSIG || sig.TypeCovered != TypeMX {
+				others = append(others, r)
+			}
+		}
+		signature, signErr := key.Sign(mx, inception, expiration)
+		if signErr != nil {
+			t.Fatalf("Sign: %s", signErr.Error())
+		}
+		return append(append(mx, signature), others...)
+	}
+}
+
+func TestValidator(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name string
+
+		// Changes the DS record of the zone of the program before the parent zone is signed
+		ds func(ds *DS)
+
+		// Changes the records of the program before they are validated, using the key of its zone if required
+		records func(key *SigningKey, records []RR) []RR
+
+		// Part of the expected error, or empty if validation has to succeed
+		want string
+	}{
+		{
+			name: "valid chain",
+		},
+		{
+			name:    "expired signature",
+			records: resignMX(t, now.Add(-2*time.Hour), now.Add(-time.Hour)),
+			want:    "Signature of fib.mxc.example. MX expired at",
+		},
+		{
+			name:    "signature not valid yet",
+			records: resignMX(t, now.Add(time.Hour), now.Add(2*time.Hour)),
+			want:    "Signature of fib.mxc.example. MX is not valid before",
+		},
+		{
+			name: "wrong key tag",
+			records: func(key *SigningKey, records []RR) []RR {
+				for _, r := range records {
+					if sig, isRRSIG := r.Data.(*RRSIG); isRRSIG && sig.TypeCovered == TypeMX {
+						sig.KeyTag++
+					}
+				}
+				return records
+			},
+			want: "No key of mxc.example. matches the signature",
+		},
+		{
+			name: "wrong algorithm",
+			records: func(key *SigningKey, records []RR) []RR {
+				for _, r := range records {
+					if sig, isRRSIG := r.Data.(*RRSIG); isRRSIG && sig.TypeCovered == TypeMX {
+						sig.Algorithm = AlgorithmECDSAP256SHA256
+					}
+				}
+				return records
+			},
+			want: "No key of mxc.example. matches the signature",
+		},
+		{
+			name: "tampered MX records",
+			records: func(key *SigningKey, records []RR) []RR {
+				for _, r := range records {
+					if mx, isMX := r.Data.(*MX); isMX && mx.Preference == 1 {
+						mx.Exchange = "del.mexico.invalid."
+					}
+				}
+				return records
+			},
+			want: "Signature of fib.mxc.example. MX is invalid",
+		},
+		{
+			name: "DS digest not matching the key",
+			ds: func(ds *DS) {
+				ds.Digest[0] ^= 0xFF
+			},
+			want: "DNSKEY records of mxc.example. are not signed by a trusted key",
+		},
+		{
+			name: "missing signature",
+			records: func(key *SigningKey, records []RR) []RR {
+				var unsigned []RR
+				for _, r := range records {
+					if sig, isRRSIG := r.Data.(*RRSIG); !isRRSIG || sig.TypeCovered != TypeMX {
+						unsigned = append(unsigned, r)
+					}
+				}
+				return unsigned
+			},
+			want: "fib.mxc.example. MX is not signed",
+		},
+	}
+
+	for _, test := range tests {
+		// Sign the zone of the program, and refer to its key from the parent zone
+		program := parseFixture(t, programFixture)
+		programKey := generateFixtureKey(t, "mxc.example.")
+		if signErr := SignZone(program, []*SigningKey{programKey}, now.Add(-time.Hour), now.Add(time.Hour)); signErr != nil {
+			t.Fatalf("%s: Failed to sign zone of the program: %s", test.name, signErr.Error())
+		}
+		ds, dsErr := programKey.DNSKEY.ToDS("mxc.example.", DigestSHA256)
+		if dsErr != nil {
+			t.Fatalf("%s: ToDS: %s", test.name, dsErr.Error())
+		}
+		if test.ds != nil {
+			test.ds(ds)
+		}
+
+		// The parent zone is always signed properly, and serves as trust anchor
+		parent := parseFixture(t, parentFixture)
+		parent.Records = append(parent.Records, RR{Name: "mxc.example.", TTL: 3600, Class: ClassINET, Type: TypeDS, Data: ds})
+		parentKey := generateFixtureKey(t, "example.")
+		if signErr := SignZone(parent, []*SigningKey{parentKey}, now.Add(-time.Hour), now.Add(time.Hour)); signErr != nil {
+			t.Fatalf("%s: Failed to sign parent zone: %s", test.name, signErr.Error())
+		}
+		anchor, anchorErr := parentKey.DNSKEY.ToDS("example.", DigestSHA256)
+		if anchorErr != nil {
+			t.Fatalf("%s: ToDS: %s", test.name, anchorErr.Error())
+		}
+
+		validator := NewValidator(&Client{
+			Server:  serveZones(t, parent, program),
+			Timeout: time.Second,
+			UDPSize: DefaultEDNSSize,
+			DNSSEC:  true,
+		}, []RR{
+			{Name: "example.", Class: ClassINET, Type: TypeDS, Data: anchor},
+		})
+
+		records := program.Lookup("fib.mxc.example.", TypeANY)
+		if test.records != nil {
+			records = test.records(programKey, records)
+		}
+		validateErr := validator.Validate(records)
+		if test.want == "" && validateErr != nil {
+			t.Errorf("%s: Validate failed: %s", test.name, validateErr.Error())
+		} else if test.want != "" && (validateErr == nil || !strings.Contains(validateErr.Error(), test.want)) {
+			t.Errorf("%s: got error %v, want one containing %q", test.name, validateErr, test.want)
+		}
+	}
+}
@@ -0,0 +1,634 @@
+package dns
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// A parsed zonefile
+type Zone struct {
+	Origin  string
+	Records []RR
+}
+
+// A logical zonefile line, already split into its fields.
+// Note that a logical line may span multiple physical lines, if parentheses are used.
+type zoneLine struct {
+	lineNumber int
+	blankOwner bool
+	fields     []string
+}
+
+// Reads and parses the zonefile at the given path. See ParseZone() for details.
+func ReadZoneFile(path string, origin string) (*Zone, error) {
+	file, openErr := os.Open(path)
+	if openErr != nil {
+		return nil, openErr
+	}
+	defer file.Close()
+
+	return ParseZone(file, origin)
+}
+
+// Parses a zonefile in the format described in RFC 1035, section 5.
+// The given origin is used to complete relative names until a $ORIGIN directive is encountered, and may be empty.
+// If no origin was given and the zonefile doesn't set one, the owner of the first SOA record is used as origin.
+func ParseZone(reader io.Reader, origin string) (*Zone, error) {
+	lines, splitErr := splitZoneLines(reader)
+	if splitErr != nil {
+		return nil, splitErr
+	}
+
+	zone := Zone{}
+	if origin != "" {
+		origin = Fqdn(origin)
+		zone.Origin = origin
+	}
+
+	var defaultTTL uint32
+	var lastTTL uint32
+	hasDefaultTTL := false
+	hasLastTTL := false
+	lastOwner := ""
+
+	// Iterate over all logical lines, and handle directives and records
+	for _, l := range lines {
+		// Check if line is a directive
+		if strings.HasPrefix(l.fields[0], "$") && !l.blankOwner {
+			switch strings.ToUpper(l.fields[0]) {
+			case "$ORIGIN":
+				if len(l.fields) != 2 {
+					return nil, errors.New(fmt.Sprintf("Line %d: $ORIGIN expects exactly one argument", l.lineNumber))
+				}
+				newOrigin, nameErr := resolveName(l.fields[1], origin)
+				if nameErr != nil {
+					return nil, errors.New(fmt.Sprintf("Line %d: %s", l.lineNumber, nameErr.Error()))
+				}
+				origin = newOrigin
+				if zone.Origin == "" {
+					zone.Origin = origin
+				}
+			case "$TTL":
+				if len(l.fields) != 2 {
+					return nil, errors.New(fmt.Sprintf("Line %d: $TTL expects exactly one argument", l.lineNumber))
+				}
+				ttl, ttlErr := ParseTTL(l.fields[1])
+				if ttlErr != nil {
+					return nil, errors.New(fmt.Sprintf("Line %d: %s", l.lineNumber, ttlErr.Error()))
+				}
+				defaultTTL = ttl
+				hasDefaultTTL = true
+			default:
+				return nil, errors.New(fmt.Sprintf("Line %d: Unsupported directive %s", l.lineNumber, l.fields[0]))
+			}
+			continue
+		}
+
+		// It's a record. Let's start with the owner name
+		fields := l.fields
+		owner := lastOwner
+		if !l.blankOwner {
+			var nameErr error
+			owner, nameErr = resolveName(fields[0], origin)
+			if nameErr != nil {
+				return nil, errors.New(fmt.Sprintf("Line %d: %s", l.lineNumber, nameErr.Error()))
+			}
+			fields = fields[1:]
+		} else if owner == "" {
+			return nil, errors.New(fmt.Sprintf("Line %d: Record without owner name", l.lineNumber))
+		}
+		lastOwner = owner
+
+		// TTL and class are both optional, and may appear in any order
+		rr := RR{
+			Name:  owner,
+			Class: ClassINET,
+		}
+		hasTTL := false
+		hasClass := false
+		for len(fields) > 0 {
+			if !hasTTL && len(fields[0]) > 0 && unicode.IsDigit(rune(fields[0][0])) {
+				ttl, ttlErr := ParseTTL(fields[0])
+				if ttlErr != nil {
+					return nil, errors.New(fmt.Sprintf("Line %d: %s", l.lineNumber, ttlErr.Error()))
+				}
+				rr.TTL = ttl
+				hasTTL = true
+			} else if class, isClass := StringToClass(fields[0]); !hasClass && isClass {
+				rr.Class = class
+				hasClass = true
+			} else {
+				// Neither a TTL nor a class, so this must be the type
+				break
+			}
+			fields = fields[1:]
+		}
+
+		// Now the type
+		if len(fields) == 0 {
+			return nil, errors.New(fmt.Sprintf("Line %d: Record without type", l.lineNumber))
+		}
+		rrType, isType := StringToType(fields[0])
+		if !isType {
+			return nil, errors.New(fmt.Sprintf("Line %d: Unknown record type '%s'", l.lineNumber, fields[0]))
+		}
+		rr.Type = rrType
+
+		// And finally the type-specific data
+		data, dataErr := parseRData(rrType, fields[1:], origin)
+		if dataErr != nil {
+			return nil, errors.New(fmt.Sprintf("Line %d: %s", l.lineNumber, dataErr.Error()))
+		}
+		rr.Data = data
+
+		// Records without TTL get the default TTL of the zone.
+		// If there is none, the last stated TTL or, as a fallback, the SOA minimum is used.
+		if hasTTL {
+			lastTTL = rr.TTL
+			hasLastTTL = true
+		} else if hasDefaultTTL {
+			rr.TTL = defaultTTL
+		} else if hasLastTTL {
+			rr.TTL = lastTTL
+		} else if soa, isSOA := rr.Data.(*SOA); isSOA {
+			rr.TTL = soa.Minimum
+		} else if soaRR := zone.SOA(); soaRR != nil {
+			rr.TTL = soaRR.Data.(*SOA).Minimum
+		}
+
+		// Use the owner of the first SOA as origin, if none was set yet
+		if rr.Type == TypeSOA && zone.Origin == "" {
+			zone.Origin = rr.Name
+		}
+
+		zone.Records = append(zone.Records, rr)
+	}
+
+	return &zone, nil
+}
+
+// Returns the first SOA record of the zone, or nil if there is none
+func (z *Zone) SOA() *RR {
+	for i := range z.Records {
+		if z.Records[i].Type == TypeSOA {
+			return &z.Records[i]
+		}
+	}
+	return nil
+}
+
+// Returns all records of the zone with the given name and type.
+// If TypeANY is given, all records with the given name are returned.
+func (z *Zone) Lookup(name string, rrType uint16) []RR {
+	var found []RR
+	for _, r := range z.Records {
+		if EqualNames(r.Name, name) && (rrType == TypeANY || r.Type == rrType) {
+			found = append(found, r)
+		}
+	}
+	return found
+}
+
+// Checks if there is any record with the given name in the zone
+func (z *Zone) HasName(name string) bool {
+	for _, r := range z.Records {
+		if EqualNames(r.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Parses a TTL value, which may either be a plain number of seconds, or use the BIND-style units (w, d, h, m, s), e.g. "1h30m"
+func ParseTTL(s string) (uint32, error) {
+	// Check if it's a plain number
+	plain, atoiErr := strconv.ParseUint(s, 10, 32)
+	if atoiErr == nil {
+		return uint32(plain), nil
+	}
+
+	// It's not, try to parse it with units
+	var total uint64
+	var current uint64
+	hasDigits := false
+	for _, c := range strings.ToLower(s) {
+		if unicode.IsDigit(c) {
+			current = current*10 + uint64(c-'0')
+			hasDigits = true
+			continue
+		}
+
+		// Not a digit, so it must be a unit
+		if !hasDigits {
+			return 0, errors.New(fmt.Sprintf("Invalid TTL '%s'", s))
+		}
+		switch c {
+		case 'w':
+			current *= 7 * 24 * 60 * 60
+		case 'd':
+			current *= 24 * 60 * 60
+		case 'h':
+			current *= 60 * 60
+		case 'm':
+			current *= 60
+		case 's':
+		default:
+			return 0, errors.New(fmt.Sprintf("Invalid TTL '%s'", s))
+		}
+		total += current
+		current = 0
+		hasDigits = false
+	}
+	total += current
+
+	if total > 0xFFFFFFFF {
+		return 0, errors.New(fmt.Sprintf("TTL '%s' is too big", s))
+	}
+	return uint32(total), nil
+}
+
+// Parses the type-specific data of a record
+func parseRData(rrType uint16, fields []string, origin string) (RData, error) {
+	switch rrType {
+	case TypeMX:
+		if len(fields) != 2 {
+			return nil, errors.New(fmt.Sprintf("MX record expects 2 fields, got %d", len(fields)))
+		}
+		preference, atoiErr := strconv.ParseUint(fields[0], 10, 16)
+		if atoiErr != nil {
+			return nil, errors.New(fmt.Sprintf("Invalid MX preference '%s'", fields[0]))
+		}
+		exchange, nameErr := resolveName(fields[1], origin)
+		if nameErr != nil {
+			return nil, nameErr
+		}
+		return &MX{
+			Preference: uint16(preference),
+			Exchange:   exchange,
+		}, nil
+	case TypeSOA:
+		if len(fields) != 7 {
+			return nil, errors.New(fmt.Sprintf("SOA record expects 7 fields, got %d", len(fields)))
+		}
+		mname, mnameErr := resolveName(fields[0], origin)
+		if mnameErr != nil {
+			return nil, mnameErr
+		}
+		rname, rnameErr := resolveName(fields[1], origin)
+		if rnameErr != nil {
+			return nil, rnameErr
+		}
+		serial, serialErr := strconv.ParseUint(fields[2], 10, 32)
+		if serialErr != nil {
+			return nil, errors.New(fmt.Sprintf("Invalid SOA serial '%s'", fields[2]))
+		}
+
+		// The remaining values are time spans, which may use the same units as TTLs
+		var timers [4]uint32
+		for i := range timers {
+			value, ttlErr := ParseTTL(fields[3+i])
+			if ttlErr != nil {
+				return nil, ttlErr
+			}
+			timers[i] = value
+		}
+		return &SOA{
+			MName:   mname,
+			RName:   rname,
+			Serial:  uint32(serial),
+			Refresh: timers[0],
+			Retry:   timers[1],
+			Expire:  timers[2],
+			Minimum: timers[3],
+		}, nil
+	case TypeNS:
+		if len(fields) != 1 {
+			return nil, errors.New(fmt.Sprintf("NS record expects 1 field, got %d", len(fields)))
+		}
+		host, nameErr := resolveName(fields[0], origin)
+		if nameErr != nil {
+			return nil, nameErr
+		}
+		return &NS{
+			Host: host,
+		}, nil
+	case TypeCNAME:
+		if len(fields) != 1 {
+			return nil, errors.New(fmt.Sprintf("CNAME record expects 1 field, got %d", len(fields)))
+		}
+		target, nameErr := resolveName(fields[0], origin)
+		if nameErr != nil {
+			return nil, nameErr
+		}
+		return &CNAME{
+			Target: target,
+		}, nil
+	case TypeA, TypeAAAA:
+		if len(fields) != 1 {
+			return nil, errors.New(fmt.Sprintf("%s record expects 1 field, got %d", TypeToString(rrType), len(fields)))
+		}
+		ip := net.ParseIP(fields[0])
+		if rrType == TypeA && (ip == nil || ip.To4() == nil) {
+			return nil, errors.New(fmt.Sprintf("Invalid IPv4 address '%s'", fields[0]))
+		} else if rrType == TypeAAAA && (ip == nil || ip.To4() != nil) {
+			return nil, errors.New(fmt.Sprintf("Invalid IPv6 address '%s'", fields[0]))
+		}
+		if rrType == TypeA {
+			return &A{
+				IP: ip.To4(),
+			}, nil
+		}
+		return &AAAA{
+			IP: ip,
+		}, nil
+	case TypeTXT:
+		if len(fields) == 0 {
+			return nil, errors.New("TXT record expects at least 1 field")
+		}
+		var txt TXT
+		for _, f := range fields {
+			txt.Strings = append(txt.Strings, unquoteString(f))
+		}
+		return &txt, nil
+	case TypeDS:
+		if len(fields) < 4 {
+			return nil, errors.New(fmt.Sprintf("DS record expects 4 fields, got %d", len(fields)))
+		}
+		numbers, numbersErr := parseNumbers(fields[:3], []int{16, 8, 8})
+		if numbersErr != nil {
+			return nil, numbersErr
+		}
+		// Long digests may be split up into multiple fields
+		digest, hexErr := hex.DecodeString(strings.Join(fields[3:], ""))
+		if hexErr != nil {
+			return nil, errors.New("Invalid DS digest")
+		}
+		return &DS{
+			KeyTag:     uint16(numbers[0]),
+			Algorithm:  uint8(numbers[1]),
+			DigestType: uint8(numbers[2]),
+			Digest:     digest,
+		}, nil
+	case TypeRRSIG:
+		if len(fields) < 9 {
+			return nil, errors.New(fmt.Sprintf("RRSIG record expects 9 fields, got %d", len(fields)))
+		}
+		covered, typeKnown := StringToType(fields[0])
+		if !typeKnown {
+			return nil, errors.New(fmt.Sprintf("Unknown type '%s' covered by RRSIG", fields[0]))
+		}
+		numbers, numbersErr := parseNumbers(fields[1:3], []int{8, 8})
+		if numbersErr != nil {
+			return nil, numbersErr
+		}
+		originalTTL, ttlErr := ParseTTL(fields[3])
+		if ttlErr != nil {
+			return nil, ttlErr
+		}
+		expiration, expirationErr := parseSignatureTime(fields[4])
+		if expirationErr != nil {
+			return nil, expirationErr
+		}
+		inception, inceptionErr := parseSignatureTime(fields[5])
+		if inceptionErr != nil {
+			return nil, inceptionErr
+		}
+		keyTag, keyTagErr := parseNumbers(fields[6:7], []int{16})
+		if keyTagErr != nil {
+			return nil, keyTagErr
+		}
+		signer, nameErr := resolveName(fields[7], origin)
+		if nameErr != nil {
+			return nil, nameErr
+		}
+		signature, base64Err := base64.StdEncoding.DecodeString(strings.Join(fields[8:], ""))
+		if base64Err != nil {
+			return nil, errors.New("Invalid RRSIG signature")
+		}
+		return &RRSIG{
+			TypeCovered: covered,
+			Algorithm:   uint8(numbers[0]),
+			Labels:      uint8(numbers[1]),
+			OriginalTTL: originalTTL,
+			Expiration:  expiration,
+			Inception:   inception,
+			KeyTag:      uint16(keyTag[0]),
+			SignerName:  signer,
+			Signature:   signature,
+		}, nil
+	case TypeNSEC:
+		if len(fields) < 1 {
+			return nil, errors.New("NSEC record expects at least 1 field")
+		}
+		next, nameErr := resolveName(fields[0], origin)
+		if nameErr != nil {
+			return nil, nameErr
+		}
+		nsec := NSEC{
+			NextName: next,
+		}
+		for _, f := range fields[1:] {
+			t, typeKnown := StringToType(f)
+			if !typeKnown {
+				return nil, errors.New(fmt.Sprintf("Unknown type '%s' in NSEC record", f))
+			}
+			nsec.Types = append(nsec.Types, t)
+		}
+		return &nsec, nil
+	case TypeDNSKEY:
+		if len(fields) < 4 {
+			return nil, errors.New(fmt.Sprintf("DNSKEY record expects 4 fields, got %d", len(fields)))
+		}
+		numbers, numbersErr := parseNumbers(fields[:3], []int{16, 8, 8})
+		if numbersErr != nil {
+			return nil, numbersErr
+		}
+		publicKey, base64Err := base64.StdEncoding.DecodeString(strings.Join(fields[3:], ""))
+		if base64Err != nil {
+			return nil, errors.New("Invalid DNSKEY public key")
+		}
+		return &DNSKEY{
+			Flags:     uint16(numbers[0]),
+			Protocol:  uint8(numbers[1]),
+			Algorithm: uint8(numbers[2]),
+			PublicKey: publicKey,
+		}, nil
+	}
+
+	// Not a type we know in detail, just keep its textual representation
+	return &Text{
+		Value: strings.Join(fields, " "),
+	}, nil
+}
+
+// Parses the given fields as unsigned numbers, each with the given number of bits
+func parseNumbers(fields []string, bits []int) ([]uint64, error) {
+	numbers := make([]uint64, len(fields))
+	for i, f := range fields {
+		number, atoiErr := strconv.ParseUint(f, 10, bits[i])
+		if atoiErr != nil {
+			return nil, errors.New(fmt.Sprintf("Invalid number '%s'", f))
+		}
+		numbers[i] = number
+	}
+	return numbers, nil
+}
+
+// Converts the given (maybe relative) name into a FQDN, using the given origin
+func resolveName(name string, origin string) (string, error) {
+	if name == "@" {
+		if origin == "" {
+			return "", errors.New("Used '@' without an origin")
+		}
+		return origin, nil
+	}
+
+	// Check if the name is already absolute
+	if strings.HasSuffix(name, ".") && !strings.HasSuffix(name, "\\.") {
+		return name, nil
+	}
+
+	// It's relative, append the origin
+	if origin == "" {
+		return "", errors.New(fmt.Sprintf("Relative name '%s' used without an origin", name))
+	}
+	if origin == "." {
+		return name + ".", nil
+	}
+	return name + "." + origin, nil
+}
+
+// Splits the zonefile into logical lines, removing comments and resolving parentheses
+func splitZoneLines(reader io.Reader) ([]zoneLine, error) {
+	var lines []zoneLine
+	var current *zoneLine
+	var field strings.Builder
+	hasField := false
+	inQuotes := false
+	inComment := false
+	escaped := false
+	parentheses := 0
+	lineNumber := 1
+
+	// Helper to finish the field currently being read
+	endField := func() {
+		if hasField {
+			current.fields = append(current.fields, field.String())
+			field.Reset()
+			hasField = false
+		}
+	}
+
+	buffered := bufio.NewReader(reader)
+	for {
+		c, _, readErr := buffered.ReadRune()
+		if readErr == io.EOF {
+			break
+		} else if readErr != nil {
+			return nil, readErr
+		}
+
+		// Start a new logical line, if required
+		if current == nil {
+			current = &zoneLine{
+				lineNumber: lineNumber,
+				blankOwner: c == ' ' || c == '\t',
+			}
+		}
+
+		if c == '\n' {
+			inComment = false
+			lineNumber++
+			if inQuotes {
+				return nil, errors.New(fmt.Sprintf("Line %d: Unterminated quoted string", lineNumber-1))
+			}
+			if parentheses == 0 {
+				// End of the logical line
+				endField()
+				if len(current.fields) > 0 {
+					lines = append(lines, *current)
+				}
+				current = nil
+				continue
+			}
+
+			// Inside parentheses, a newline is just another separator
+			endField()
+			continue
+		}
+
+		// Ignore everything inside comments
+		if inComment {
+			continue
+		}
+
+		// Escaped characters and everything in quotes is taken literally
+		if escaped {
+			field.WriteRune(c)
+			escaped = false
+			continue
+		}
+		if c == '\\' {
+			field.WriteRune(c)
+			hasField = true
+			escaped = true
+			continue
+		}
+		if inQuotes {
+			field.WriteRune(c)
+			if c == '"' {
+				inQuotes = false
+			}
+			continue
+		}
+
+		switch c {
+		case '"':
+			field.WriteRune(c)
+			hasField = true
+			inQuotes = true
+		case ';':
+			endField()
+			inComment = true
+		case '(':
+			endField()
+			parentheses++
+		case ')':
+			endField()
+			if parentheses == 0 {
+				return nil, errors.New(fmt.Sprintf("Line %d: Unbalanced closing parenthesis", lineNumber))
+			}
+			parentheses--
+		case ' ', '\t', '\r':
+			endField()
+		default:
+			field.WriteRune(c)
+			hasField = true
+		}
+	}
+
+	// Reached the end of the file, check if everything is closed properly
+	if parentheses > 0 {
+		return nil, errors.New(fmt.Sprintf("Line %d: Unbalanced opening parenthesis", lineNumber))
+	}
+	if inQuotes {
+		return nil, errors.New(fmt.Sprintf("Line %d: Unterminated quoted string", lineNumber))
+	}
+	if current != nil {
+		endField()
+		if len(current.fields) > 0 {
+			lines = append(lines, *current)
+		}
+	}
+
+	return lines, nil
+}
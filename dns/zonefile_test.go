@@ -0,0 +1,152 @@
+package dns
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// A zonefile using relative names, directives, parentheses, comments and quoted strings
+const zonefileFixture = `; The zone of the example programs
+$ORIGIN example.
+$TTL 1h
+@	IN	SOA	ns hostmaster (
+		2026101701 ; serial
+		3600 600 86400
+		300 )
+	IN	NS	ns.example.
+ns	60	A	192.0.2.53
+fib.mxc	IN	MX	0 push-1.mexico.invalid.
+fib.mxc	MX	1 dup.mexico.invalid. ; prints nothing yet
+fib.mxc	TXT	"mexico:parts" "1"
+quoted	TXT	"semi;colon" "quote\"d" "back\\slash" "\065BC" "two words" plain
+$ORIGIN mxc.example.
+alias	300	CNAME	fib
+`
+
+func TestParseZone(t *testing.T) {
+	zone, parseErr := ParseZone(strings.NewReader(zonefileFixture), "")
+	if parseErr != nil {
+		t.Fatalf("ParseZone: %s", parseErr.Error())
+	}
+	if zone.Origin != "example." {
+		t.Errorf("Got origin %s, want example.", zone.Origin)
+	}
+
+	want := []RR{
+		{Name: "example.", TTL: 3600, Class: ClassINET, Type: TypeSOA, Data: &SOA{MName: "ns.example.", RName: "hostmaster.example.", Serial: 2026101701, Refresh: 3600, Retry: 600, Expire: 86400, Minimum: 300}},
+		{Name: "example.", TTL: 3600, Class: ClassINET, Type: TypeNS, Data: &NS{Host: "ns.example."}},
+		{Name: "ns.example.", TTL: 60, Class: ClassINET, Type: TypeA, Data: &A{IP: []byte{192, 0, 2, 53}}},
+		{Name: "fib.mxc.example.", TTL: 3600, Class: ClassINET, Type: TypeMX, Data: &MX{Preference: 0, Exchange: "push-1.mexico.invalid."}},
+		{Name: "fib.mxc.example.", TTL: 3600, Class: ClassINET, Type: TypeMX, Data: &MX{Preference: 1, Exchange: "dup.mexico.invalid."}},
+		{Name: "fib.mxc.example.", TTL: 3600, Class: ClassINET, Type: TypeTXT, Data: &TXT{Strings: []string{"mexico:parts", "1"}}},
+		{Name: "quoted.example.", TTL: 3600, Class: ClassINET, Type: TypeTXT, Data: &TXT{Strings: []string{"semi;colon", "quote\"d", "back\\slash", "ABC", "two words", "plain"}}},
+		{Name: "alias.mxc.example.", TTL: 300, Class: ClassINET, Type: TypeCNAME, Data: &CNAME{Target: "fib.mxc.example."}},
+	}
+	if len(zone.Records) != len(want) {
+		t.Fatalf("Got %d records, want %d", len(zone.Records), len(want))
+	}
+	for i := range want {
+		if !reflect.DeepEqual(zone.Records[i], want[i]) {
+			t.Errorf("Record %d: got %s, want %s", i, zone.Records[i].String(), want[i].String())
+		}
+	}
+}
+
+func TestParseZoneOrigin(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		origin string
+		want   string
+	}{
+		{"given origin", "www IN A 192.0.2.1\n", "example", "example."},
+		{"$ORIGIN directive", "$ORIGIN example.\nwww IN A 192.0.2.1\n", "", "example."},
+		{"given origin wins over $ORIGIN", "$ORIGIN other.\nwww IN A 192.0.2.1\n", "example.", "example."},
+		{"owner of the SOA record", "example. 300 IN SOA ns.example. hostmaster.example. 1 2 3 4 5\n", "", "example."},
+		{"no origin at all", "www.example. 300 IN A 192.0.2.1\n", "", ""},
+	}
+
+	for _, test := range tests {
+		zone, parseErr := ParseZone(strings.NewReader(test.text), test.origin)
+		if parseErr != nil {
+			t.Errorf("%s: ParseZone: %s", test.name, parseErr.Error())
+		} else if zone.Origin != test.want {
+			t.Errorf("%s: Got origin %q, want %q", test.name, zone.Origin, test.want)
+		}
+	}
+}
+
+func TestParseZoneTTL(t *testing.T) {
+	// Without $TTL, records inherit the last stated TTL, or the SOA minimum if there is none
+	zone, parseErr := ParseZone(strings.NewReader(`example. IN SOA ns.example. hostmaster.example. 1 2 3 4 5
+example. IN NS ns.example.
+ns.example. 60 IN A 192.0.2.53
+www.example. IN A 192.0.2.80
+`), "")
+	if parseErr != nil {
+		t.Fatalf("ParseZone: %s", parseErr.Error())
+	}
+	for i, want := range []uint32{5, 5, 60, 60} {
+		if zone.Records[i].TTL != want {
+			t.Errorf("Record %d: got TTL %d, want %d", i, zone.Records[i].TTL, want)
+		}
+	}
+
+	for text, want := range map[string]uint32{"300": 300, "1h30m": 5400, "1W": 604800, "2d12h": 216000, "90s": 90} {
+		if ttl, ttlErr := ParseTTL(text); ttlErr != nil || ttl != want {
+			t.Errorf("ParseTTL(%q) = %d, %v, want %d", text, ttl, ttlErr, want)
+		}
+	}
+}
+
+func TestParseZoneMalformed(t *testing.T) {
+	const soa = "@ IN SOA ns hostmaster 1 2 3 4 5\n"
+	tests := []struct {
+		name string
+		text string
+		line int
+	}{
+		{"unknown directive", "$INCLUDE other.zone\n", 1},
+		{"$ORIGIN without argument", "$ORIGIN\n", 1},
+		{"$TTL with two arguments", "$TTL 1h 2h\n", 1},
+		{"invalid $TTL", "$ORIGIN example.\n$TTL 1y\n", 2},
+		{"blank owner on first record", "\tIN A 192.0.2.1\n", 1},
+		{"relative name without origin", "www IN A 192.0.2.1\n", 1},
+		{"@ without origin", "@ IN A 192.0.2.1\n", 1},
+		{"record without type", "$ORIGIN example.\nwww 300 IN\n", 2},
+		{"unknown type", "$ORIGIN example.\nwww IN BOGUS 1\n", 2},
+		{"invalid TTL", "$ORIGIN example.\nwww 1x IN A 192.0.2.1\n", 2},
+		{"TTL too big", "$ORIGIN example.\nwww 99999999999 IN A 192.0.2.1\n", 2},
+		{"MX without exchange", "$ORIGIN example.\n" + soa + "fib MX 0\n", 3},
+		{"MX preference out of range", "$ORIGIN example.\n" + soa + "fib MX 65536 push-1.mexico.invalid.\n", 3},
+		{"SOA with missing fields", "$ORIGIN example.\n@ IN SOA ns hostmaster 1 2 3 4\n", 2},
+		{"SOA with invalid serial", "$ORIGIN example.\n@ IN SOA ns hostmaster x 2 3 4 5\n", 2},
+		{"invalid IPv4 address", "$ORIGIN example.\nwww IN A 2001:db8::1\n", 2},
+		{"invalid IPv6 address", "$ORIGIN example.\nwww IN AAAA 192.0.2.1\n", 2},
+		{"TXT without strings", "$ORIGIN example.\nwww IN TXT\n", 2},
+		{"invalid DS digest", "$ORIGIN example.\nwww IN DS 1 15 2 nothex\n", 2},
+		{"short RRSIG", "$ORIGIN example.\nwww IN RRSIG MX 15 2 300\n", 2},
+		{"invalid DNSKEY key", "$ORIGIN example.\nwww IN DNSKEY 257 3 15 !!!\n", 2},
+		{"unknown type in NSEC", "$ORIGIN example.\nwww IN NSEC next.example. MX BOGUS\n", 2},
+		{"unterminated quoted string", "$ORIGIN example.\n" + soa + "www TXT \"abc\nnext TXT def\n", 3},
+		{"unterminated quoted string at the end", "$ORIGIN example.\nwww TXT \"abc", 2},
+		{"unbalanced closing parenthesis", "$ORIGIN example.\nwww IN A 192.0.2.1 )\n", 2},
+		{"unbalanced opening parenthesis", "$ORIGIN example.\n" + soa + "www IN TXT ( abc\n", 4},
+	}
+
+	for _, test := range tests {
+		_, parseErr := ParseZone(strings.NewReader(test.text), "")
+		if want := fmt.Sprintf("Line %d: ", test.line); parseErr == nil || !strings.HasPrefix(parseErr.Error(), want) {
+			t.Errorf("%s: got error %v, want one starting with %q", test.name, parseErr, want)
+		}
+	}
+}
+
+func TestParseZoneTruncated(t *testing.T) {
+	// Every prefix of a valid zonefile either parses or fails with an error, but never panics
+	for length := 0; length <= len(zonefileFixture); length++ {
+		ParseZone(strings.NewReader(zonefileFixture[:length]), "")
+	}
+}
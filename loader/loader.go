@@ -0,0 +1,162 @@
+// Package loader reads compiled mexico programs off the MX and TXT records of their domain, wherever these records
+// come from - the DNS, a zonefile or a zone transfer.
+package loader
+
+import (
+	"fmt"
+	"github.com/maride/mexico/dns"
+	"github.com/maride/mexico/mexico/compiler"
+	"github.com/pkg/errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A compiled program, as found in the records of its domain
+type Program struct {
+	// The domain the program was loaded from
+	Domain string
+
+	// The code lines of all parts, sorted by line number, with the exchange of their MX record as code. Line numbers of
+	// further parts follow those of the previous parts. Imports, whether it's a library and its labels come from the
+	// TXT records.
+	compiler.Module
+
+	// The MX records of all parts, and the TXT records the metadata was read from
+	Records []dns.RR
+
+	// The number of parts the program is split into, as named by its TXT records, or 0 if unknown
+	Parts int
+}
+
+// Looks up the records of the given name and type. Returns no records, and no error, if the name doesn't exist.
+type LookupFunc func(name string, rrType uint16) ([]dns.RR, error)
+
+// Loads the program of the given domain, and all further parts of it, using the lookup function.
+// If the TXT records name the number of parts, a missing part is an error. Otherwise, the first part without code
+// ends the program.
+func Load(domain string, lookup LookupFunc) (*Program, error) {
+	program := Program{
+		Domain: dns.Fqdn(domain),
+	}
+
+	records, lookupErr := lookup(domain, dns.TypeMX)
+	if lookupErr != nil {
+		return nil, lookupErr
+	}
+	if !program.addPart(0, records) {
+		return nil, errors.New(fmt.Sprintf("No code found on domain '%s'", domain))
+	}
+
+	// Programs using libraries name them in TXT records, along with the number of parts to look for
+	metadata, lookupErr := lookup(domain, dns.TypeTXT)
+	if lookupErr != nil {
+		return nil, lookupErr
+	}
+	if metadataErr := program.addMetadata(metadata); metadataErr != nil {
+		return nil, metadataErr
+	}
+
+	for part := 1; program.Parts == 0 || part < program.Parts; part++ {
+		records, lookupErr := lookup(compiler.PartDomain(domain, part), dns.TypeMX)
+		if lookupErr != nil {
+			return nil, lookupErr
+		}
+		if !program.addPart(part, records) {
+			if program.Parts == 0 {
+				break
+			}
+			return nil, errors.New(fmt.Sprintf("Part %d of %d of the program on domain '%s' is missing", part, program.Parts, domain))
+		}
+	}
+	return &program, nil
+}
+
+// Loads the program of the given domain from the records of the zone
+func FromZone(zone *dns.Zone, domain string) (*Program, error) {
+	return Load(domain, func(name string, rrType uint16) ([]dns.RR, error) {
+		return zone.Lookup(name, rrType), nil
+	})
+}
+
+// Filters the given MX records of a part of the program for mexico records, and converts them to code lines sorted by
+// line number. Line numbers are moved behind those of the previous parts, and the exchanges are kept as they are.
+func Codelines(records []dns.RR, part int) []compiler.Codeline {
+	suffix := fmt.Sprintf(".%s.", compiler.FakeFQDN)
+
+	var code []compiler.Codeline
+	for _, r := range records {
+		mx, isMX := r.Data.(*dns.MX)
+		if isMX && strings.HasSuffix(strings.ToLower(mx.Exchange), suffix) {
+			code = append(code, compiler.Codeline{
+				Linenumber: part*compiler.PartSize + int(mx.Preference),
+				Code:       mx.Exchange,
+			})
+		}
+	}
+
+	sort.SliceStable(code, func(a, b int) bool {
+		return code[a].Linenumber < code[b].Linenumber
+	})
+	return code
+}
+
+// Adds the code of the MX records of a part to the program. Returns whether the part holds any code.
+func (p *Program) addPart(part int, records []dns.RR) bool {
+	code := Codelines(records, part)
+	if len(code) == 0 {
+		return false
+	}
+	p.Code = append(p.Code, code...)
+	p.Records = append(p.Records, records...)
+	return true
+}
+
+// Reads the imports, whether it's a library and its labels, and the number of its parts, off the TXT records of the program
+func (p *Program) addMetadata(records []dns.RR) error {
+	for _, r := range records {
+		txt, isTXT := r.Data.(*dns.TXT)
+		if !isTXT || len(txt.Strings) == 0 {
+			continue
+		}
+
+		switch txt.Strings[0] {
+		case compiler.ImportRecord:
+			if len(txt.Strings) != 3 {
+				return errors.New(fmt.Sprintf("Invalid import record of %s: %s", p.Domain, txt.String()))
+			}
+			if p.Imports == nil {
+				p.Imports = make(map[string]string)
+			}
+			p.Imports[txt.Strings[1]] = txt.Strings[2]
+		case compiler.LibraryRecord:
+			p.Library = true
+		case compiler.SymbolRecord:
+			if len(txt.Strings) != 3 {
+				return errors.New(fmt.Sprintf("Invalid symbol record of %s: %s", p.Domain, txt.String()))
+			}
+			linenumber, atoiErr := strconv.Atoi(txt.Strings[2])
+			if atoiErr != nil {
+				return errors.New(fmt.Sprintf("Invalid line number in symbol record of %s: %s", p.Domain, txt.String()))
+			}
+			if p.Symbols == nil {
+				p.Symbols = make(map[string]int)
+			}
+			p.Symbols[txt.Strings[1]] = linenumber
+		case compiler.PartsRecord:
+			if len(txt.Strings) != 2 {
+				return errors.New(fmt.Sprintf("Invalid parts record of %s: %s", p.Domain, txt.String()))
+			}
+			parts, atoiErr := strconv.Atoi(txt.Strings[1])
+			if atoiErr != nil || parts < 1 || parts > compiler.MaxParts {
+				return errors.New(fmt.Sprintf("Invalid number of parts in parts record of %s: %s", p.Domain, txt.String()))
+			}
+			p.Parts = parts
+		default:
+			// Not meant for us
+			continue
+		}
+		p.Records = append(p.Records, r)
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package loader
+
+import (
+	"github.com/maride/mexico/dns"
+	"github.com/pkg/errors"
+	"strings"
+	"testing"
+)
+
+// Returns a lookup function answering with the records of the zonefile. Names outside the zone fail to resolve.
+func zoneLookup(t *testing.T, text string) LookupFunc {
+	zone, parseErr := dns.ParseZone(strings.NewReader(text), "mxc.example.")
+	if parseErr != nil {
+		t.Fatalf("Failed to parse zone: %s", parseErr.Error())
+	}
+	return func(name string, rrType uint16) ([]dns.RR, error) {
+		if !dns.IsSubdomain(name, "mxc.example.") {
+			return nil, errors.New("Failed to resolve '" + name + "'")
+		}
+		return zone.Lookup(name, rrType), nil
+	}
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name string
+		zone string
+
+		// The line numbers of the loaded program, or the part of the expected error
+		lines []int
+		parts int
+		want  string
+	}{
+		{
+			name:  "single part",
+			zone:  "fib 300 MX 0 push-1.mexico.invalid.\nfib 300 MX 1 print.mexico.invalid.\n",
+			lines: []int{0, 1},
+		},
+		{
+			name:  "sorted by line number",
+			zone:  "fib 300 MX 7 print.mexico.invalid.\nfib 300 MX 3 push-1.mexico.invalid.\nfib 300 MX 5 mail.example.\n",
+			lines: []int{3, 7},
+		},
+		{
+			name:  "parts until the first without code",
+			zone:  "fib 300 MX 65535 push-1.mexico.invalid.\npart1.fib 300 MX 0 print.mexico.invalid.\npart3.fib 300 MX 0 print.mexico.invalid.\n",
+			lines: []int{65535, 65536},
+		},
+		{
+			name:  "parts as named",
+			zone:  "fib 300 MX 0 push-1.mexico.invalid.\nfib 300 TXT \"mexico:parts\" \"3\"\npart1.fib 300 MX 0 push-2.mexico.invalid.\npart2.fib 300 MX 5 print.mexico.invalid.\n",
+			lines: []int{0, 65536, 131077},
+			parts: 3,
+		},
+		{
+			name:  "further parts than named",
+			zone:  "fib 300 MX 0 push-1.mexico.invalid.\nfib 300 TXT \"mexico:parts\" \"1\"\npart1.fib 300 MX 0 print.mexico.invalid.\n",
+			lines: []int{0},
+			parts: 1,
+		},
+		{
+			name: "missing part",
+			zone: "fib 300 MX 0 push-1.mexico.invalid.\nfib 300 TXT \"mexico:parts\" \"3\"\npart1.fib 300 MX 0 print.mexico.invalid.\n",
+			want: "Part 2 of 3 of the program on domain 'fib.mxc.example.' is missing",
+		},
+		{
+			name: "part without mexico records",
+			zone: "fib 300 MX 0 push-1.mexico.invalid.\nfib 300 TXT \"mexico:parts\" \"2\"\npart1.fib 300 MX 0 mail.example.\n",
+			want: "Part 1 of 2 of the program on domain 'fib.mxc.example.' is missing",
+		},
+		{
+			name: "no code",
+			zone: "fib 300 MX 0 mail.example.\nfib 300 TXT \"mexico:parts\" \"1\"\n",
+			want: "No code found on domain 'fib.mxc.example.'",
+		},
+		{
+			name: "no parts",
+			zone: "fib 300 MX 0 push-1.mexico.invalid.\nfib 300 TXT \"mexico:parts\" \"0\"\n",
+			want: "Invalid number of parts in parts record of fib.mxc.example.",
+		},
+		{
+			name: "too many parts",
+			zone: "fib 300 MX 0 push-1.mexico.invalid.\nfib 300 TXT \"mexico:parts\" \"1025\"\n",
+			want: "Invalid number of parts in parts record of fib.mxc.example.",
+		},
+		{
+			name: "parts record without number",
+			zone: "fib 300 MX 0 push-1.mexico.invalid.\nfib 300 TXT \"mexico:parts\"\n",
+			want: "Invalid parts record of fib.mxc.example.",
+		},
+		{
+			name: "import record without domain",
+			zone: "fib 300 MX 0 push-1.mexico.invalid.\nfib 300 TXT \"mexico:import\" \"lib\"\n",
+			want: "Invalid import record of fib.mxc.example.",
+		},
+		{
+			name: "symbol record without line number",
+			zone: "fib 300 MX 0 push-1.mexico.invalid.\nfib 300 TXT \"mexico:symbol\" \"LOOP\" \"x\"\n",
+			want: "Invalid line number in symbol record of fib.mxc.example.",
+		},
+	}
+
+	for _, test := range tests {
+		program, loadErr := Load("fib.mxc.example.", zoneLookup(t, test.zone))
+		if test.want != "" {
+			if loadErr == nil || !strings.Contains(loadErr.Error(), test.want) {
+				t.Errorf("%s: got error %v, want one containing %q", test.name, loadErr, test.want)
+			}
+			continue
+		}
+		if loadErr != nil {
+			t.Errorf("%s: Load: %s", test.name, loadErr.Error())
+			continue
+		}
+
+		var lines []int
+		for _, c := range program.Code {
+			lines = append(lines, c.Linenumber)
+		}
+		if len(lines) != len(test.lines) {
+			t.Errorf("%s: Got lines %v, want %v", test.name, lines, test.lines)
+			continue
+		}
+		for i := range lines {
+			if lines[i] != test.lines[i] {
+				t.Errorf("%s: Got lines %v, want %v", test.name, lines, test.lines)
+				break
+			}
+		}
+		if program.Parts != test.parts {
+			t.Errorf("%s: Got %d parts, want %d", test.name, program.Parts, test.parts)
+		}
+	}
+}
+
+func TestLoadMetadata(t *testing.T) {
+	program, loadErr := Load("fib.mxc.example.", zoneLookup(t, `fib 300 MX 0 push-Lib.Square.mexico.invalid.
+fib 300 TXT "mexico:import" "Lib" "lib.mxc.example."
+fib 300 TXT "mexico:library"
+fib 300 TXT "mexico:symbol" "LOOP" "0"
+fib 300 TXT "v=spf1 -all"
+`))
+	if loadErr != nil {
+		t.Fatalf("Load: %s", loadErr.Error())
+	}
+	if program.Imports["Lib"] != "lib.mxc.example." || !program.Library || program.Symbols["LOOP"] != 0 || len(program.Symbols) != 1 {
+		t.Errorf("Got imports %v, library %t, symbols %v", program.Imports, program.Library, program.Symbols)
+	}
+	// The exchange is kept as it is, including its case
+	if program.Code[0].Code != "push-Lib.Square.mexico.invalid." {
+		t.Errorf("Got code %s", program.Code[0].Code)
+	}
+	// Only the MX records and the TXT records meant for mexico are kept
+	if len(program.Records) != 4 {
+		t.Errorf("Got %d records, want 4", len(program.Records))
+	}
+}
+
+func TestLoadLookupError(t *testing.T) {
+	// Errors of the lookup are passed through, whichever record they happen on
+	for _, failing := range []string{"fib.mxc.example./MX", "fib.mxc.example./TXT", "part1.fib.mxc.example./MX"} {
+		_, loadErr := Load("fib.mxc.example.", func(name string, rrType uint16) ([]dns.RR, error) {
+			if name+"/"+dns.TypeToString(rrType) == failing {
+				return nil, errors.New("Timeout")
+			}
+			if rrType == dns.TypeMX {
+				return []dns.RR{{Name: name, TTL: 300, Class: dns.ClassINET, Type: dns.TypeMX, Data: &dns.MX{Exchange: "print.mexico.invalid."}}}, nil
+			}
+			return []dns.RR{{Name: name, TTL: 300, Class: dns.ClassINET, Type: dns.TypeTXT, Data: &dns.TXT{Strings: []string{"mexico:parts", "2"}}}}, nil
+		})
+		if loadErr == nil || loadErr.Error() != "Timeout" {
+			t.Errorf("%s: got error %v, want Timeout", failing, loadErr)
+		}
+	}
+}
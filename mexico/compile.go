@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/maride/mexico/mexico/compiler"
+	"github.com/pkg/errors"
+	"os"
+	"strings"
+)
+
+var (
+	diagnosticsFormat *string
+	optimizeCode      *bool
+	splitParts        *bool
+	lineStart         *int
+	lineStep          *int
+	compileLibrary    *bool
+	exportSymbols     *bool
+)
+
+// Registers flags required for compiling source code
+func registerCompilerFlags() {
+	diagnosticsFormat = flag.String("diagnostics", "text", "Format to report errors and warnings of the compiler in, either 'text' (on stderr) or 'json' (on stdout)")
+	optimizeCode = flag.Bool("optimize", false, "Remove and fold instruction sequences to save MX records")
+	splitParts = flag.Bool("split", false, "Split programs with line numbers beyond 65535 into parts, on the domains part1.<domain>, part2.<domain> and so on")
+	compileLibrary = flag.Bool("library", false, "Compile a library, exporting its labels to programs which import it")
+	exportSymbols = flag.Bool("symbols", false, "Export the labels of the program in TXT records, so breakpoints can be set on them in the debugger of mexigo")
+	registerNumberingFlags()
+}
+
+// Registers flags required for numbering the lines of source code
+func registerNumberingFlags() {
+	lineStart = flag.Int("lineStart", 0, "Line number of the first instruction")
+	lineStep = flag.Int("lineStep", 1, "Distance between the line numbers of following instructions, e.g. 10 to leave room for inserting instructions later")
+}
+
+// Compiles the source code read from the given file, and reports all errors and warnings in the requested format
+func compileFile(path string, domain string) (*compiler.Module, error) {
+	lines, readErr := readFile(path)
+	if readErr != nil {
+		return nil, readErr
+	}
+	source := strings.Join(lines, "\n")
+
+	module, diagnostics := compiler.CompileWithOptions(source, compiler.Options{
+		File:     path,
+		Domain:   domain,
+		Optimize: *optimizeCode,
+		Start:    *lineStart,
+		Step:     *lineStep,
+		Split:    *splitParts,
+		Library:  *compileLibrary,
+		Symbols:  *exportSymbols,
+	})
+
+	// Report what the compiler found
+	switch *diagnosticsFormat {
+	case "text":
+		fmt.Fprint(os.Stderr, diagnostics.Format(source))
+	case "json":
+		diagnosticsJSON, jsonErr := diagnostics.JSON()
+		if jsonErr != nil {
+			return nil, jsonErr
+		}
+		fmt.Println(string(diagnosticsJSON))
+	default:
+		return nil, errors.New(fmt.Sprintf("Unknown diagnostics format '%s', please use 'text' or 'json'", *diagnosticsFormat))
+	}
+
+	if diagnostics.HasErrors() {
+		return nil, errors.New(fmt.Sprintf("Failed to compile %s, found %d errors", path, len(diagnostics.Errors())))
+	}
+	return module, nil
+}
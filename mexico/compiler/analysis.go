@@ -0,0 +1,181 @@
+package compiler
+
+// A point where the stack underflows, found while following the control flow
+type underflow struct {
+	block       *Block
+	instruction *Instruction
+	depth       int
+}
+
+// Follows the control flow of the program and tracks the depth of the stack, starting with an empty stack at the first line.
+// Calls of subroutines and instructions consuming a variable number of values aren't followed, as their effect on the
+// stack depth is not known.
+// Blocks entered with different stack depths, and loops which grow or shrink the stack on every iteration, are reported as warnings.
+// Instructions which underflow the stack are reported as errors, or as warnings if the stack depth at them isn't certain,
+// or if the program may end without passing them.
+// Jumps to unknown targets and calls are reported as well, as the stack depth can't be followed beyond them.
+func checkStack(graph *Graph, diagnostics *Diagnostics) {
+	if len(graph.Blocks) == 0 {
+		return
+	}
+
+	depths := map[*Block]int{graph.Blocks[0]: 0}
+	inconsistent := make(map[*Block]bool)
+	var underflows []underflow
+	pending := []*Block{graph.Blocks[0]}
+	for len(pending) > 0 {
+		block := pending[0]
+		pending = pending[1:]
+
+		// Run through the block, and see if the stack holds enough values for each instruction
+		depth, underflowAt, isKnown := stackDepthAfter(block, depths[block])
+		if underflowAt != nil {
+			// The program crashes here, there's no need to follow it any further
+			underflows = append(underflows, *underflowAt)
+			continue
+		}
+		if !isKnown {
+			// The stack depth can't be followed any further
+			continue
+		}
+
+		// And hand the resulting depth over to the blocks following this one
+		for _, edge := range block.Successors {
+			if edge.Kind == EdgeUnknown {
+				if jumpsIntoLibrary(block) {
+					// Libraries are only known at runtime, their effect on the stack is too
+					continue
+				}
+				jump := block.code[len(block.code)-1].Instruction
+				diagnostics.warnf(jump.Pos(), "Target of '%s' isn't a constant, the stack depth after it is unknown", jump.Name)
+				continue
+			}
+			if edge.To == nil {
+				// The program ends or returns from a subroutine here
+				continue
+			}
+			if edge.Kind == EdgeCall {
+				// Subroutines are called with different stack depths, and may leave a different one behind
+				call := block.code[len(block.code)-1].Instruction
+				diagnostics.warnf(call.Pos(), "Subroutines may leave any stack depth behind, the stack depth after '%s' is unknown", call.Name)
+				continue
+			}
+			if edge.Kind == EdgeFallthrough && endsWithCall(block) {
+				// Continues after the subroutine returned, see above
+				continue
+			}
+
+			known, isKnown := depths[edge.To]
+			if !isKnown {
+				depths[edge.To] = depth
+				pending = append(pending, edge.To)
+				continue
+			}
+			if known == depth || inconsistent[edge.To] {
+				continue
+			}
+
+			// The block is entered with different stack depths, only warn once about it
+			inconsistent[edge.To] = true
+			first := edge.To.code[0].Instruction
+			jump := block.code[len(block.code)-1].Instruction
+			if edge.To.reaches(block) {
+				if depth > known {
+					diagnostics.warnf(first.Pos(), "Stack depth grows by %d on every iteration of the loop starting here, without bound", depth-known)
+				} else {
+					diagnostics.warnf(first.Pos(), "Stack depth shrinks by %d on every iteration of the loop starting here", known-depth)
+				}
+			} else {
+				diagnostics.warnf(first.Pos(), "Inconsistent stack depth: reached with depth %d from %s, but with depth %d from elsewhere", depth, jump.Pos().String(), known)
+			}
+		}
+	}
+
+	// Stack depths after blocks with inconsistent depths are uncertain, so underflows there are only possible, not guaranteed.
+	// Neither are underflows the program may get around, e.g. by a jmpc.
+	underflowing := make(map[*Block]bool)
+	for _, u := range underflows {
+		underflowing[u.block] = true
+	}
+	for _, u := range underflows {
+		consumes, _ := stackEffect(u.instruction)
+		if isUncertain(u.block, inconsistent) {
+			diagnostics.warnf(u.instruction.Pos(), "Possible stack underflow: '%s' needs %d values on the stack, but the stack depth may be %d", u.instruction.String(), consumes, u.depth)
+		} else if isAvoidable(graph, u.block, underflowing) {
+			diagnostics.warnf(u.instruction.Pos(), "Possible stack underflow: '%s' needs %d values on the stack, but the stack depth is %d whenever it's reached", u.instruction.String(), consumes, u.depth)
+		} else {
+			diagnostics.errorf(u.instruction.Pos(), "Stack underflow: '%s' needs %d values on the stack, but the stack depth is %d", u.instruction.String(), consumes, u.depth)
+		}
+	}
+}
+
+// Returns the stack depth after running the block with the given depth, or where the stack underflows.
+// If the block contains an instruction consuming a variable number of values, the depth after it isn't known.
+func stackDepthAfter(block *Block, depth int) (int, *underflow, bool) {
+	for _, c := range block.code {
+		consumes, pushes := stackEffect(c.Instruction)
+		if depth < consumes {
+			return 0, &underflow{
+				block:       block,
+				instruction: c.Instruction,
+				depth:       depth,
+			}, true
+		}
+		if instructions[c.Instruction.Name].Variable {
+			return 0, nil, false
+		}
+		depth += pushes - consumes
+	}
+	return depth, nil, true
+}
+
+// Checks if the block can be reached from any of the blocks with inconsistent stack depths
+func isUncertain(block *Block, inconsistent map[*Block]bool) bool {
+	for from := range inconsistent {
+		if from.reaches(block) {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks if the program may get around the block, i.e. end, jump to an unknown target or underflow the stack elsewhere
+// without running it. Loops which can only be left through the block don't get around it.
+func isAvoidable(graph *Graph, block *Block, underflowing map[*Block]bool) bool {
+	visited := make(map[*Block]bool)
+	pending := []*Block{graph.Blocks[0]}
+	for len(pending) > 0 {
+		current := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if current == block || visited[current] {
+			continue
+		}
+		if underflowing[current] {
+			return true
+		}
+		visited[current] = true
+		for _, edge := range current.Successors {
+			if edge.To != nil {
+				pending = append(pending, edge.To)
+			} else if edge.Kind != EdgeReturn {
+				// Returning continues after the call, which is an edge of its own. Everything else leaves the program.
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Checks if the block ends with a jump to a label of an imported library
+func jumpsIntoLibrary(block *Block) bool {
+	if len(block.code) < 2 {
+		return false
+	}
+	push := block.code[len(block.code)-2].Instruction
+	return push.Name == "push" && push.Argument.Import != ""
+}
+
+// Checks if the block ends with a call of a subroutine
+func endsWithCall(block *Block) bool {
+	return block.code[len(block.code)-1].Instruction.Name == "call"
+}
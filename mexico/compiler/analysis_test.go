@@ -0,0 +1,110 @@
+package compiler
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckStack(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+
+		// The severity and part of the expected diagnostic, or an empty message if there must be none
+		severity Severity
+		want     string
+	}{
+		{
+			name:     "underflow on every run",
+			source:   "  push 1\n  add\n",
+			severity: SeverityError,
+			want:     "Stack underflow: 'add' needs 2 values on the stack, but the stack depth is 1",
+		},
+		{
+			name:     "underflow after the only way out of a loop",
+			source:   "  push 3\nLOOP:\n  push 1\n  sub\n  dup\n  push LOOP\n  jmpc\n  del\n  add\n",
+			severity: SeverityError,
+			want:     "Stack underflow: 'add' needs 2 values on the stack, but the stack depth is 0",
+		},
+		{
+			name:     "underflow the program may jump around",
+			source:   "  read\n  push END\n  jmpc\n  add\nEND:\n",
+			severity: SeverityWarning,
+			want:     "Possible stack underflow: 'add' needs 2 values on the stack, but the stack depth is 0 whenever it's reached",
+		},
+		{
+			name:     "underflow after joining different depths",
+			source:   "  read\n  push SKIP\n  jmpc\n  push 1\nSKIP:\n  add\n",
+			severity: SeverityWarning,
+			want:     "Possible stack underflow: 'add' needs 2 values on the stack, but the stack depth may be 0",
+		},
+		{
+			name:     "join with different depths",
+			source:   "  read\n  push SKIP\n  jmpc\n  push 1\nSKIP:\n  left\n",
+			severity: SeverityWarning,
+			want:     "Inconsistent stack depth: reached with depth 1 from 4:3, but with depth 0 from elsewhere",
+		},
+		{
+			name:     "loop growing the stack",
+			source:   "LOOP:\n  push 1\n  push LOOP\n  jmp\n",
+			severity: SeverityWarning,
+			want:     "Stack depth grows by 1 on every iteration of the loop starting here, without bound",
+		},
+		{
+			name:     "loop shrinking the stack",
+			source:   "  push 1\n  push 1\n  push 1\nLOOP:\n  del\n  push LOOP\n  jmp\n",
+			severity: SeverityWarning,
+			want:     "Stack depth shrinks by 1 on every iteration of the loop starting here",
+		},
+		{
+			name:     "jump to a calculated line",
+			source:   "  read\n  jmp\n",
+			severity: SeverityWarning,
+			want:     "Target of 'jmp' isn't a constant, the stack depth after it is unknown",
+		},
+		{
+			name:     "call of a subroutine",
+			source:   "  push 2\n  push SQUARE\n  call\n  printnum\n  push END\n  jmp\nSQUARE:\n  dup\n  mult\n  ret\nEND:\n",
+			severity: SeverityWarning,
+			want:     "Subroutines may leave any stack depth behind, the stack depth after 'call' is unknown",
+		},
+		{
+			name:     "call of a calculated line",
+			source:   "  read\n  call\n  add\n",
+			severity: SeverityWarning,
+			want:     "Target of 'call' isn't a constant, the stack depth after it is unknown",
+		},
+		{
+			name:   "balanced loop",
+			source: "  push 3\nLOOP:\n  push 1\n  sub\n  dup\n  push LOOP\n  jmpc\n  del\n",
+		},
+		{
+			name:   "string of unknown length",
+			source: "  push 0\n  push 105\n  push 72\n  push 2\n  printstr\n  add\n",
+		},
+	}
+
+	for _, test := range tests {
+		_, diagnostics := CompileWithOptions(test.source, Options{})
+		if test.want == "" {
+			for _, diagnostic := range diagnostics {
+				if diagnostic.Severity != SeverityNote {
+					t.Errorf("%s: Unexpected diagnostic %s", test.name, diagnostic.String())
+				}
+			}
+			continue
+		}
+
+		found := false
+		for _, diagnostic := range diagnostics {
+			if diagnostic.Severity == test.severity && strings.Contains(diagnostic.Message, test.want) {
+				found = true
+			} else if diagnostic.Severity == SeverityError {
+				t.Errorf("%s: Unexpected error %s", test.name, diagnostic.String())
+			}
+		}
+		if !found {
+			t.Errorf("%s: got diagnostics %v, want one containing %q", test.name, diagnostics, test.want)
+		}
+	}
+}
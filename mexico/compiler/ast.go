@@ -0,0 +1,99 @@
+package compiler
+
+import (
+	"fmt"
+)
+
+// A position in the source code
+type Position struct {
+	// The name of the source file, may be empty
+	File string `json:"file,omitempty"`
+
+	// The line number, starting at 1
+	Line int `json:"line"`
+
+	// The column, counted in characters and starting at 1
+	Column int `json:"column"`
+}
+
+// The parsed source code of a program, as a list of statements in source order
+type Program struct {
+	Statements []Statement
+}
+
+// A single statement of the source code, i.e. an instruction, a label, a directive or a comment
+type Statement interface {
+	Pos() Position
+}
+
+// An instruction, with its argument if it takes one
+type Instruction struct {
+	Position
+	Name     string
+	Argument *Argument
+}
+
+// The argument of an instruction, either a number or a reference to a label
+type Argument struct {
+	Position
+
+	// The argument as written in the source code
+	Text string
+
+	// Whether the argument refers to a label, rather than being a number
+	IsLabel bool
+
+	// The alias of the imported library the label belongs to, like "LIB" for "LIB.ROUTINE". Empty for local labels.
+	Import string
+
+	// The value of the argument, if it's a number
+	Value int
+}
+
+// The definition of a label, naming the line number of the next instruction
+type Label struct {
+	Position
+	Name string
+
+	// Whether the label is pinned to a line number, like "@100 LOOP:"
+	Pinned     bool
+	Linenumber int
+}
+
+// A directive to the compiler, which doesn't end up in the compiled program itself
+type Directive struct {
+	Position
+	Name      string
+	Arguments []*Argument
+}
+
+// A comment, starting with '#', ';' or '//' and ending at the end of the line
+type Comment struct {
+	Position
+	Text string
+}
+
+// Returns the position of the node
+func (p Position) Pos() Position {
+	return p
+}
+
+// Returns the position in the format "file:line:column", leaving out the file if it's unknown
+func (p Position) String() string {
+	if p.Line == 0 {
+		// Not a position inside the file, but the file as a whole
+		return p.File
+	}
+	if p.File == "" {
+		return fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+}
+
+// Returns the instruction as written in the source code
+func (i *Instruction) String() string {
+	if i.Argument == nil {
+		return i.Name
+	}
+	return fmt.Sprintf("%s %s", i.Name, i.Argument.Text)
+}
@@ -0,0 +1,208 @@
+package compiler
+
+import (
+	"sort"
+)
+
+// The kind of an edge between two basic blocks
+type EdgeKind int
+
+const (
+	// The last instruction of the block is not a jump, execution simply continues with the next line
+	EdgeFallthrough EdgeKind = iota
+
+	// A jmpc to a constant line number, only taken if the condition is met
+	EdgeConditional
+
+	// A jmp to a constant line number
+	EdgeUnconditional
+
+	// A jump to a line number which isn't known before running the program
+	EdgeUnknown
+
+	// A call of a subroutine at a constant line number. Execution continues after the call once the subroutine returns.
+	EdgeCall
+
+	// A return from a subroutine, back to the line following the call
+	EdgeReturn
+)
+
+// A basic block, i.e. a sequence of instructions which is only entered at its first and left at its last instruction
+type Block struct {
+	// The labels pointing to the first instruction of the block, if any
+	Labels []string
+
+	// The instructions of the block, in the order they are executed
+	code []numberedInstruction
+
+	// The edges leaving and entering the block
+	Successors   []*Edge
+	Predecessors []*Edge
+}
+
+// An edge of the control flow graph
+type Edge struct {
+	Kind EdgeKind
+
+	// The blocks connected by the edge. To is nil if the edge leaves the program, or if its target is unknown.
+	From *Block
+	To   *Block
+}
+
+// The control flow graph of a program, with the block containing the first line first
+type Graph struct {
+	Blocks []*Block
+}
+
+// Returns the name of the edge kind
+func (k EdgeKind) String() string {
+	switch k {
+	case EdgeConditional:
+		return "conditional"
+	case EdgeUnconditional:
+		return "unconditional"
+	case EdgeUnknown:
+		return "unknown"
+	case EdgeCall:
+		return "call"
+	case EdgeReturn:
+		return "return"
+	}
+	return "fallthrough"
+}
+
+// Builds the control flow graph of the numbered instructions, with the arguments of all instructions resolved to numbers.
+// The target of a jump is known if the line number is pushed by the instruction right before it, like "push LABEL; jmp".
+func buildGraph(code []numberedInstruction) *Graph {
+	var graph Graph
+	if len(code) == 0 {
+		return &graph
+	}
+
+	// Find the instructions starting a block: the first one, the targets of jumps, and those following a jump or return
+	leaders := map[int]bool{0: true}
+	for i, c := range code {
+		if c.Instruction.Name == "ret" {
+			leaders[i+1] = true
+		}
+		if !isJump(c.Instruction) {
+			continue
+		}
+		leaders[i+1] = true
+		if target, isConstant := jumpTarget(code, i); isConstant {
+			leaders[target] = true
+		}
+	}
+
+	var starts []int
+	for leader := range leaders {
+		if leader < len(code) {
+			starts = append(starts, leader)
+		}
+	}
+	sort.Ints(starts)
+
+	// Split the code into blocks
+	blockAt := make(map[int]*Block)
+	for i, start := range starts {
+		end := len(code)
+		if i+1 < len(starts) {
+			end = starts[i+1]
+		}
+		block := &Block{
+			code: code[start:end],
+		}
+		blockAt[start] = block
+		graph.Blocks = append(graph.Blocks, block)
+	}
+
+	// And connect them, depending on the last instruction of each block
+	for _, start := range starts {
+		block := blockAt[start]
+		last := start + len(block.code) - 1
+		next := blockAt[last+1]
+
+		switch block.code[len(block.code)-1].Instruction.Name {
+		case "jmp":
+			if target, isConstant := jumpTarget(code, last); isConstant {
+				connect(block, blockAt[target], EdgeUnconditional)
+			} else {
+				connect(block, nil, EdgeUnknown)
+			}
+		case "jmpc":
+			if target, isConstant := jumpTarget(code, last); isConstant {
+				connect(block, blockAt[target], EdgeConditional)
+			} else {
+				connect(block, nil, EdgeUnknown)
+			}
+			connect(block, next, EdgeFallthrough)
+		case "call":
+			if target, isConstant := jumpTarget(code, last); isConstant {
+				connect(block, blockAt[target], EdgeCall)
+			} else {
+				connect(block, nil, EdgeUnknown)
+			}
+			connect(block, next, EdgeFallthrough)
+		case "ret":
+			connect(block, nil, EdgeReturn)
+		default:
+			connect(block, next, EdgeFallthrough)
+		}
+	}
+
+	return &graph
+}
+
+// Adds an edge between the blocks
+func connect(from *Block, to *Block, kind EdgeKind) {
+	edge := &Edge{
+		Kind: kind,
+		From: from,
+		To:   to,
+	}
+	from.Successors = append(from.Successors, edge)
+	if to != nil {
+		to.Predecessors = append(to.Predecessors, edge)
+	}
+}
+
+// Checks if the instruction is a jump, i.e. continues at the line number on top of the stack
+func isJump(instruction *Instruction) bool {
+	return instruction.Name == "jmp" || instruction.Name == "jmpc" || instruction.Name == "call"
+}
+
+// Returns the index of the instruction the jump at the given index leads to, and whether it's known before running the program.
+// Just like the interpreter, it continues at the first line at or after the target line number. If there is none, the program ends.
+func jumpTarget(code []numberedInstruction, index int) (int, bool) {
+	if index == 0 || code[index-1].Instruction.Name != "push" || code[index-1].Instruction.Argument.Import != "" {
+		// Labels of imported libraries are only known once the interpreter linked them
+		return 0, false
+	}
+	linenumber := code[index-1].Instruction.Argument.Value
+	return sort.Search(len(code), func(i int) bool {
+		return code[i].Linenumber >= linenumber
+	}), true
+}
+
+// Checks if the block "to" can be reached from the block "from"
+func (from *Block) reaches(to *Block) bool {
+	visited := make(map[*Block]bool)
+	pending := []*Block{from}
+	for len(pending) > 0 {
+		block := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if block == to {
+			return true
+		}
+		if visited[block] {
+			continue
+		}
+		visited[block] = true
+		for _, edge := range block.Successors {
+			if edge.To != nil {
+				pending = append(pending, edge.To)
+			}
+		}
+	}
+	return false
+}
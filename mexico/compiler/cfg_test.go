@@ -0,0 +1,127 @@
+package compiler
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// Describes the edges of the graph, like "LOOP -> (end) fallthrough"
+func describeEdges(graph *Graph) []string {
+	var edges []string
+	for _, block := range graph.Blocks {
+		for _, edge := range block.Successors {
+			edges = append(edges, fmt.Sprintf("%s -> %s %s", block.Name(), edge.target(), edge.Kind.String()))
+		}
+	}
+	return edges
+}
+
+func TestBuildGraph(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   []string
+	}{
+		{
+			name:   "straight code",
+			source: "  push 1\n  print\n",
+			want:   []string{"line 0 -> (end) fallthrough"},
+		},
+		{
+			name:   "loop",
+			source: "  push 3\nLOOP:\n  push 1\n  sub\n  dup\n  push LOOP\n  jmpc\n  del\n",
+			want: []string{
+				"line 0 -> LOOP fallthrough",
+				"LOOP -> LOOP conditional",
+				"LOOP -> line 6 fallthrough",
+				"line 6 -> (end) fallthrough",
+			},
+		},
+		{
+			name:   "jump behind the last line",
+			source: "  push END\n  jmp\n  push 1\nEND:\n",
+			want: []string{
+				"line 0 -> (end) unconditional",
+				"line 2 -> (end) fallthrough",
+			},
+		},
+		{
+			name:   "jump to a calculated line",
+			source: "  read\n  jmp\n  push 1\n",
+			want: []string{
+				"line 0 -> (unknown) unknown",
+				"line 2 -> (end) fallthrough",
+			},
+		},
+		{
+			name:   "conditional jump to a calculated line",
+			source: "  read\n  read\n  jmpc\n  push 1\n",
+			want: []string{
+				"line 0 -> (unknown) unknown",
+				"line 0 -> line 3 fallthrough",
+				"line 3 -> (end) fallthrough",
+			},
+		},
+		{
+			name:   "call and return",
+			source: "  push 2\n  push SQUARE\n  call\n  print\n  push END\n  jmp\nSQUARE:\n  dup\n  mult\n  ret\nEND:\n",
+			want: []string{
+				"line 0 -> SQUARE call",
+				"line 0 -> line 3 fallthrough",
+				"line 3 -> (end) unconditional",
+				"SQUARE -> (return) return",
+			},
+		},
+		{
+			name:   "code following a return",
+			source: "  ret\n  push 1\n",
+			want: []string{
+				"line 0 -> (return) return",
+				"line 1 -> (end) fallthrough",
+			},
+		},
+		{
+			name:   "jump into the middle of a block",
+			source: "  push 1\nMIDDLE:\n  push 2\n  push MIDDLE\n  jmp\n",
+			want: []string{
+				"line 0 -> MIDDLE fallthrough",
+				"MIDDLE -> MIDDLE unconditional",
+			},
+		},
+		{
+			name:   "jump between line numbers",
+			source: "  push 15\n  jmp\n@10 TEN:\n  push 1\n@20 TWENTY:\n  print\n",
+			want: []string{
+				"line 0 -> TWENTY unconditional",
+				"TEN -> TWENTY fallthrough",
+				"TWENTY -> (end) fallthrough",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		graph, diagnostics := GraphFromSource(test.source, Options{})
+		if diagnostics.HasErrors() {
+			t.Errorf("%s: Failed to build graph: %v", test.name, diagnostics)
+			continue
+		}
+		if edges := describeEdges(graph); !reflect.DeepEqual(edges, test.want) {
+			t.Errorf("%s: got edges %q, want %q", test.name, edges, test.want)
+		}
+	}
+}
+
+func TestBlockReaches(t *testing.T) {
+	graph, diagnostics := GraphFromSource("  push 1\nLOOP:\n  push LOOP\n  jmp\n  push 2\n", Options{})
+	if diagnostics.HasErrors() {
+		t.Fatalf("Failed to build graph: %v", diagnostics)
+	}
+	start, loop, dead := graph.Blocks[0], graph.Blocks[1], graph.Blocks[2]
+	if !start.reaches(loop) || !loop.reaches(loop) {
+		t.Errorf("Loop isn't reached")
+	}
+	if loop.reaches(start) || start.reaches(dead) {
+		t.Errorf("Unreachable blocks are reached")
+	}
+}
@@ -2,178 +2,303 @@ package compiler
 
 import (
 	"fmt"
-	"github.com/pkg/errors"
-	"strconv"
 	"strings"
 )
 
-var (
-	// List of commands which can be translated into FQDNs in one step.
-	passThroughCommands = []string{
-		"left",
-		"right",
-		"pusht",
-		// push is missing here, because it is not a simple "pass-through" command; we need to process it further.
-		"pop",
-		"dup",
-		"del",
-		"eq",
-		"not",
-		"gt",
-		"lt",
-		"add",
-		"sub",
-		"mult",
-		"div",
-		"mod",
-		"read",
-		"print",
-		"jmp",
-		"jmpc",
-	}
-)
-
 const (
 	FakeFQDN = "mexico.invalid"
+
+	// The instruction pushing a line number relative to the start of the library, used by libraries instead of "push"
+	// for their own labels. The interpreter adds the line number the library is linked to.
+	RelocatableInstruction = "pushr"
+
+	// The first character string of TXT records naming an imported library, followed by its alias and domain
+	ImportRecord = "mexico:import"
+
+	// The only character string of the TXT record marking a program as library
+	LibraryRecord = "mexico:library"
+
+	// The first character string of TXT records naming a label of a library, followed by its name and line number
+	SymbolRecord = "mexico:symbol"
+
+	// The first character string of the TXT record naming the number of parts of a program, followed by that number.
+	// Signed along with the program, it tells the interpreter that no parts are missing.
+	PartsRecord = "mexico:parts"
+
+	// The highest line number a single set of MX records can hold, as MX preferences are only 16 bits wide
+	MaxLinenumber = 65535
+
+	// Number of line numbers each part of a program covers, if it's split into parts
+	PartSize = MaxLinenumber + 1
+
+	// The highest number of parts a program may be split into, as the interpreter looks up every part on its own
+	MaxParts = 1024
 )
 
+// A numbered instruction, ready to be translated
+type numberedInstruction struct {
+	Linenumber  int
+	Instruction *Instruction
+}
+
+// An instruction together with the labels pointing to it, before line numbers are assigned
+type codeEntry struct {
+	labels      []*Label
+	instruction *Instruction
+}
+
+// The instructions of a program in order, with their labels attached
+type codeLayout struct {
+	entries []codeEntry
+
+	// Labels following the last instruction
+	trailingLabels []*Label
+}
+
+// A compiled program, ready to be written into a zone
+type Module struct {
+	// The code lines, one MX record each
+	Code []Codeline
+
+	// The domains of the imported libraries, by the name they are imported as
+	Imports map[string]string
+
+	// Whether the program was compiled as library, which other programs may import
+	Library bool
+
+	// The line numbers of all labels, for programs importing the library, or for debuggers.
+	// Only set for libraries, and for programs compiled with the Symbols option.
+	Symbols map[string]int
+}
+
+// Options for the compiler
+type Options struct {
+	// The name of the source file, only used for the positions in diagnostics
+	File string
+
+	// The domain to compile the program for, used to name the domains of the parts in diagnostics. May be empty.
+	Domain string
+
+	// Whether to run the peephole optimizer, removing and folding instructions
+	Optimize bool
+
+	// The line number of the first instruction, and the distance between the line numbers of following instructions.
+	// Leaving gaps allows to insert instructions later without changing the line numbers of all following ones.
+	// A step of 0 is treated as 1.
+	Start int
+	Step  int
+
+	// Whether to allow line numbers beyond MaxLinenumber, splitting the program into parts on multiple domains
+	Split bool
+
+	// Whether the program is run straight from the source code, rather than put into MX records. Line numbers aren't
+	// limited by MX preferences then, and the program isn't split into parts.
+	Direct bool
+
+	// Whether to compile the program as library, which other programs may import. Libraries export all their labels,
+	// and push their own labels relative to their start, so they can be linked to any line number.
+	Library bool
+
+	// Whether to export the labels of a program which isn't a library, so a debugger can refer to them
+	Symbols bool
+}
+
 // This is the compile function. As the name suggests, it compiles the source code handed over.
-// For this task, it takes three steps:
-// - Iterate over the source code and clean it (remove comments, remove empty lines, remove surrounding spaces)
-// - Iterate over the source code, number each line and build up a label lookup table (mapping labels to line numbers)
-// - Iterate over the source code and translate the instructions to valid MX records
+// Only errors are returned, warnings are dropped - use CompileWithOptions to get them as well.
 func Compile(lines []string, domain string) ([]Codeline, error) {
-	numberedCode, labelLookupTable := numberLines(cleanCode(lines))
-	return translateLines(numberedCode, labelLookupTable, domain)
+	module, diagnostics := CompileWithOptions(strings.Join(lines, "\n"), Options{
+		Domain: domain,
+	})
+	if diagnostics.HasErrors() {
+		return nil, diagnostics.Errors()
+	}
+	return module.Code, nil
 }
 
-// Cleans the lines in the string array: remove comments, remove empty lines, remove spaces
-func cleanCode(lines []string) []string {
-	var cleanLines []string
-
-	// Iterate over all code lines, and clean them
-	for _, l := range lines {
-		// Remove surrounding spaces and tabs
-		l = strings.Trim(l, " \t")
+// Compiles the source code with the given options, and returns all diagnostics found along the way.
+// For this task, it takes six steps:
+// - Parse the source code into its AST (instructions, labels, directives and comments), and collect the imports
+// - Iterate over the statements, attach labels to the instruction following them
+// - Optionally, remove and fold instruction sequences
+// - Number each instruction and build up a label lookup table (mapping labels to line numbers), and check if they fit into MX records
+// - Iterate over the instructions and translate them to valid MX records
+// - Check the program for things which are valid, but most likely mistakes, and analyse the stack depth along the control flow
+// If any of the diagnostics is an error, no module is returned.
+func CompileWithOptions(source string, options Options) (*Module, Diagnostics) {
+	program, diagnostics := Parse(source, options.File)
+	imports := collectImports(program, &diagnostics)
 
-		// Check if line is a comment
-		if strings.HasPrefix(l, "#") || strings.HasPrefix(l, ";") || strings.HasPrefix(l, "//") {
-			// It is a comment line, ignore
-			continue
+	layout := layoutCode(program, &diagnostics)
+	if options.Optimize && !diagnostics.HasErrors() {
+		removed := optimize(layout, &diagnostics)
+		if removed > 0 {
+			diagnostics.notef(Position{File: options.File}, "Optimizer removed %d of %d instructions, saving %d MX records", removed, len(layout.entries)+removed, removed)
 		}
+	}
+	numberedCode, labelLookupTable := numberLines(layout, options, &diagnostics)
+	checkLinenumbers(numberedCode, options, &diagnostics)
+	code := translateLines(numberedCode, labelLookupTable, imports, options, &diagnostics)
+	checkLabels(program, options, &diagnostics)
+	checkImports(program, imports, &diagnostics)
+	checkReachability(program, &diagnostics)
+	if !diagnostics.HasErrors() && !options.Library {
+		// Only analyse the program flow if all jump targets could be resolved. Libraries are entered by other programs,
+		// with values on the stack the analysis doesn't know about.
+		checkStack(buildGraph(numberedCode), &diagnostics)
+	}
 
-		// Check if line is empty
-		if len(l) == 0 {
-			// Empty line, ignore.
-			continue
-		}
+	diagnostics.sort()
+	if diagnostics.HasErrors() {
+		return nil, diagnostics
+	}
 
-		// If we reach this point, the line is ready to be added to the list of cleaned lines
-		cleanLines = append(cleanLines, l)
+	module := Module{
+		Code:    code,
+		Imports: imports,
+		Library: options.Library,
+	}
+	if options.Library || options.Symbols {
+		module.Symbols = labelLookupTable
+	}
+	return &module, diagnostics
+}
+
+// Attaches the labels to the instruction following them
+func layoutCode(program *Program, diagnostics *Diagnostics) *codeLayout {
+	var layout codeLayout
+	var pendingLabels []*Label
+	var labelDefinitions = make(map[string]*Label)
+
+	// Iterate over all statements, and collect the labels until an instruction follows
+	for _, s := range program.Statements {
+		switch statement := s.(type) {
+		case *Label:
+			// It's a label, it points to the next instruction
+			if previous, isDefined := labelDefinitions[statement.Name]; isDefined {
+				diagnostics.warnf(statement.Pos(), "Label '%s' is already defined at %s, this definition overrides it", statement.Name, previous.Pos().String())
+			}
+			labelDefinitions[statement.Name] = statement
+			pendingLabels = append(pendingLabels, statement)
+		case *Instruction:
+			layout.entries = append(layout.entries, codeEntry{
+				labels:      pendingLabels,
+				instruction: statement,
+			})
+			pendingLabels = nil
+		}
 	}
 
-	// Return cleaned lines
-	return cleanLines
+	layout.trailingLabels = pendingLabels
+	return &layout
 }
 
-// Adds line numbers to the code lines, and builds up a label lookup table, mapping label to line numbers
-func numberLines(lines []string) ([]Codeline, map[string]int) {
-	var code []Codeline
+// Adds line numbers to the instructions, and builds up a label lookup table, mapping label to line numbers
+func numberLines(layout *codeLayout, options Options, diagnostics *Diagnostics) ([]numberedInstruction, map[string]int) {
+	var code []numberedInstruction
 	var labelLookup = make(map[string]int)
-	linenumber := 0
-
-	// Iterate over all (string) lines and convert them to codelines
-	for _, l := range lines {
-		// Check if line is a label - defined by ':' at the end
-		if l[len(l)-1] == ':' {
-			// It's a label. Write it into the lookup table
-			name := l[:len(l)-1]
-			labelLookup[name] = linenumber
-
-			// And skip further execution, to avoid raising the line number or appending this line to the code array
-			continue
+
+	step := options.Step
+	if step <= 0 {
+		step = 1
+	}
+	linenumber := options.Start
+
+	// Labels may pin the line number of the instruction following them, and point to it
+	assignLabels := func(labels []*Label) {
+		var pinnedBy *Label
+		for _, label := range labels {
+			if !label.Pinned {
+				continue
+			}
+			if pinnedBy != nil && pinnedBy.Linenumber != label.Linenumber {
+				diagnostics.errorf(label.Pos(), "Label '%s' is pinned to line %d, but label '%s' already pinned it to line %d", label.Name, label.Linenumber, pinnedBy.Name, pinnedBy.Linenumber)
+				continue
+			}
+			if len(code) > 0 && label.Linenumber <= code[len(code)-1].Linenumber {
+				diagnostics.errorf(label.Pos(), "Label '%s' is pinned to line %d, but the previous instruction already has line number %d", label.Name, label.Linenumber, code[len(code)-1].Linenumber)
+				continue
+			}
+			pinnedBy = label
+			linenumber = label.Linenumber
 		}
+		for _, label := range labels {
+			labelLookup[label.Name] = linenumber
+		}
+	}
+
+	// Iterate over all instructions, and number them
+	for _, e := range layout.entries {
+		assignLabels(e.labels)
 
-		// Append codeline to the array
-		code = append(code, Codeline{
-			Linenumber: linenumber,
-			Code: l,
+		// Append instruction to the array
+		code = append(code, numberedInstruction{
+			Linenumber:  linenumber,
+			Instruction: e.instruction,
 		})
 
 		// Raise line number
-		linenumber++
+		linenumber += step
 	}
+	assignLabels(layout.trailingLabels)
 
 	// Returns the code lines and the label lookup table
 	return code, labelLookup
 }
 
-// Translates the code into FQDNs to be further used for MX records, resolving  labels to their line numbers
-func translateLines(code []Codeline, labelLookup map[string]int, domain string) ([]Codeline, error) {
-	// Iterate over all commands
-	for i := 0; i < len(code); i++ {
-		// Check if command is part of "pass-through" commands.
-		found := false
-		for _, c := range passThroughCommands {
-			if code[i].Code == c {
-				// It is! We can simply translate it to a FQDN without further processing required.
-				code[i].Code = fmt.Sprintf("%s.%s.", c, FakeFQDN)
-				found = true
-				break
-			}
-		}
-
-		// Check if command was a pass-through command
-		if found {
-			// It was, go on to the next command
-			continue
-		}
+// Returns the domain holding the given part of a program split into parts. Part 0 is the domain itself.
+func PartDomain(domain string, part int) string {
+	if part == 0 {
+		return domain
+	}
+	return fmt.Sprintf("part%d.%s", part, domain)
+}
 
-		// Check if it is the push command
-		if code[i].Code[:4] == "push" {
-			// It is. Either we have a constant here, or a label name - let's check.
-			maybeLabelMaybeConstant := code[i].Code[5:]
-			maybeLinenumberMaybeNot := getNumberForLabel(maybeLabelMaybeConstant, labelLookup)
+// Translates the instructions into FQDNs to be further used for MX records, resolving labels to their line numbers.
+// Labels of imported libraries are kept as they are, the interpreter resolves them when linking the libraries.
+func translateLines(code []numberedInstruction, labelLookup map[string]int, imports map[string]string, options Options, diagnostics *Diagnostics) []Codeline {
+	var lines []Codeline
 
-			// if maybeLinenumberMaybeNot is not -1, there is a label with this name :)
-			if maybeLinenumberMaybeNot > -1 {
-				// Found linenumber for that label - write it into code
-				code[i].Code = fmt.Sprintf("push-%d.%s.", maybeLinenumberMaybeNot, FakeFQDN)
+	// Iterate over all instructions
+	for _, c := range code {
+		// Instructions without argument can simply be translated to a FQDN without further processing required.
+		name := c.Instruction.Name
+		argument := c.Instruction.Argument
+		switch {
+		case argument == nil:
+		case argument.Import != "":
+			// A label of an imported library
+			if _, isImported := imports[argument.Import]; !isImported {
+				diagnostics.errorf(argument.Pos(), "No library is imported as '%s', please import it like this: import <domain> as %s", argument.Import, argument.Import)
+				continue
+			}
+			name = fmt.Sprintf("%s-%s", name, argument.Text)
+		case argument.IsLabel:
+			// A label, resolve it
+			linenumber, isLabel := labelLookup[argument.Text]
+			if !isLabel {
+				diagnostics.errorf(argument.Pos(), "Not a label or a integer constant: '%s'", argument.Text)
 				continue
 			}
 
-			// If we are at this point, we didn't find a label with that name. Try to parse it as a number
-			maybeValueMaybeNot, atoiErr := strconv.Atoi(maybeLabelMaybeConstant)
+			// Keep the resolved line number, later steps need it
+			argument.Value = linenumber
 
-			// Throw error if parsing didn't work
-			if atoiErr != nil {
-				errorString := fmt.Sprintf("Not a label or a integer constant: '%d'. %s", maybeLinenumberMaybeNot, atoiErr.Error())
-				return nil, errors.New(errorString)
+			// Libraries are linked to other line numbers, so they push their labels relative to their start
+			if options.Library {
+				name = RelocatableInstruction
 			}
-
-			// If we are at this point, we were able to parse the mystery value as an integer. Yay!
-			code[i].Code = fmt.Sprintf("push-%d.%s.", maybeValueMaybeNot, FakeFQDN)
-			continue
+			name = fmt.Sprintf("%s-%d", name, linenumber)
+		default:
+			// A constant
+			name = fmt.Sprintf("%s-%d", name, argument.Value)
 		}
 
-		// uh, if we reach this point, it's not a valid command - return
-		return nil, errors.New(fmt.Sprintf("Not a valid command: %s", code[i].Code))
+		lines = append(lines, Codeline{
+			Linenumber: c.Linenumber,
+			Code:       fmt.Sprintf("%s.%s.", name, FakeFQDN),
+		})
 	}
 
 	// And return our constructed source code
-	return code, nil
+	return lines
 }
-
-// Returns the line number for the given label, or -1 if no such label was found
-func getNumberForLabel(label string, labelLookup map[string]int) int {
-	// iterate over all labels
-	for l, number := range labelLookup {
-		if l == label {
-			// Found, return number
-			return number
-		}
-	}
-
-	// None found, return -1
-	return -1
-}
\ No newline at end of file
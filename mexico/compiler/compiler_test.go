@@ -0,0 +1,116 @@
+package compiler
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// Returns source code with an instruction pinned to each of the given line numbers
+func pinnedSource(linenumbers ...int) string {
+	var source strings.Builder
+	for i, linenumber := range linenumbers {
+		source.WriteString(fmt.Sprintf("@%d L%d:\n  push %d\n  pop\n", linenumber, i, i))
+	}
+	return source.String()
+}
+
+// Returns the line numbers of the first line of each part, and the given ones
+func everyPart(linenumbers ...int) []int {
+	var all []int
+	for part := 0; part < MaxParts; part++ {
+		all = append(all, part*PartSize)
+	}
+	return append(all, linenumbers...)
+}
+
+func TestCompileLinenumberLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		options Options
+
+		// The line number of the last code line, or the part of the expected error
+		last int
+		want string
+	}{
+		{
+			name:   "last line of a single set",
+			source: pinnedSource(MaxLinenumber - 1),
+			last:   MaxLinenumber,
+		},
+		{
+			name:   "first line beyond a single set",
+			source: pinnedSource(MaxLinenumber),
+			want:   "Line number 65536 exceeds 65535, the highest MX preference",
+		},
+		{
+			name:    "first line of the second part",
+			source:  pinnedSource(MaxLinenumber),
+			options: Options{Split: true},
+			last:    PartSize,
+		},
+		{
+			name:    "last line of the last part",
+			source:  pinnedSource(everyPart(MaxParts*PartSize - 2)...),
+			options: Options{Split: true},
+			last:    MaxParts*PartSize - 1,
+		},
+		{
+			name:    "first line beyond the last part",
+			source:  pinnedSource(everyPart(MaxParts*PartSize - 1)...),
+			options: Options{Split: true, Domain: "fib.mxc.example."},
+			want:    "Line number 67108864 would go into part 1024 (part1024.fib.mxc.example.), but programs can't be split into more than 1024 parts",
+		},
+		{
+			name:    "part without code",
+			source:  pinnedSource(0, 2*PartSize),
+			options: Options{Split: true},
+			want:    "No code in part 1 of the program",
+		},
+		{
+			name:    "parts without code",
+			source:  pinnedSource(0, 3*PartSize),
+			options: Options{Split: true},
+			want:    "No code in part 1 to part 2 of the program",
+		},
+		{
+			name:    "negative line",
+			source:  "  push 1\n  pop\n",
+			options: Options{Start: -1},
+			want:    "Line number -1 is negative, but MX preferences can't be",
+		},
+	}
+
+	for _, test := range tests {
+		module, diagnostics := CompileWithOptions(test.source, test.options)
+		if test.want != "" {
+			if !diagnostics.HasErrors() || !strings.Contains(diagnostics.Errors().Error(), test.want) {
+				t.Errorf("%s: got errors %v, want one containing %q", test.name, diagnostics.Errors(), test.want)
+			}
+			continue
+		}
+		if diagnostics.HasErrors() {
+			t.Errorf("%s: Failed to compile: %v", test.name, diagnostics.Errors())
+			continue
+		}
+		if last := module.Code[len(module.Code)-1].Linenumber; last != test.last {
+			t.Errorf("%s: Last line is %d, want %d", test.name, last, test.last)
+		}
+	}
+}
+
+func TestCompileWarnsAboutNegativeJumpTargets(t *testing.T) {
+	for _, options := range []Options{{}, {Split: true}, {Direct: true}} {
+		_, diagnostics := CompileWithOptions("  push 1\n  push -3\n  jmpc\n", options)
+		found := false
+		for _, diagnostic := range diagnostics {
+			if diagnostic.Severity == SeverityWarning && strings.Contains(diagnostic.Message, "Jump target -3 is negative") {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("%+v: No warning about the negative jump target in %v", options, diagnostics)
+		}
+	}
+}
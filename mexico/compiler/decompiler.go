@@ -0,0 +1,337 @@
+package compiler
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Compiled code lines translated back into instructions, together with the numbering used by the compiler
+type decompiledCode struct {
+	code []numberedInstruction
+
+	// The labels for all constant jump targets, and the exported ones
+	labelLookup map[string]int
+
+	// The line number of the first instruction, and the distance used for most of the following ones
+	start int
+	step  int
+
+	// Whether the code is a library, pushing its own labels relative to its start
+	library bool
+
+	// The aliases of imported libraries whose labels are used, but which aren't named by the module
+	unknownImports []string
+}
+
+// This is the decompile function, the inverse of translateLines. It reconstructs source code from a compiled module.
+// Line numbers used as constant targets of jumps, i.e. pushed right before a jmp, jmpc or call, are turned into labels,
+// named like the exported label pointing there, if any. Imported libraries are turned back into import directives.
+// The returned source code compiles to the very same records again - if the line numbers don't start at 0 or are more
+// than 1 apart, or exceed a single set of MX records, a comment at the top names the compiler options to use.
+func Decompile(module *Module) (string, error) {
+	decompiled, decompileErr := decompileCode(module)
+	if decompileErr != nil {
+		return "", decompileErr
+	}
+
+	var source strings.Builder
+	if decompiled.start != 0 || decompiled.step != 1 {
+		source.WriteString(fmt.Sprintf("// Compile with -lineStart %d -lineStep %d to get the same line numbers\n", decompiled.start, decompiled.step))
+	}
+	if len(decompiled.code) > 0 && decompiled.code[len(decompiled.code)-1].Linenumber > MaxLinenumber {
+		source.WriteString("// Compile with -split, the line numbers exceed a single set of MX records\n")
+	}
+	if decompiled.library {
+		source.WriteString("// Compile with -library, this is a library\n")
+	} else if len(module.Symbols) > 0 {
+		source.WriteString("// Compile with -symbols, the labels are exported\n")
+	}
+	for _, alias := range decompiled.unknownImports {
+		source.WriteString(fmt.Sprintf("// Uses the library imported as %s, please add: import <domain> as %s\n", alias, alias))
+	}
+	for _, alias := range sortedAliases(module.Imports) {
+		source.WriteString(fmt.Sprintf("import %s as %s\n", module.Imports[alias], alias))
+	}
+	if len(module.Imports) > 0 {
+		source.WriteString("\n")
+	}
+
+	// Labels are printed in front of the line they point to
+	labelsAt := make(map[int][]string)
+	for _, label := range sortedLabels(decompiled.labelLookup) {
+		linenumber := decompiled.labelLookup[label]
+		labelsAt[linenumber] = append(labelsAt[linenumber], label)
+	}
+
+	// Print the source code. Line numbers not following the step are pinned with a label.
+	for i, c := range decompiled.code {
+		labels := labelsAt[c.Linenumber]
+		if i > 0 && c.Linenumber != decompiled.code[i-1].Linenumber+decompiled.step {
+			if len(labels) == 0 {
+				labels = []string{labelName(c.Linenumber)}
+			}
+			source.WriteString(fmt.Sprintf("@%d %s:\n", c.Linenumber, labels[0]))
+			labels = labels[1:]
+		}
+		for _, label := range labels {
+			source.WriteString(fmt.Sprintf("%s:\n", label))
+		}
+		source.WriteString(fmt.Sprintf("  %s\n", c.Instruction.String()))
+	}
+
+	// Including the labels pointing right behind the last line
+	if len(decompiled.code) > 0 {
+		for _, label := range labelsAt[decompiled.code[len(decompiled.code)-1].Linenumber+decompiled.step] {
+			source.WriteString(fmt.Sprintf("%s:\n", label))
+		}
+	}
+	return source.String(), nil
+}
+
+// Translates the code lines of the module back into numbered instructions, and builds up a label lookup table for all
+// constant jump targets and exported labels
+func decompileCode(module *Module) (*decompiledCode, error) {
+	sorted := make([]Codeline, len(module.Code))
+	copy(sorted, module.Code)
+	sort.SliceStable(sorted, func(a, b int) bool {
+		return sorted[a].Linenumber < sorted[b].Linenumber
+	})
+
+	// The imports and labels end up in the source code, so they have to be valid names there
+	for _, alias := range sortedAliases(module.Imports) {
+		if !isName(alias) || !isDomain(module.Imports[alias]) {
+			return nil, errors.New(fmt.Sprintf("Import of '%s' as '%s' can't be expressed in source code", module.Imports[alias], alias))
+		}
+	}
+	for _, symbol := range sortedLabels(module.Symbols) {
+		if !isName(symbol) {
+			return nil, errors.New(fmt.Sprintf("Exported label '%s' can't be expressed in source code", symbol))
+		}
+	}
+
+	// Translate the FQDNs back into instructions
+	decompiled := decompiledCode{
+		labelLookup: make(map[string]int),
+		step:        1,
+		library:     module.Library,
+	}
+	for i, c := range sorted {
+		// Only the first of multiple instructions with the same line number is ever executed, and source code can't express that
+		if i > 0 && c.Linenumber == sorted[i-1].Linenumber {
+			return nil, errors.New(fmt.Sprintf("Line %d is defined more than once, this can't be expressed in source code", c.Linenumber))
+		}
+
+		instruction, instructionErr := decompileLine(c)
+		if instructionErr != nil {
+			return nil, instructionErr
+		}
+		decompiled.code = append(decompiled.code, numberedInstruction{
+			Linenumber:  c.Linenumber,
+			Instruction: instruction,
+		})
+	}
+	if len(decompiled.code) == 0 {
+		return &decompiled, nil
+	}
+
+	// Guess the numbering used by the compiler: the most common distance between line numbers, preferring the smaller one
+	decompiled.start = decompiled.code[0].Linenumber
+	distances := make(map[int]int)
+	for i := 1; i < len(decompiled.code); i++ {
+		distance := decompiled.code[i].Linenumber - decompiled.code[i-1].Linenumber
+		distances[distance]++
+		if distances[distance] > distances[decompiled.step] || (distances[distance] == distances[decompiled.step] && distance < decompiled.step) {
+			decompiled.step = distance
+		}
+	}
+
+	// Find all line numbers which may be labelled. Besides existing lines, a label may point right behind the last line,
+	// as jumps there simply stop the program. Other line numbers can't be labelled, they are kept as they are.
+	linenumbers := map[int]bool{
+		decompiled.code[len(decompiled.code)-1].Linenumber + decompiled.step: true,
+	}
+	for _, c := range decompiled.code {
+		linenumbers[c.Linenumber] = true
+	}
+
+	// Exported labels keep their names, and name the line numbers they point to
+	symbolsAt := make(map[int][]string)
+	for _, symbol := range sortedLabels(module.Symbols) {
+		linenumber := module.Symbols[symbol]
+		if !linenumbers[linenumber] {
+			return nil, errors.New(fmt.Sprintf("Exported label '%s' points to line %d, which is no line of the program, this can't be expressed in source code", symbol, linenumber))
+		}
+		decompiled.labelLookup[symbol] = linenumber
+		symbolsAt[linenumber] = append(symbolsAt[linenumber], symbol)
+	}
+	labelFor := func(linenumber int) string {
+		if symbols := symbolsAt[linenumber]; len(symbols) > 0 {
+			return symbols[0]
+		}
+		decompiled.labelLookup[labelName(linenumber)] = linenumber
+		return labelName(linenumber)
+	}
+
+	// Libraries mark their labels themselves, and every other number pushed is a constant
+	unknown := make(map[string]bool)
+	for _, c := range decompiled.code {
+		argument := c.Instruction.Argument
+		switch {
+		case argument == nil || !argument.IsLabel:
+		case argument.Import != "":
+			// Names in MX records may lose their case on their way through the DNS, so use the spelling of the import
+			alias, isImported := matchAlias(module.Imports, argument.Import)
+			if !isImported {
+				if !unknown[argument.Import] {
+					unknown[argument.Import] = true
+					decompiled.unknownImports = append(decompiled.unknownImports, argument.Import)
+				}
+				continue
+			}
+			argument.Text = alias + strings.TrimPrefix(argument.Text, argument.Import)
+			argument.Import = alias
+		case !linenumbers[argument.Value]:
+			return nil, errors.New(fmt.Sprintf("Line %d: Relative line number %d is no line of the library, this can't be expressed in source code", c.Linenumber, argument.Value))
+		default:
+			decompiled.library = true
+			argument.Text = labelFor(argument.Value)
+		}
+	}
+	if decompiled.library {
+		return &decompiled, nil
+	}
+
+	for i, c := range decompiled.code {
+		if i+1 < len(decompiled.code) && isJumpTarget(c.Instruction, decompiled.code[i+1].Instruction) && !c.Instruction.Argument.IsLabel {
+			if value := c.Instruction.Argument.Value; linenumbers[value] {
+				c.Instruction.Argument.IsLabel = true
+				c.Instruction.Argument.Text = labelFor(value)
+			}
+		}
+	}
+	return &decompiled, nil
+}
+
+// Translates a single code line back into an instruction. Only the instruction is case-insensitive, the labels of
+// imported libraries keep their case.
+func decompileLine(c Codeline) (*Instruction, error) {
+	suffix := fmt.Sprintf(".%s.", FakeFQDN)
+	if !strings.HasSuffix(strings.ToLower(c.Code), suffix) {
+		return nil, errors.New(fmt.Sprintf("Line %d: '%s' is not a mexico instruction", c.Linenumber, c.Code))
+	}
+	code := c.Code[:len(c.Code)-len(suffix)]
+
+	// The argument is separated by the first minus sign, as done by translateLines
+	parts := strings.SplitN(code, "-", 2)
+	parts[0] = strings.ToLower(parts[0])
+	relocatable := parts[0] == RelocatableInstruction
+	if relocatable {
+		// Libraries push their own labels relative to their start
+		parts[0] = "push"
+	}
+	spec, isInstruction := instructions[parts[0]]
+	if !isInstruction {
+		return nil, errors.New(fmt.Sprintf("Line %d: Unknown instruction '%s'", c.Linenumber, parts[0]))
+	}
+
+	instruction := Instruction{
+		Name: parts[0],
+	}
+	if spec.Arguments != len(parts)-1 {
+		return nil, errors.New(fmt.Sprintf("Line %d: Instruction '%s' takes %d arguments, found '%s'", c.Linenumber, parts[0], spec.Arguments, c.Code))
+	}
+	if spec.Depth && (strings.Contains(parts[1], ".") || strings.HasPrefix(parts[1], "-")) {
+		return nil, errors.New(fmt.Sprintf("Line %d: Not a position on the stack: '%s'", c.Linenumber, parts[1]))
+	}
+	if spec.Arguments > 0 && strings.Contains(parts[1], ".") {
+		// A label of an imported library, like "lib.routine"
+		names := strings.SplitN(parts[1], ".", 2)
+		if !isName(names[0]) || !isName(names[1]) {
+			return nil, errors.New(fmt.Sprintf("Line %d: Not a label of an imported library: '%s'", c.Linenumber, parts[1]))
+		}
+		instruction.Argument = &Argument{
+			Text:    parts[1],
+			IsLabel: true,
+			Import:  names[0],
+		}
+	} else if spec.Arguments > 0 {
+		// Only the canonical form of the number compiles to the same code line again
+		value, atoiErr := strconv.Atoi(parts[1])
+		if atoiErr != nil || strconv.Itoa(value) != parts[1] {
+			return nil, errors.New(fmt.Sprintf("Line %d: Not an integer constant: '%s'", c.Linenumber, parts[1]))
+		}
+		instruction.Argument = &Argument{
+			Text:  strconv.Itoa(value),
+			Value: value,
+		}
+		if relocatable {
+			instruction.Argument.IsLabel = true
+			instruction.Argument.Text = labelName(value)
+		}
+	}
+	return &instruction, nil
+}
+
+// Checks if the instruction pushes the target of the jump following it
+func isJumpTarget(instruction *Instruction, next *Instruction) bool {
+	return instruction.Name == "push" && isJump(next)
+}
+
+// Returns the name of the label for the given line number
+func labelName(linenumber int) string {
+	return fmt.Sprintf("LINE_%d", linenumber)
+}
+
+// Checks if the text is a name the parser accepts for labels and imports
+func isName(text string) bool {
+	return text != "" && isIdentifierStart(rune(text[0])) && isPlainName(text)
+}
+
+// Checks if the text is a domain the parser accepts in import directives
+func isDomain(text string) bool {
+	if text == "" || !isIdentifierStart(rune(text[0])) {
+		return false
+	}
+	for _, c := range text {
+		if !isIdentifierPart(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the alias of the import spelled like the given one, preferring the exact spelling
+func matchAlias(imports map[string]string, alias string) (string, bool) {
+	if _, isImported := imports[alias]; isImported {
+		return alias, true
+	}
+	for _, name := range sortedAliases(imports) {
+		if strings.EqualFold(name, alias) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// Returns the aliases of the imports, sorted
+func sortedAliases(imports map[string]string) []string {
+	aliases := make([]string, 0, len(imports))
+	for alias := range imports {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	return aliases
+}
+
+// Returns the names of the labels, sorted
+func sortedLabels(labels map[string]int) []string {
+	names := make([]string, 0, len(labels))
+	for label := range labels {
+		names = append(names, label)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,166 @@
+package compiler
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// The severity of a diagnostic
+type Severity int
+
+const (
+	// The program can't be compiled
+	SeverityError Severity = iota
+
+	// The program can be compiled, but probably doesn't do what it's meant to do
+	SeverityWarning
+
+	// Information about the compilation, e.g. what the optimizer did
+	SeverityNote
+)
+
+// A message of the compiler about a problem in the source code
+type Diagnostic struct {
+	Severity Severity `json:"severity"`
+	Position
+	Message string `json:"message"`
+}
+
+// All messages of the compiler about a program. As it implements the error interface, it can be returned as error as well.
+type Diagnostics []Diagnostic
+
+// Returns the name of the severity
+func (s Severity) String() string {
+	switch s {
+	case SeverityWarning:
+		return "warning"
+	case SeverityNote:
+		return "note"
+	}
+	return "error"
+}
+
+// Converts the severity into its name in JSON output
+func (s Severity) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// Returns the diagnostic in the format "file:line:column: severity: message"
+func (d Diagnostic) String() string {
+	if d.Position.String() == "" {
+		return fmt.Sprintf("%s: %s", d.Severity.String(), d.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", d.Position.String(), d.Severity.String(), d.Message)
+}
+
+// Builds an error at the given position
+func newError(pos Position, format string, args ...interface{}) *Diagnostic {
+	return &Diagnostic{
+		Severity: SeverityError,
+		Position: pos,
+		Message:  fmt.Sprintf(format, args...),
+	}
+}
+
+// Adds an error at the given position
+func (d *Diagnostics) errorf(pos Position, format string, args ...interface{}) {
+	*d = append(*d, *newError(pos, format, args...))
+}
+
+// Adds a warning at the given position
+func (d *Diagnostics) warnf(pos Position, format string, args ...interface{}) {
+	*d = append(*d, Diagnostic{
+		Severity: SeverityWarning,
+		Position: pos,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// Adds a note at the given position
+func (d *Diagnostics) notef(pos Position, format string, args ...interface{}) {
+	*d = append(*d, Diagnostic{
+		Severity: SeverityNote,
+		Position: pos,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// Checks if any of the diagnostics is an error
+func (d Diagnostics) HasErrors() bool {
+	for _, diagnostic := range d {
+		if diagnostic.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns only the errors, without warnings
+func (d Diagnostics) Errors() Diagnostics {
+	var errs Diagnostics
+	for _, diagnostic := range d {
+		if diagnostic.Severity == SeverityError {
+			errs = append(errs, diagnostic)
+		}
+	}
+	return errs
+}
+
+// Returns all diagnostics, one per line
+func (d Diagnostics) Error() string {
+	lines := make([]string, len(d))
+	for i, diagnostic := range d {
+		lines[i] = diagnostic.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Sorts the diagnostics by their position in the source code. Those about the file as a whole come last.
+func (d Diagnostics) sort() {
+	sort.SliceStable(d, func(a, b int) bool {
+		if (d[a].Line == 0) != (d[b].Line == 0) {
+			return d[b].Line == 0
+		}
+		if d[a].Line != d[b].Line {
+			return d[a].Line < d[b].Line
+		}
+		return d[a].Column < d[b].Column
+	})
+}
+
+// Returns all diagnostics, each followed by the line of source code it refers to and a caret pointing at the exact position
+func (d Diagnostics) Format(source string) string {
+	lines := strings.Split(source, "\n")
+
+	var formatted strings.Builder
+	for _, diagnostic := range d {
+		formatted.WriteString(diagnostic.String())
+		formatted.WriteString("\n")
+		if diagnostic.Line < 1 || diagnostic.Line > len(lines) {
+			continue
+		}
+
+		// Print the line, and a caret below the position. Tabs are kept, so the caret lines up with the code.
+		line := []rune(strings.TrimRight(lines[diagnostic.Line-1], "\r"))
+		var indent strings.Builder
+		for i := 0; i < diagnostic.Column-1 && i < len(line); i++ {
+			if line[i] == '\t' {
+				indent.WriteRune('\t')
+			} else {
+				indent.WriteRune(' ')
+			}
+		}
+		formatted.WriteString(fmt.Sprintf("    %s\n    %s^\n", string(line), indent.String()))
+	}
+	return formatted.String()
+}
+
+// Returns the diagnostics as JSON array, for use by editors and other tools
+func (d Diagnostics) JSON() ([]byte, error) {
+	if d == nil {
+		d = Diagnostics{}
+	}
+	return json.MarshalIndent(d, "", "\t")
+}
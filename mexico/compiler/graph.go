@@ -0,0 +1,205 @@
+package compiler
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// Names of the nodes used for edges leaving the program, returning from a subroutine, and for edges with unknown target.
+	// They can't clash with labels, as labels may not contain parentheses.
+	graphEndNode     = "(end)"
+	graphUnknownNode = "(unknown)"
+	graphReturnNode  = "(return)"
+)
+
+// A block of the control flow graph, as exported to JSON
+type jsonBlock struct {
+	Name         string            `json:"name"`
+	Labels       []string          `json:"labels,omitempty"`
+	Instructions []jsonInstruction `json:"instructions"`
+}
+
+// An instruction of a block, as exported to JSON
+type jsonInstruction struct {
+	Line int    `json:"line"`
+	Code string `json:"code"`
+}
+
+// An edge of the control flow graph, as exported to JSON
+type jsonEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Kind string `json:"kind"`
+}
+
+// Builds the control flow graph of the given source code. If any of the diagnostics is an error, no graph is returned.
+func GraphFromSource(source string, options Options) (*Graph, Diagnostics) {
+	program, diagnostics := Parse(source, options.File)
+	imports := collectImports(program, &diagnostics)
+	numberedCode, labelLookup := numberLines(layoutCode(program, &diagnostics), options, &diagnostics)
+	translateLines(numberedCode, labelLookup, imports, options, &diagnostics)
+	diagnostics.sort()
+	if diagnostics.HasErrors() {
+		return nil, diagnostics
+	}
+
+	graph := buildGraph(numberedCode)
+	graph.setLabels(labelLookup)
+	return graph, diagnostics
+}
+
+// Builds the control flow graph of compiled code lines. Constant jump targets are named like the decompiler names them.
+func GraphFromCode(code []Codeline) (*Graph, error) {
+	decompiled, decompileErr := decompileCode(&Module{Code: code})
+	if decompileErr != nil {
+		return nil, decompileErr
+	}
+
+	graph := buildGraph(decompiled.code)
+	graph.setLabels(decompiled.labelLookup)
+	return graph, nil
+}
+
+// Assigns the labels to the blocks they point to
+func (g *Graph) setLabels(labelLookup map[string]int) {
+	for _, block := range g.Blocks {
+		for label, linenumber := range labelLookup {
+			if linenumber == block.FirstLine() {
+				block.Labels = append(block.Labels, label)
+			}
+		}
+		sort.Strings(block.Labels)
+	}
+}
+
+// Returns the line number of the first instruction of the block
+func (b *Block) FirstLine() int {
+	return b.code[0].Linenumber
+}
+
+// Returns the line number of the last instruction of the block
+func (b *Block) LastLine() int {
+	return b.code[len(b.code)-1].Linenumber
+}
+
+// Returns the instructions of the block as written in source code, like "push LOOP"
+func (b *Block) Instructions() []string {
+	var code []string
+	for _, c := range b.code {
+		code = append(code, c.Instruction.String())
+	}
+	return code
+}
+
+// Returns the name of the block, which is its first label, or its first line number if there is no label
+func (b *Block) Name() string {
+	if len(b.Labels) > 0 {
+		return b.Labels[0]
+	}
+	return fmt.Sprintf("line %d", b.FirstLine())
+}
+
+// Returns the name of the node the edge leads to
+func (e *Edge) target() string {
+	if e.To != nil {
+		return e.To.Name()
+	}
+	if e.Kind == EdgeUnknown {
+		return graphUnknownNode
+	}
+	if e.Kind == EdgeReturn {
+		return graphReturnNode
+	}
+	return graphEndNode
+}
+
+// Returns the graph in the DOT language of Graphviz
+func (g *Graph) DOT() string {
+	var dot strings.Builder
+	dot.WriteString("digraph program {\n")
+	dot.WriteString("\tnode [shape=box, fontname=\"monospace\"];\n")
+
+	// Every block is a node, showing its labels and instructions
+	var endReached, unknownReached, returnReached bool
+	for _, block := range g.Blocks {
+		var label strings.Builder
+		for _, l := range block.Labels {
+			label.WriteString(fmt.Sprintf("%s:\\l", l))
+		}
+		for i, code := range block.Instructions() {
+			label.WriteString(fmt.Sprintf("%d: %s\\l", block.code[i].Linenumber, code))
+		}
+		dot.WriteString(fmt.Sprintf("\t%q [label=\"%s\"];\n", block.Name(), label.String()))
+
+		for _, edge := range block.Successors {
+			endReached = endReached || edge.target() == graphEndNode
+			unknownReached = unknownReached || edge.target() == graphUnknownNode
+			returnReached = returnReached || edge.target() == graphReturnNode
+		}
+	}
+	if endReached {
+		dot.WriteString(fmt.Sprintf("\t%q [shape=doublecircle, label=\"end\"];\n", graphEndNode))
+	}
+	if unknownReached {
+		dot.WriteString(fmt.Sprintf("\t%q [shape=diamond, label=\"?\"];\n", graphUnknownNode))
+	}
+	if returnReached {
+		dot.WriteString(fmt.Sprintf("\t%q [shape=circle, label=\"ret\"];\n", graphReturnNode))
+	}
+
+	// And connect them, with a style depending on the kind of edge
+	styles := map[EdgeKind]string{
+		EdgeFallthrough:   "",
+		EdgeConditional:   " [label=\"jmpc\"]",
+		EdgeUnconditional: " [label=\"jmp\", style=bold]",
+		EdgeUnknown:       " [style=dashed]",
+		EdgeCall:          " [label=\"call\", style=bold]",
+		EdgeReturn:        " [style=dotted]",
+	}
+	for _, block := range g.Blocks {
+		for _, edge := range block.Successors {
+			dot.WriteString(fmt.Sprintf("\t%q -> %q%s;\n", block.Name(), edge.target(), styles[edge.Kind]))
+		}
+	}
+
+	dot.WriteString("}\n")
+	return dot.String()
+}
+
+// Returns the graph as JSON object, with a list of blocks and a list of edges
+func (g *Graph) JSON() ([]byte, error) {
+	export := struct {
+		Blocks []jsonBlock `json:"blocks"`
+		Edges  []jsonEdge  `json:"edges"`
+	}{
+		Blocks: []jsonBlock{},
+		Edges:  []jsonEdge{},
+	}
+
+	for _, block := range g.Blocks {
+		exportBlock := jsonBlock{
+			Name:   block.Name(),
+			Labels: block.Labels,
+		}
+		for i, code := range block.Instructions() {
+			exportBlock.Instructions = append(exportBlock.Instructions, jsonInstruction{
+				Line: block.code[i].Linenumber,
+				Code: code,
+			})
+		}
+		export.Blocks = append(export.Blocks, exportBlock)
+
+		for _, edge := range block.Successors {
+			export.Edges = append(export.Edges, jsonEdge{
+				From: block.Name(),
+				To:   edge.target(),
+				Kind: edge.Kind.String(),
+			})
+		}
+	}
+
+	return json.MarshalIndent(export, "", "\t")
+}
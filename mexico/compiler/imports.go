@@ -0,0 +1,45 @@
+package compiler
+
+import (
+	"strings"
+)
+
+// Collects the imported libraries, mapping the names they are imported as to their domains
+func collectImports(program *Program, diagnostics *Diagnostics) map[string]string {
+	imports := make(map[string]string)
+	definitions := make(map[string]*Directive)
+	for _, s := range program.Statements {
+		directive, isDirective := s.(*Directive)
+		if !isDirective || directive.Name != "import" {
+			continue
+		}
+
+		domain := strings.TrimSuffix(directive.Arguments[0].Text, ".") + "."
+		alias := directive.Arguments[1]
+		if previous, isDefined := definitions[alias.Text]; isDefined {
+			diagnostics.errorf(alias.Pos(), "A library is already imported as '%s' at %s", alias.Text, previous.Pos().String())
+			continue
+		}
+		definitions[alias.Text] = directive
+		imports[alias.Text] = domain
+	}
+	return imports
+}
+
+// Warns about libraries which are imported, but none of their labels is ever used
+func checkImports(program *Program, imports map[string]string, diagnostics *Diagnostics) {
+	used := make(map[string]bool)
+	for _, s := range program.Statements {
+		if instruction, isInstruction := s.(*Instruction); isInstruction && instruction.Argument != nil {
+			used[instruction.Argument.Import] = true
+		}
+	}
+
+	for _, s := range program.Statements {
+		if directive, isDirective := s.(*Directive); isDirective && directive.Name == "import" {
+			if alias := directive.Arguments[1]; !used[alias.Text] {
+				diagnostics.warnf(alias.Pos(), "Library '%s' is imported, but never used", alias.Text)
+			}
+		}
+	}
+}
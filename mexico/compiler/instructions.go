@@ -0,0 +1,82 @@
+package compiler
+
+// Properties of an instruction of the language
+type instructionSpec struct {
+	// Number of arguments the instruction takes in the source code
+	Arguments int
+
+	// Number of values the instruction pops off the stack
+	Consumes int
+
+	// Number of values the instruction pushes to the stack
+	Pushes int
+
+	// Whether the argument is a position on the stack, like in "pick 2". The instruction then reaches that much deeper
+	// into the stack, so it consumes and pushes as many values more. Such arguments are non-negative numbers.
+	Depth bool
+
+	// Whether the instruction consumes a number of values only known while running the program, like printstr.
+	// Consumes is the least number of values it needs then.
+	Variable bool
+}
+
+var (
+	// All instructions of the language, as understood by the interpreter
+	instructions = map[string]instructionSpec{
+		"left":     {},
+		"right":    {},
+		"pusht":    {Pushes: 1},
+		"push":     {Arguments: 1, Pushes: 1},
+		"pop":      {Consumes: 1},
+		"dup":      {Consumes: 1, Pushes: 2},
+		"del":      {Consumes: 1},
+		"eq":       {Consumes: 2, Pushes: 1},
+		"not":      {Consumes: 1, Pushes: 1},
+		"gt":       {Consumes: 2, Pushes: 1},
+		"lt":       {Consumes: 2, Pushes: 1},
+		"add":      {Consumes: 2, Pushes: 1},
+		"sub":      {Consumes: 2, Pushes: 1},
+		"mult":     {Consumes: 2, Pushes: 1},
+		"div":      {Consumes: 2, Pushes: 1},
+		"mod":      {Consumes: 2, Pushes: 1},
+		"and":      {Consumes: 2, Pushes: 1},
+		"or":       {Consumes: 2, Pushes: 1},
+		"xor":      {Consumes: 2, Pushes: 1},
+		"shl":      {Consumes: 2, Pushes: 1},
+		"shr":      {Consumes: 2, Pushes: 1},
+		"pow":      {Consumes: 2, Pushes: 1},
+		"min":      {Consumes: 2, Pushes: 1},
+		"max":      {Consumes: 2, Pushes: 1},
+		"neg":      {Consumes: 1, Pushes: 1},
+		"abs":      {Consumes: 1, Pushes: 1},
+		"lnot":     {Consumes: 1, Pushes: 1},
+		"read":     {Pushes: 1},
+		"print":    {Consumes: 1},
+		"printnum": {Consumes: 1},
+		"readnum":  {Pushes: 1},
+		"printstr": {Consumes: 1, Variable: true},
+		"jmp":      {Consumes: 1},
+		"jmpc":     {Consumes: 2},
+		"call":     {Consumes: 1},
+		"ret":      {},
+		"swap":     {Consumes: 2, Pushes: 2},
+		"over":     {Consumes: 2, Pushes: 3},
+		"rot":      {Consumes: 3, Pushes: 3},
+		"pick":     {Arguments: 1, Consumes: 1, Pushes: 2, Depth: true},
+		"roll":     {Arguments: 1, Consumes: 1, Pushes: 1, Depth: true},
+	}
+
+	// All directives to the compiler, mapped to the function parsing their arguments
+	directives = map[string]func(p *parser, name token) (*Directive, *Diagnostic){
+		"import": (*parser).importDirective,
+	}
+)
+
+// Returns the number of values the instruction pops off the stack, and the number of values it pushes afterwards
+func stackEffect(instruction *Instruction) (int, int) {
+	spec := instructions[instruction.Name]
+	if spec.Depth && instruction.Argument != nil {
+		return spec.Consumes + instruction.Argument.Value, spec.Pushes + instruction.Argument.Value
+	}
+	return spec.Consumes, spec.Pushes
+}
@@ -0,0 +1,194 @@
+package compiler
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Kinds of tokens produced by the lexer
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenNewline
+	tokenIdentifier
+	tokenNumber
+	tokenColon
+	tokenAt
+	tokenComment
+	tokenIllegal
+)
+
+// A single token of the source code
+type token struct {
+	kind tokenKind
+	text string
+	pos  Position
+}
+
+// Splits source code up into tokens
+type lexer struct {
+	source []rune
+	offset int
+	pos    Position
+}
+
+// Splits the given source code into tokens. The list always ends with an EOF token.
+func lex(source string, file string) []token {
+	l := lexer{
+		source: []rune(source),
+		pos: Position{
+			File:   file,
+			Line:   1,
+			Column: 1,
+		},
+	}
+
+	var tokens []token
+	for {
+		t := l.next()
+		tokens = append(tokens, t)
+		if t.kind == tokenEOF {
+			return tokens
+		}
+	}
+}
+
+// Returns the next token, skipping whitespace
+func (l *lexer) next() token {
+	// Skip whitespace, except for newlines - they end statements
+	for l.offset < len(l.source) && l.peek(0) != '\n' && unicode.IsSpace(l.peek(0)) {
+		l.advance()
+	}
+
+	start := l.pos
+	if l.offset >= len(l.source) {
+		return token{
+			kind: tokenEOF,
+			pos:  start,
+		}
+	}
+
+	c := l.peek(0)
+	switch {
+	case c == '\n':
+		l.advance()
+		return token{
+			kind: tokenNewline,
+			text: "\n",
+			pos:  start,
+		}
+	case c == ':':
+		l.advance()
+		return token{
+			kind: tokenColon,
+			text: ":",
+			pos:  start,
+		}
+	case c == '@':
+		l.advance()
+		return token{
+			kind: tokenAt,
+			text: "@",
+			pos:  start,
+		}
+	case c == '#' || c == ';' || (c == '/' && l.peek(1) == '/'):
+		// Comments run until the end of the line
+		text := l.consume(func(c rune) bool {
+			return c != '\n'
+		})
+		return token{
+			kind: tokenComment,
+			text: strings.TrimRight(text, " \t\r"),
+			pos:  start,
+		}
+	case isDigit(c) || ((c == '-' || c == '+') && isDigit(l.peek(1))):
+		// Numbers may carry a sign
+		sign := ""
+		if c == '-' || c == '+' {
+			sign = string(c)
+			l.advance()
+		}
+		digits := l.consume(isIdentifierPart)
+		kind := tokenNumber
+		for _, d := range digits {
+			if !isDigit(d) {
+				// Something like "12abc"
+				kind = tokenIllegal
+			}
+		}
+		return token{
+			kind: kind,
+			text: sign + digits,
+			pos:  start,
+		}
+	case isIdentifierStart(c):
+		return token{
+			kind: tokenIdentifier,
+			text: l.consume(isIdentifierPart),
+			pos:  start,
+		}
+	}
+
+	// Not a character we expect in source code at all
+	l.advance()
+	return token{
+		kind: tokenIllegal,
+		text: string(c),
+		pos:  start,
+	}
+}
+
+// Returns the character at the given distance from the current offset, or 0 if it's beyond the end
+func (l *lexer) peek(distance int) rune {
+	if l.offset+distance >= len(l.source) {
+		return 0
+	}
+	return l.source[l.offset+distance]
+}
+
+// Moves on to the next character, keeping track of the position
+func (l *lexer) advance() {
+	if l.source[l.offset] == '\n' {
+		l.pos.Line++
+		l.pos.Column = 1
+	} else {
+		l.pos.Column++
+	}
+	l.offset++
+}
+
+// Consumes characters as long as they match, and returns them
+func (l *lexer) consume(matches func(rune) bool) string {
+	start := l.offset
+	for l.offset < len(l.source) && matches(l.peek(0)) {
+		l.advance()
+	}
+	return string(l.source[start:l.offset])
+}
+
+// Checks if the character is an ASCII digit
+func isDigit(c rune) bool {
+	return c >= '0' && c <= '9'
+}
+
+// Checks if the character may start an identifier, i.e. an instruction, label or directive name
+func isIdentifierStart(c rune) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_'
+}
+
+// Checks if the character may be part of an identifier. Dots and minus signs are allowed for domain names, and
+// for labels of imported libraries like "LIB.ROUTINE" - the parser checks where they are actually allowed.
+func isIdentifierPart(c rune) bool {
+	return isIdentifierStart(c) || isDigit(c) || c == '.' || c == '-'
+}
+
+// Checks if the identifier is a plain name, made of letters, digits and underscores only
+func isPlainName(identifier string) bool {
+	for _, c := range identifier {
+		if !isIdentifierStart(c) && !isDigit(c) {
+			return false
+		}
+	}
+	return true
+}
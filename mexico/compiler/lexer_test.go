@@ -0,0 +1,48 @@
+package compiler
+
+import (
+	"testing"
+)
+
+func TestLex(t *testing.T) {
+	tokens := lex("@100 LOOP: push -5 # count\n\tpush LIB.Square\n12abc $", "test.mxc")
+
+	want := []token{
+		{tokenAt, "@", Position{"test.mxc", 1, 1}},
+		{tokenNumber, "100", Position{"test.mxc", 1, 2}},
+		{tokenIdentifier, "LOOP", Position{"test.mxc", 1, 6}},
+		{tokenColon, ":", Position{"test.mxc", 1, 10}},
+		{tokenIdentifier, "push", Position{"test.mxc", 1, 12}},
+		{tokenNumber, "-5", Position{"test.mxc", 1, 17}},
+		{tokenComment, "# count", Position{"test.mxc", 1, 20}},
+		{tokenNewline, "\n", Position{"test.mxc", 1, 27}},
+		{tokenIdentifier, "push", Position{"test.mxc", 2, 2}},
+		{tokenIdentifier, "LIB.Square", Position{"test.mxc", 2, 7}},
+		{tokenNewline, "\n", Position{"test.mxc", 2, 17}},
+		{tokenIllegal, "12abc", Position{"test.mxc", 3, 1}},
+		{tokenIllegal, "$", Position{"test.mxc", 3, 7}},
+		{tokenEOF, "", Position{"test.mxc", 3, 8}},
+	}
+	if len(tokens) != len(want) {
+		t.Fatalf("Got %d tokens %v, want %d", len(tokens), tokens, len(want))
+	}
+	for i := range want {
+		if tokens[i] != want[i] {
+			t.Errorf("Token %d: got %+v, want %+v", i, tokens[i], want[i])
+		}
+	}
+}
+
+func TestLexComments(t *testing.T) {
+	for _, source := range []string{"# comment", "; comment", "// comment"} {
+		tokens := lex(source+" \r", "")
+		if len(tokens) != 2 || tokens[0].kind != tokenComment || tokens[0].text != source {
+			t.Errorf("%q: got tokens %+v, want a single comment", source, tokens)
+		}
+	}
+
+	// A single slash is no comment
+	if tokens := lex("/ comment", ""); tokens[0].kind != tokenIllegal {
+		t.Errorf("'/ comment': got %+v, want an illegal token first", tokens[0])
+	}
+}
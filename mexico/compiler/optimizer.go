@@ -0,0 +1,231 @@
+package compiler
+
+import (
+	"github.com/maride/mexico/mexigo/interpreter"
+	"strconv"
+)
+
+// A peephole rule. It checks the instructions at the start of the window, and returns how many of them it replaces, and by what.
+type peepholeRule func(window []*Instruction) (int, []*Instruction)
+
+// The peephole rules, tried in this order on every instruction
+var peepholeRules = []peepholeRule{
+	foldConstants,
+	removeNoOperations,
+}
+
+// Removes and folds instruction sequences with no or a constant effect. Labels are kept pointing to the same instruction,
+// or to the one following it if it was removed. Programs jumping to line numbers instead of labels can't be optimized,
+// as the line numbers change. Returns the number of removed instructions.
+func optimize(layout *codeLayout, diagnostics *Diagnostics) int {
+	for i, e := range layout.entries {
+		if isJump(e.instruction) && (i == 0 || !isLabelPush(layout.entries[i-1].instruction)) {
+			diagnostics.warnf(e.instruction.Pos(), "Target of '%s' is not a label, skipping optimization as it would move the target", e.instruction.Name)
+			return 0
+		}
+	}
+
+	// Apply the rules until none of them matches anymore - folding may create new opportunities
+	count := len(layout.entries)
+	for changed := true; changed; {
+		changed = false
+		for i := 0; i < len(layout.entries); i++ {
+			// Windows may only span instructions without labels, except for the first one - there may be jumps into it otherwise
+			var window []*Instruction
+			for j := i; j < len(layout.entries) && (j == i || len(layout.entries[j].labels) == 0); j++ {
+				window = append(window, layout.entries[j].instruction)
+			}
+
+			for _, rule := range peepholeRules {
+				replaced, replacement := rule(window)
+				if replaced == 0 || (len(replacement) == 0 && layout.entries[i].isPinned()) {
+					// Pinned instructions are kept, their labels would pin the following one otherwise
+					continue
+				}
+				layout.replace(i, replaced, replacement)
+				changed = true
+				break
+			}
+		}
+	}
+	return count - len(layout.entries)
+}
+
+// Replaces the given number of entries at the index. Labels of removed entries move on to the next remaining one.
+func (l *codeLayout) replace(index int, count int, replacement []*Instruction) {
+	labels := l.entries[index].labels
+	var replaced []codeEntry
+	for _, instruction := range replacement {
+		replaced = append(replaced, codeEntry{
+			instruction: instruction,
+		})
+	}
+
+	l.entries = append(append(append([]codeEntry{}, l.entries[:index]...), replaced...), l.entries[index+count:]...)
+	if index < len(l.entries) {
+		l.entries[index].labels = append(labels, l.entries[index].labels...)
+	} else {
+		l.trailingLabels = append(labels, l.trailingLabels...)
+	}
+}
+
+// Folds operations on constants into a single push, like "push 2; push 3; add" into "push 5", or "push 1; not" into "push 0"
+func foldConstants(window []*Instruction) (int, []*Instruction) {
+	if len(window) >= 2 && isConstant(window[0]) {
+		value := window[0].Argument.Value
+		switch window[1].Name {
+		case "not":
+			if value == 0 || value == 1 {
+				return 2, []*Instruction{constant(window[0], 1-value)}
+			}
+		case "lnot":
+			return 2, []*Instruction{constant(window[0], boolToInt(value == 0))}
+		case "neg":
+			return 2, []*Instruction{constant(window[0], -value)}
+		case "abs":
+			if value < 0 {
+				value = -value
+			}
+			return 2, []*Instruction{constant(window[0], value)}
+		}
+	}
+
+	if len(window) < 3 || !isConstant(window[0]) || !isConstant(window[1]) {
+		return 0, nil
+	}
+
+	// Just like the interpreter, stack[0] is the value pushed last
+	stack0 := window[1].Argument.Value
+	stack1 := window[0].Argument.Value
+	var result int
+	switch window[2].Name {
+	case "add":
+		result = stack0 + stack1
+	case "sub":
+		result = stack0 - stack1
+	case "mult":
+		result = stack0 * stack1
+	case "div", "mod":
+		if stack1 == 0 {
+			// Leave this crash to the interpreter
+			return 0, nil
+		}
+		if window[2].Name == "div" {
+			result = stack0 / stack1
+		} else {
+			result = stack0 % stack1
+		}
+	case "eq":
+		result = boolToInt(stack0 == stack1)
+	case "gt":
+		result = boolToInt(stack0 > stack1)
+	case "lt":
+		result = boolToInt(stack0 < stack1)
+	case "and":
+		result = stack0 & stack1
+	case "or":
+		result = stack0 | stack1
+	case "xor":
+		result = stack0 ^ stack1
+	case "shl", "shr", "pow":
+		if stack1 < 0 {
+			// Leave this error to the interpreter
+			return 0, nil
+		}
+		switch window[2].Name {
+		case "shl":
+			result = stack0 << uint(stack1)
+		case "shr":
+			result = stack0 >> uint(stack1)
+		default:
+			result = interpreter.Power(stack0, stack1)
+		}
+	case "min":
+		result = stack0
+		if stack1 < stack0 {
+			result = stack1
+		}
+	case "max":
+		result = stack0
+		if stack1 > stack0 {
+			result = stack1
+		}
+	default:
+		return 0, nil
+	}
+	return 3, []*Instruction{constant(window[0], result)}
+}
+
+// Removes sequences without any effect, like "dup; del", "push 0; add", "push 1; mult" or "neg; neg". "not" fails on
+// values other than 0 and 1, so "not; not" is only removed right after an instruction pushing either of them, like "eq".
+func removeNoOperations(window []*Instruction) (int, []*Instruction) {
+	if len(window) < 2 {
+		return 0, nil
+	}
+	if len(window) >= 3 && isBoolean(window[0]) && window[1].Name == "not" && window[2].Name == "not" {
+		return 3, []*Instruction{window[0]}
+	}
+
+	first, second := window[0], window[1]
+	switch {
+	case first.Name == "dup" && second.Name == "del":
+	case isConstant(first) && second.Name == "del":
+	case isConstant(first) && first.Argument.Value == 0 && second.Name == "add":
+	case isConstant(first) && first.Argument.Value == 1 && second.Name == "mult":
+	case first.Name == "neg" && second.Name == "neg":
+	case isConstant(first) && first.Argument.Value == 0 && (second.Name == "or" || second.Name == "xor"):
+	default:
+		return 0, nil
+	}
+	return 2, nil
+}
+
+// Checks if any label pins the line number of the entry
+func (e codeEntry) isPinned() bool {
+	for _, label := range e.labels {
+		if label.Pinned {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks if the instruction pushes either 0 or 1
+func isBoolean(instruction *Instruction) bool {
+	switch instruction.Name {
+	case "eq", "gt", "lt", "not", "lnot":
+		return true
+	}
+	return isConstant(instruction) && (instruction.Argument.Value == 0 || instruction.Argument.Value == 1)
+}
+
+// Checks if the instruction pushes a label
+func isLabelPush(instruction *Instruction) bool {
+	return instruction.Name == "push" && instruction.Argument.IsLabel
+}
+
+// Checks if the instruction pushes a constant, rather than a label
+func isConstant(instruction *Instruction) bool {
+	return instruction.Name == "push" && !instruction.Argument.IsLabel
+}
+
+// Builds an instruction pushing the given value, placed at the position of the given instruction
+func constant(at *Instruction, value int) *Instruction {
+	return &Instruction{
+		Position: at.Position,
+		Name:     "push",
+		Argument: &Argument{
+			Position: at.Argument.Position,
+			Text:     strconv.Itoa(value),
+			Value:    value,
+		},
+	}
+}
+
+// Converts a boolean into 1 or 0, like the comparison instructions do
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
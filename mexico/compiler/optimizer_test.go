@@ -0,0 +1,109 @@
+package compiler
+
+import (
+	"fmt"
+	"github.com/maride/mexico/mexigo/interpreter"
+	"strconv"
+	"testing"
+)
+
+// Builds an instruction pushing the given value
+func push(value int) *Instruction {
+	return &Instruction{
+		Name: "push",
+		Argument: &Argument{
+			Text:  strconv.Itoa(value),
+			Value: value,
+		},
+	}
+}
+
+// Runs "push first; push second; <name>" on the interpreter, and returns the value it leaves on the stack
+func interpret(first int, second int, name string) (int, error) {
+	var m interpreter.Machine
+	for _, cmd := range []string{fmt.Sprintf("push %d", first), fmt.Sprintf("push %d", second), name} {
+		if _, _, execErr := m.RunCommand(cmd); execErr != nil {
+			return 0, execErr
+		}
+	}
+	return m.Stack.Pop()
+}
+
+func TestFoldConstantsMatchesInterpreter(t *testing.T) {
+	operations := []string{"add", "sub", "mult", "div", "mod", "eq", "gt", "lt", "and", "or", "xor", "shl", "shr", "pow", "min", "max"}
+	values := []int{-7, -2, -1, 0, 1, 3, 10}
+
+	for _, name := range operations {
+		for _, first := range values {
+			for _, second := range values {
+				window := []*Instruction{push(first), push(second), {Name: name}}
+				count, replacement := foldConstants(window)
+
+				want, execErr := interpret(first, second, name)
+				if execErr != nil {
+					// Errors are left to the interpreter
+					if count != 0 {
+						t.Errorf("push %d; push %d; %s: folded, but the interpreter fails with: %s", first, second, name, execErr.Error())
+					}
+					continue
+				}
+
+				if count != 3 || len(replacement) != 1 {
+					t.Errorf("push %d; push %d; %s: not folded", first, second, name)
+					continue
+				}
+				if got := replacement[0].Argument.Value; got != want {
+					t.Errorf("push %d; push %d; %s: folded into push %d, but the interpreter leaves %d", first, second, name, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestFoldUnaryConstants(t *testing.T) {
+	tests := []struct {
+		value int
+		name  string
+		want  int
+	}{
+		{0, "not", 1},
+		{1, "not", 0},
+		{0, "lnot", 1},
+		{-5, "lnot", 0},
+		{-5, "neg", 5},
+		{-5, "abs", 5},
+		{5, "abs", 5},
+	}
+
+	for _, test := range tests {
+		count, replacement := foldConstants([]*Instruction{push(test.value), {Name: test.name}})
+		if count != 2 || len(replacement) != 1 || replacement[0].Argument.Value != test.want {
+			t.Errorf("push %d; %s: got %d, %v, want push %d", test.value, test.name, count, replacement, test.want)
+		}
+	}
+
+	// not fails on values other than 0 and 1, so that's left to the interpreter
+	if count, _ := foldConstants([]*Instruction{push(2), {Name: "not"}}); count != 0 {
+		t.Errorf("push 2; not: folded, but the interpreter fails on it")
+	}
+}
+
+func TestRemoveDoubleNot(t *testing.T) {
+	tests := []struct {
+		first   *Instruction
+		removed bool
+	}{
+		{&Instruction{Name: "eq"}, true},
+		{&Instruction{Name: "lnot"}, true},
+		{push(1), true},
+		{push(5), false},
+		{&Instruction{Name: "add"}, false},
+	}
+
+	for _, test := range tests {
+		count, _ := removeNoOperations([]*Instruction{test.first, {Name: "not"}, {Name: "not"}})
+		if removed := count == 3; removed != test.removed {
+			t.Errorf("%s; not; not: removed is %t, want %t", test.first.Name, removed, test.removed)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package compiler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Builds the AST of a program from its tokens
+type parser struct {
+	tokens      []token
+	offset      int
+	diagnostics Diagnostics
+}
+
+// Parses the given source code into its AST. The file name is only used for positions, and may be empty.
+// Parsing doesn't stop at the first error: lines with errors are skipped, and all errors are returned as diagnostics.
+func Parse(source string, file string) (*Program, Diagnostics) {
+	p := parser{
+		tokens: lex(source, file),
+	}
+
+	var program Program
+	for p.peek().kind != tokenEOF {
+		statements, statementErr := p.line()
+		if statementErr != nil {
+			// Note the error, and continue with the next line
+			p.diagnostics = append(p.diagnostics, *statementErr)
+			p.skipLine()
+			continue
+		}
+		program.Statements = append(program.Statements, statements...)
+	}
+	return &program, p.diagnostics
+}
+
+// Parses a single line, which may hold a label, an instruction or directive, and a comment - in this order, and each of them optional
+func (p *parser) line() ([]Statement, *Diagnostic) {
+	var statements []Statement
+
+	// Labels are identifiers followed by a colon, and may be pinned to a line number, like "@100 LOOP:"
+	if p.peek().kind == tokenAt {
+		label, labelErr := p.pinnedLabel()
+		if labelErr != nil {
+			return nil, labelErr
+		}
+		statements = append(statements, label)
+	} else if p.peek().kind == tokenIdentifier && p.peekAt(1).kind == tokenColon {
+		name := p.take()
+		p.take()
+		if !isPlainName(name.text) {
+			return nil, newError(name.pos, "Label name '%s' may only consist of letters, digits and underscores", name.text)
+		}
+		statements = append(statements, &Label{
+			Position: name.pos,
+			Name:     name.text,
+		})
+	}
+
+	// Instructions and directives start with an identifier as well
+	if p.peek().kind == tokenIdentifier {
+		statement, statementErr := p.instructionOrDirective()
+		if statementErr != nil {
+			return nil, statementErr
+		}
+		statements = append(statements, statement)
+	}
+
+	// Comments may follow everything
+	if p.peek().kind == tokenComment {
+		comment := p.take()
+		statements = append(statements, &Comment{
+			Position: comment.pos,
+			Text:     comment.text,
+		})
+	}
+
+	// And that's it, the line has to end here
+	switch t := p.peek(); t.kind {
+	case tokenNewline:
+		p.take()
+	case tokenEOF:
+	default:
+		return nil, unexpected(t, "end of line")
+	}
+	return statements, nil
+}
+
+// Parses a label pinned to a line number, like "@100 LOOP:"
+func (p *parser) pinnedLabel() (*Label, *Diagnostic) {
+	p.take()
+	number := p.peek()
+	if number.kind != tokenNumber {
+		return nil, unexpected(number, "a line number after '@'")
+	}
+	p.take()
+	linenumber, atoiErr := strconv.Atoi(number.text)
+	if atoiErr != nil || linenumber < 0 {
+		return nil, newError(number.pos, "Line number '%s' is out of range", number.text)
+	}
+
+	if p.peek().kind != tokenIdentifier || p.peekAt(1).kind != tokenColon {
+		return nil, unexpected(p.peek(), "a label to pin to line "+number.text)
+	}
+	name := p.take()
+	p.take()
+	if !isPlainName(name.text) {
+		return nil, newError(name.pos, "Label name '%s' may only consist of letters, digits and underscores", name.text)
+	}
+	return &Label{
+		Position:   name.pos,
+		Name:       name.text,
+		Pinned:     true,
+		Linenumber: linenumber,
+	}, nil
+}
+
+// Parses an instruction or directive, including its arguments
+func (p *parser) instructionOrDirective() (Statement, *Diagnostic) {
+	name := p.take()
+
+	if spec, isInstruction := instructions[name.text]; isInstruction {
+		instruction := Instruction{
+			Position: name.pos,
+			Name:     name.text,
+		}
+		if spec.Arguments > 0 {
+			argument, argumentErr := p.argument(name.text)
+			if argumentErr != nil {
+				return nil, argumentErr
+			}
+			if spec.Depth && (argument.IsLabel || argument.Value < 0) {
+				return nil, newError(argument.Pos(), "'%s' takes a position on the stack, like 0 for the topmost value, but got '%s'", name.text, argument.Text)
+			}
+			instruction.Argument = argument
+		}
+		return &instruction, nil
+	}
+
+	if parseDirective, isDirective := directives[name.text]; isDirective {
+		return parseDirective(p, name)
+	}
+
+	return nil, newError(name.pos, "Unknown instruction '%s'", name.text)
+}
+
+// Parses the import of a library, like "import other.domain as LIB"
+func (p *parser) importDirective(name token) (*Directive, *Diagnostic) {
+	domain := p.peek()
+	if domain.kind != tokenIdentifier {
+		return nil, unexpected(domain, "the domain of the library to import")
+	}
+	p.take()
+
+	if keyword := p.peek(); keyword.kind != tokenIdentifier || keyword.text != "as" {
+		return nil, unexpected(keyword, "'as' followed by the name to import the library as")
+	}
+	p.take()
+
+	alias := p.peek()
+	if alias.kind != tokenIdentifier || !isPlainName(alias.text) {
+		return nil, unexpected(alias, "the name to import the library as")
+	}
+	p.take()
+
+	return &Directive{
+		Position: name.pos,
+		Name:     name.text,
+		Arguments: []*Argument{
+			{
+				Position: domain.pos,
+				Text:     domain.text,
+			},
+			{
+				Position: alias.pos,
+				Text:     alias.text,
+			},
+		},
+	}, nil
+}
+
+// Parses the argument of the given instruction or directive, which is either a number or a label name
+func (p *parser) argument(of string) (*Argument, *Diagnostic) {
+	t := p.peek()
+	switch t.kind {
+	case tokenNumber:
+		p.take()
+		value, atoiErr := strconv.Atoi(t.text)
+		if atoiErr != nil {
+			return nil, newError(t.pos, "Number '%s' is out of range", t.text)
+		}
+		return &Argument{
+			Position: t.pos,
+			Text:     t.text,
+			Value:    value,
+		}, nil
+	case tokenIdentifier:
+		p.take()
+		argument := Argument{
+			Position: t.pos,
+			Text:     t.text,
+			IsLabel:  true,
+		}
+
+		// Labels of imported libraries are prefixed with the alias of the import, like "LIB.ROUTINE"
+		parts := strings.Split(t.text, ".")
+		if len(parts) == 2 && isPlainName(parts[0]) && isPlainName(parts[1]) && parts[0] != "" && parts[1] != "" {
+			argument.Import = parts[0]
+		} else if !isPlainName(t.text) {
+			return nil, newError(t.pos, "'%s' is neither a label nor a label of an imported library, like LIB.LABEL", t.text)
+		}
+		return &argument, nil
+	}
+	return nil, unexpected(t, fmt.Sprintf("a label or an integer constant as argument of '%s'", of))
+}
+
+// Skips all tokens up to and including the next newline
+func (p *parser) skipLine() {
+	for {
+		switch p.take().kind {
+		case tokenNewline, tokenEOF:
+			return
+		}
+	}
+}
+
+// Returns the current token without consuming it
+func (p *parser) peek() token {
+	return p.peekAt(0)
+}
+
+// Returns the token at the given distance from the current one without consuming it. Beyond the end, the EOF token is returned.
+func (p *parser) peekAt(distance int) token {
+	if p.offset+distance >= len(p.tokens) {
+		return p.tokens[len(p.tokens)-1]
+	}
+	return p.tokens[p.offset+distance]
+}
+
+// Consumes the current token and returns it
+func (p *parser) take() token {
+	t := p.peek()
+	if p.offset < len(p.tokens)-1 {
+		p.offset++
+	}
+	return t
+}
+
+// Builds an error for an unexpected token
+func unexpected(t token, expected string) *Diagnostic {
+	found := fmt.Sprintf("'%s'", t.text)
+	switch t.kind {
+	case tokenEOF:
+		found = "end of file"
+	case tokenNewline:
+		found = "end of line"
+	}
+	return newError(t.pos, "Expected %s, found %s", expected, found)
+}
@@ -0,0 +1,121 @@
+package compiler
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseLabels(t *testing.T) {
+	program, diagnostics := Parse("START:\nLOOP: push LOOP\n@100 FAR: jmp\n@0x: dup", "test.mxc")
+	if len(diagnostics) != 1 {
+		t.Fatalf("Got diagnostics %v, want a single error for '@0x'", diagnostics)
+	}
+
+	want := []Statement{
+		&Label{Position: Position{"test.mxc", 1, 1}, Name: "START"},
+		&Label{Position: Position{"test.mxc", 2, 1}, Name: "LOOP"},
+		&Instruction{
+			Position: Position{"test.mxc", 2, 7},
+			Name:     "push",
+			Argument: &Argument{Position: Position{"test.mxc", 2, 12}, Text: "LOOP", IsLabel: true},
+		},
+		&Label{Position: Position{"test.mxc", 3, 6}, Name: "FAR", Pinned: true, Linenumber: 100},
+		&Instruction{Position: Position{"test.mxc", 3, 11}, Name: "jmp"},
+	}
+	if !reflect.DeepEqual(program.Statements, want) {
+		t.Errorf("Got statements:")
+		for _, s := range program.Statements {
+			t.Errorf("  %+v", s)
+		}
+	}
+}
+
+func TestParseArguments(t *testing.T) {
+	program, diagnostics := Parse("push -5\npush +7\npush LIB.Square\npick 2", "")
+	if len(diagnostics) != 0 {
+		t.Fatalf("Got diagnostics %v", diagnostics)
+	}
+
+	want := []*Argument{
+		{Position: Position{"", 1, 6}, Text: "-5", Value: -5},
+		{Position: Position{"", 2, 6}, Text: "+7", Value: 7},
+		{Position: Position{"", 3, 6}, Text: "LIB.Square", IsLabel: true, Import: "LIB"},
+		{Position: Position{"", 4, 6}, Text: "2", Value: 2},
+	}
+	if len(program.Statements) != len(want) {
+		t.Fatalf("Got %d statements, want %d", len(program.Statements), len(want))
+	}
+	for i, s := range program.Statements {
+		if got := s.(*Instruction).Argument; !reflect.DeepEqual(got, want[i]) {
+			t.Errorf("Statement %d: got argument %+v, want %+v", i, got, want[i])
+		}
+	}
+}
+
+func TestParseImports(t *testing.T) {
+	program, diagnostics := Parse("import lib.mxc.example as LIB # squares\n", "")
+	if len(diagnostics) != 0 {
+		t.Fatalf("Got diagnostics %v", diagnostics)
+	}
+
+	want := []Statement{
+		&Directive{
+			Position: Position{"", 1, 1},
+			Name:     "import",
+			Arguments: []*Argument{
+				{Position: Position{"", 1, 8}, Text: "lib.mxc.example"},
+				{Position: Position{"", 1, 27}, Text: "LIB"},
+			},
+		},
+		&Comment{Position: Position{"", 1, 31}, Text: "# squares"},
+	}
+	if !reflect.DeepEqual(program.Statements, want) {
+		t.Errorf("Got statements %+v, want %+v", program.Statements, want)
+	}
+}
+
+func TestParseErrorPositions(t *testing.T) {
+	tests := []struct {
+		source  string
+		want    Position
+		message string
+	}{
+		{"pushx 5", Position{"t.mxc", 1, 1}, "Unknown instruction 'pushx'"},
+		{"dup\n  push", Position{"t.mxc", 2, 7}, "Expected a label or an integer constant as argument of 'push', found end of file"},
+		{"push 5 6", Position{"t.mxc", 1, 8}, "Expected end of line, found '6'"},
+		{"push 12abc", Position{"t.mxc", 1, 6}, "Expected a label or an integer constant as argument of 'push', found '12abc'"},
+		{"push 99999999999999999999", Position{"t.mxc", 1, 6}, "Number '99999999999999999999' is out of range"},
+		{"pick -1", Position{"t.mxc", 1, 6}, "'pick' takes a position on the stack, like 0 for the topmost value, but got '-1'"},
+		{"roll TOP", Position{"t.mxc", 1, 6}, "'roll' takes a position on the stack, like 0 for the topmost value, but got 'TOP'"},
+		{"push A.B.C", Position{"t.mxc", 1, 6}, "'A.B.C' is neither a label nor a label of an imported library, like LIB.LABEL"},
+		{"MY-LABEL: dup", Position{"t.mxc", 1, 1}, "Label name 'MY-LABEL' may only consist of letters, digits and underscores"},
+		{"@ LOOP: dup", Position{"t.mxc", 1, 3}, "Expected a line number after '@', found 'LOOP'"},
+		{"@-5 LOOP: dup", Position{"t.mxc", 1, 2}, "Line number '-5' is out of range"},
+		{"@5 dup", Position{"t.mxc", 1, 4}, "Expected a label to pin to line 5, found 'dup'"},
+		{"import lib.example LIB", Position{"t.mxc", 1, 20}, "Expected 'as' followed by the name to import the library as, found 'LIB'"},
+		{"import lib.example as L.B", Position{"t.mxc", 1, 23}, "Expected the name to import the library as, found 'L.B'"},
+		{"import 5 as LIB", Position{"t.mxc", 1, 8}, "Expected the domain of the library to import, found '5'"},
+	}
+
+	for _, test := range tests {
+		_, diagnostics := Parse(test.source, "t.mxc")
+		if len(diagnostics) != 1 {
+			t.Errorf("%q: got diagnostics %v, want a single error", test.source, diagnostics)
+			continue
+		}
+		d := diagnostics[0]
+		if d.Severity != SeverityError || d.Position != test.want || d.Message != test.message {
+			t.Errorf("%q: got %s at %s: %s, want error at %s: %s", test.source, d.Severity.String(), d.Position.String(), d.Message, test.want.String(), test.message)
+		}
+	}
+}
+
+func TestParseContinuesAfterErrors(t *testing.T) {
+	program, diagnostics := Parse("pushx 5\ndup\npush\nadd", "")
+	if len(diagnostics) != 2 || diagnostics[0].Line != 1 || diagnostics[1].Line != 3 {
+		t.Errorf("Got diagnostics %v, want errors in lines 1 and 3", diagnostics)
+	}
+	if len(program.Statements) != 2 || program.Statements[0].(*Instruction).Name != "dup" || program.Statements[1].(*Instruction).Name != "add" {
+		t.Errorf("Got statements %+v, want dup and add", program.Statements)
+	}
+}
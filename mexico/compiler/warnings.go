@@ -0,0 +1,128 @@
+package compiler
+
+import (
+	"fmt"
+)
+
+// Warns about labels which are defined, but never referenced. Labels of libraries are exported, so they are always used.
+func checkLabels(program *Program, options Options, diagnostics *Diagnostics) {
+	if options.Library {
+		return
+	}
+
+	// Collect all labels referenced in arguments
+	referenced := make(map[string]bool)
+	for _, s := range program.Statements {
+		var arguments []*Argument
+		switch statement := s.(type) {
+		case *Instruction:
+			arguments = append(arguments, statement.Argument)
+		case *Directive:
+			arguments = statement.Arguments
+		}
+		for _, argument := range arguments {
+			if argument != nil && argument.IsLabel {
+				referenced[argument.Text] = true
+			}
+		}
+	}
+
+	// And check every definition against them. Pinned labels are used to lay out the code, even if they are never referenced.
+	for _, s := range program.Statements {
+		if label, isLabel := s.(*Label); isLabel && !label.Pinned && !referenced[label.Name] {
+			diagnostics.warnf(label.Pos(), "Label '%s' is defined but never used", label.Name)
+		}
+	}
+}
+
+// Warns about instructions which can't be reached, because they follow an unconditional jump and no label points to them.
+// Jumps to computed line numbers may still reach them, hence this is only a warning.
+func checkReachability(program *Program, diagnostics *Diagnostics) {
+	var jump *Instruction
+	for _, s := range program.Statements {
+		switch statement := s.(type) {
+		case *Label:
+			// Code after a label may be jumped to
+			jump = nil
+		case *Instruction:
+			if jump != nil {
+				diagnostics.warnf(statement.Pos(), "Unreachable code after unconditional jump at %s", jump.Pos().String())
+
+				// Only warn once per block of unreachable code
+				jump = nil
+				continue
+			}
+			if statement.Name == "jmp" || statement.Name == "ret" {
+				jump = statement
+			}
+		}
+	}
+}
+
+// Checks if the line numbers fit into MX preferences. If the program is split into parts, every part needs to hold code,
+// as the interpreter stops loading parts at the first one without code. Jumps to constant line numbers beyond all
+// representable ones are reported as well - they simply end the program.
+// Programs run straight from the source code only need non-negative line numbers.
+func checkLinenumbers(code []numberedInstruction, options Options, diagnostics *Diagnostics) {
+	parts := make(map[int]bool)
+	lastPart := 0
+	for _, c := range code {
+		if c.Linenumber < 0 && options.Direct {
+			diagnostics.errorf(c.Instruction.Pos(), "Line number %d is negative, but line numbers below 0 are reserved for libraries", c.Linenumber)
+			return
+		}
+		if c.Linenumber < 0 {
+			diagnostics.errorf(c.Instruction.Pos(), "Line number %d is negative, but MX preferences can't be", c.Linenumber)
+			return
+		}
+		if options.Direct {
+			continue
+		}
+		if c.Linenumber > MaxLinenumber && !options.Split {
+			diagnostics.errorf(c.Instruction.Pos(), "Line number %d exceeds %d, the highest MX preference. Use a smaller line step, or split the program into parts", c.Linenumber, MaxLinenumber)
+			return
+		}
+		if c.Linenumber/PartSize >= MaxParts {
+			diagnostics.errorf(c.Instruction.Pos(), "Line number %d would go into %s, but programs can't be split into more than %d parts. Line numbers can't exceed %d", c.Linenumber, partName(c.Linenumber/PartSize, options), MaxParts, MaxParts*PartSize-1)
+			return
+		}
+		parts[c.Linenumber/PartSize] = true
+		lastPart = c.Linenumber / PartSize
+	}
+
+	// Report each run of parts without code once
+	for part := 0; part < lastPart; part++ {
+		if parts[part] {
+			continue
+		}
+		first := part
+		for part+1 < lastPart && !parts[part+1] {
+			part++
+		}
+		if first == part {
+			diagnostics.errorf(Position{File: options.File}, "No code in %s of the program, so the interpreter would stop loading parts there. Lines %d to %d need at least one instruction", partName(part, options), part*PartSize, part*PartSize+MaxLinenumber)
+		} else {
+			diagnostics.errorf(Position{File: options.File}, "No code in %s to %s of the program, so the interpreter would stop loading parts there. Lines %d to %d, %d to %d and so on each need at least one instruction", partName(first, options), partName(part, options), first*PartSize, first*PartSize+MaxLinenumber, (first+1)*PartSize, (first+1)*PartSize+MaxLinenumber)
+		}
+	}
+
+	for i, c := range code {
+		if !isJump(c.Instruction) || i == 0 || !isConstant(code[i-1].Instruction) {
+			continue
+		}
+		target := code[i-1].Instruction.Argument.Value
+		if target < 0 {
+			diagnostics.warnf(code[i-1].Instruction.Pos(), "Jump target %d is negative, but line numbers below 0 are reserved for libraries, so the jump fails", target)
+		} else if target > MaxLinenumber && !options.Split && !options.Direct {
+			diagnostics.warnf(code[i-1].Instruction.Pos(), "Jump target %d exceeds %d, the highest MX preference, so the jump ends the program", target, MaxLinenumber)
+		}
+	}
+}
+
+// Names the part of the program, together with its domain if the program is compiled for one
+func partName(part int, options Options) string {
+	if options.Domain == "" {
+		return fmt.Sprintf("part %d", part)
+	}
+	return fmt.Sprintf("part %d (%s)", part, PartDomain(options.Domain, part))
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/maride/mexico/dns"
+	"github.com/maride/mexico/loader"
+	"github.com/maride/mexico/mexico/compiler"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"log"
+	"os"
+)
+
+var (
+	decompileOutput *string
+	programDomain   *string
+	dnsServer       *string
+	useTCP          *bool
+)
+
+// Registers flags required for decompiling
+func registerDecompileFlags() {
+	decompileOutput = flag.String("output", "", "Name of the source code file to write, defaults to stdout")
+}
+
+// Registers flags required for loading compiled programs from a zonefile or the DNS
+func registerRecordFlags() {
+	programDomain = flag.String("domain", "", "The domain of the program to load from a zonefile, defaults to the origin of the zonefile")
+	dnsServer = flag.String("server", "", "DNS server to send queries to, as host[:port]. Defaults to the nameservers of the system")
+	useTCP = flag.Bool("tcp", false, "Send queries over TCP instead of UDP")
+}
+
+// Reconstructs the source code of a program, either from a zonefile or from the MX records of a domain
+func decompile() {
+	registerDecompileFlags()
+	registerRecordFlags()
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		log.Fatal("Please specify the zonefile or domain to decompile, like this: ./mexico decompile <zonefile|domain>")
+	}
+
+	program, loadErr := loadProgram(flag.Arg(0))
+	handleErr(loadErr)
+	source, decompileErr := compiler.Decompile(&program.Module)
+	handleErr(decompileErr)
+	source = fmt.Sprintf("// Decompiled from %s\n\n%s", flag.Arg(0), source)
+
+	if *decompileOutput == "" {
+		fmt.Print(source)
+		return
+	}
+	handleErr(ioutil.WriteFile(*decompileOutput, []byte(source), 0644))
+}
+
+// Loads a compiled program. Existing files are read as zonefile, everything else is looked up in the DNS.
+func loadProgram(origin string) (*loader.Program, error) {
+	if _, statErr := os.Stat(origin); statErr == nil {
+		return loadFromZonefile(origin, *programDomain)
+	}
+	return loadFromDNS(origin)
+}
+
+// Loads the program of the given domain from the zonefile
+func loadFromZonefile(path string, domain string) (*loader.Program, error) {
+	zone, readErr := dns.ReadZoneFile(path, "")
+	if readErr != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to read zonefile '%s': %s", path, readErr.Error()))
+	}
+
+	// Fall back to the origin of the zone if no domain was specified
+	if domain == "" {
+		if zone.Origin == "" {
+			return nil, errors.New(fmt.Sprintf("Zonefile '%s' has no origin, please specify the domain to decompile with -domain", path))
+		}
+		domain = zone.Origin
+	}
+	program, loadErr := loader.FromZone(zone, domain)
+	if loadErr != nil {
+		return nil, errors.New(fmt.Sprintf("%s in %s", loadErr.Error(), path))
+	}
+	return program, nil
+}
+
+// Looks up the program of the given domain
+func loadFromDNS(domain string) (*loader.Program, error) {
+	client := dns.Client{
+		Server: *dnsServer,
+		TCP:    *useTCP,
+	}
+
+	return loader.Load(domain, func(name string, rrType uint16) ([]dns.RR, error) {
+		response, queryErr := client.Query(name, rrType)
+		if queryErr != nil {
+			return nil, errors.New(fmt.Sprintf("Failed to resolve '%s': %s", name, queryErr.Error()))
+		}
+		if response.Rcode == dns.RcodeNameError {
+			return nil, nil
+		}
+		if response.Rcode != dns.RcodeSuccess {
+			return nil, errors.New(fmt.Sprintf("Failed to resolve '%s': %s answered with %s", name, response.Server, dns.RcodeToString(response.Rcode)))
+		}
+		return response.AnswersFor(name, rrType), nil
+	})
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"github.com/maride/mexico/dns"
+	"github.com/maride/mexico/loader"
+	"github.com/maride/mexico/mexico/compiler"
+	"strings"
+	"testing"
+)
+
+const (
+	// A library calling its own labels, which have to keep their names
+	squareLibrary = `Square:
+  dup
+  mult
+  ret
+Twice:
+  push Square
+  call
+  push Square
+  call
+  ret
+`
+
+	// A program calling the library, imported under a name which isn't all lowercase
+	importingProgram = `import lib.mxc.example as Lib
+
+  push 3
+  push Lib.Twice
+  call
+  print
+`
+)
+
+// Returns the records of the zone of the module, except the SOA record, whose serial depends on the time
+func zoneRecords(module *compiler.Module, domain string) []string {
+	var records []string
+	for _, r := range buildZone(module, domain).Records {
+		if r.Type != dns.TypeSOA {
+			records = append(records, r.String())
+		}
+	}
+	return records
+}
+
+func TestDecompileRoundTrip(t *testing.T) {
+	fibonacci, readErr := readFile("../examples/Fibonacci.mxc")
+	if readErr != nil {
+		t.Fatalf("Failed to read example: %s", readErr.Error())
+	}
+	helloWorld, readErr := readFile("../examples/HelloWorld.mxc")
+	if readErr != nil {
+		t.Fatalf("Failed to read example: %s", readErr.Error())
+	}
+
+	const domain = "prog.mxc.example."
+	tests := []struct {
+		name    string
+		source  string
+		options compiler.Options
+
+		// Whether the names in the MX records lose their case before decompiling, like they may in the DNS
+		lowercase bool
+	}{
+		{name: "Fibonacci", source: strings.Join(fibonacci, "\n")},
+		{name: "HelloWorld", source: strings.Join(helloWorld, "\n")},
+		{name: "line numbers", source: strings.Join(helloWorld, "\n"), options: compiler.Options{Start: 10, Step: 10}},
+		{name: "split", source: strings.Join(fibonacci, "\n"), options: compiler.Options{Start: compiler.PartSize - 5, Split: true}},
+		{name: "symbols", source: strings.Join(fibonacci, "\n"), options: compiler.Options{Symbols: true}},
+		{name: "library", source: squareLibrary, options: compiler.Options{Library: true}},
+		{name: "import", source: importingProgram},
+		{name: "import in lowercase", source: importingProgram, lowercase: true},
+	}
+
+	for _, test := range tests {
+		test.options.Domain = domain
+		module, diagnostics := compiler.CompileWithOptions(test.source, test.options)
+		if diagnostics.HasErrors() {
+			t.Fatalf("%s: Failed to compile: %v", test.name, diagnostics)
+		}
+
+		zone := buildZone(module, domain)
+		if test.lowercase {
+			for _, r := range zone.Records {
+				if mx, isMX := r.Data.(*dns.MX); isMX {
+					mx.Exchange = strings.ToLower(mx.Exchange)
+				}
+			}
+		}
+		program, loadErr := loader.FromZone(zone, domain)
+		if loadErr != nil {
+			t.Fatalf("%s: Failed to load: %s", test.name, loadErr.Error())
+		}
+		source, decompileErr := compiler.Decompile(&program.Module)
+		if decompileErr != nil {
+			t.Fatalf("%s: Failed to decompile: %s", test.name, decompileErr.Error())
+		}
+
+		recompiled, diagnostics := compiler.CompileWithOptions(source, test.options)
+		if diagnostics.HasErrors() {
+			t.Errorf("%s: Failed to compile the decompiled source code: %v\n%s", test.name, diagnostics, source)
+			continue
+		}
+
+		want, got := zoneRecords(module, domain), zoneRecords(recompiled, domain)
+		if len(got) != len(want) {
+			t.Errorf("%s: Got %d records, want %d:\n%s", test.name, len(got), len(want), source)
+			continue
+		}
+		for i := range want {
+			// Labels of libraries may lose their case, which doesn't matter when linking
+			if got[i] != want[i] && !(test.lowercase && strings.EqualFold(got[i], want[i])) {
+				t.Errorf("%s: Got record %s, want %s", test.name, got[i], want[i])
+			}
+		}
+	}
+}
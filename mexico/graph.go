@@ -0,0 +1,85 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/maride/mexico/mexico/compiler"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+)
+
+var (
+	graphFormat *string
+	graphOutput *string
+)
+
+// Registers flags required for exporting the control flow graph
+func registerGraphFlags() {
+	graphFormat = flag.String("format", "dot", "Format of the graph, either 'dot' (for Graphviz) or 'json'")
+	graphOutput = flag.String("output", "", "Name of the file to write the graph to, defaults to stdout")
+}
+
+// Exports the control flow graph of a program, either from source code, from a zonefile or from the MX records of a domain
+func graph() {
+	registerGraphFlags()
+	registerRecordFlags()
+	registerNumberingFlags()
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		log.Fatal("Please specify the source code file, zonefile or domain to export the graph of, like this: ./mexico graph <file.mxc|zonefile|domain>")
+	}
+
+	var g *compiler.Graph
+	var graphErr error
+	if origin := flag.Arg(0); strings.HasSuffix(strings.ToLower(origin), ".mxc") {
+		g, graphErr = graphFromFile(origin)
+	} else {
+		program, loadErr := loadProgram(origin)
+		handleErr(loadErr)
+		g, graphErr = compiler.GraphFromCode(program.Code)
+	}
+	handleErr(graphErr)
+
+	var exported []byte
+	switch *graphFormat {
+	case "dot":
+		exported = []byte(g.DOT())
+	case "json":
+		var jsonErr error
+		exported, jsonErr = g.JSON()
+		handleErr(jsonErr)
+		exported = append(exported, '\n')
+	default:
+		log.Fatalf("Unknown graph format '%s', please use 'dot' or 'json'", *graphFormat)
+	}
+
+	if *graphOutput == "" {
+		fmt.Print(string(exported))
+		return
+	}
+	handleErr(ioutil.WriteFile(*graphOutput, exported, 0644))
+}
+
+// Builds the control flow graph of the given source code file, reporting errors of the compiler to stderr
+func graphFromFile(path string) (*compiler.Graph, error) {
+	lines, readErr := readFile(path)
+	if readErr != nil {
+		return nil, readErr
+	}
+	source := strings.Join(lines, "\n")
+
+	g, diagnostics := compiler.GraphFromSource(source, compiler.Options{
+		File:  path,
+		Start: *lineStart,
+		Step:  *lineStep,
+	})
+	if diagnostics.HasErrors() {
+		fmt.Fprint(os.Stderr, diagnostics.Errors().Format(source))
+		return nil, errors.New(fmt.Sprintf("Failed to compile %s, found %d errors", path, len(diagnostics.Errors())))
+	}
+	return g, nil
+}
@@ -2,13 +2,20 @@ package main
 
 import (
 	"flag"
-	"fmt"
+	"github.com/maride/mexico/dns"
 	"github.com/maride/mexico/mexico/compiler"
 	"io/ioutil"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
 
+const (
+	// The TTL and SOA timer values used for generated zones
+	zoneTTL = 3600
+)
+
 var (
 	inputFilePath *string
 	outputFilePath *string
@@ -22,10 +29,10 @@ func registerIOFlags() {
 	baseDomain = flag.String("baseDomain", "mexico.invalid", "The base domain to write the zonefile for")
 }
 
-// Reads the input file, splits it at newlines, and returns it as a string array
-func readFile() ([]string, error) {
+// Reads the given file, splits it at newlines, and returns it as a string array
+func readFile(path string) ([]string, error) {
 	// Read file
-	fileBytes, readErr := ioutil.ReadFile(*inputFilePath)
+	fileBytes, readErr := ioutil.ReadFile(path)
 	if readErr != nil {
 		// Error reading the file, pass through
 		return nil, readErr
@@ -35,28 +42,142 @@ func readFile() ([]string, error) {
 	return strings.Split(string(fileBytes), "\n"), nil
 }
 
-// Writes the code lines into the format of a Zonefile
-func writeZone(code []compiler.Codeline) error {
-	var zone strings.Builder
-	domain := *baseDomain
-
+// Builds the records of a zone holding the given compiled program
+func buildZone(module *compiler.Module, domain string) *dns.Zone {
 	// Check if we need to append a dot to the end of the domain name
-	if (*baseDomain)[len(*baseDomain)-1] != '.' {
-		// No, append a dot
-		domain = *baseDomain + "."
-	}
+	domain = dns.Fqdn(domain)
 
 	// Generate values for further usage
-	serial := time.Now().Format("2006010215") // YYYYMMDDHH
+	serial, _ := strconv.ParseUint(time.Now().Format("2006010215"), 10, 32) // YYYYMMDDHH
 
-	// Write SOA record
-	zone.WriteString(fmt.Sprintf("%s\tIN SOA\t%s mexico.%s (%s 1h 1h 1h 1h)\n", domain, domain, domain, serial))
+	// Write SOA and NS record
+	zone := dns.Zone{
+		Origin: domain,
+		Records: []dns.RR{
+			{
+				Name:  domain,
+				TTL:   zoneTTL,
+				Class: dns.ClassINET,
+				Type:  dns.TypeSOA,
+				Data: &dns.SOA{
+					MName:   domain,
+					RName:   "mexico." + domain,
+					Serial:  uint32(serial),
+					Refresh: zoneTTL,
+					Retry:   zoneTTL,
+					Expire:  zoneTTL,
+					Minimum: zoneTTL,
+				},
+			},
+			{
+				Name:  domain,
+				TTL:   zoneTTL,
+				Class: dns.ClassINET,
+				Type:  dns.TypeNS,
+				Data: &dns.NS{
+					Host: domain,
+				},
+			},
+		},
+	}
+
+	// Write every other record. Line numbers beyond the highest MX preference go to the domains of further parts.
+	for _, c := range module.Code {
+		zone.Records = append(zone.Records, dns.RR{
+			Name:  compiler.PartDomain(domain, c.Linenumber/compiler.PartSize),
+			TTL:   zoneTTL,
+			Class: dns.ClassINET,
+			Type:  dns.TypeMX,
+			Data: &dns.MX{
+				Preference: uint16(c.Linenumber % compiler.PartSize),
+				Exchange:   c.Code,
+			},
+		})
+	}
 
-	// Write every other record
-	for _, c := range code {
-		zone.WriteString(fmt.Sprintf("%s\tIN MX\t%d %s\n", domain, c.Linenumber, c.Code))
+	// Write the metadata the interpreter needs to link libraries
+	for _, metadata := range linkMetadata(module) {
+		zone.Records = append(zone.Records, dns.RR{
+			Name:  domain,
+			TTL:   zoneTTL,
+			Class: dns.ClassINET,
+			Type:  dns.TypeTXT,
+			Data: &dns.TXT{
+				Strings: metadata,
+			},
+		})
+	}
+
+	return &zone
+}
+
+// Lists the imports of the program, whether it's a library and its symbols, and the number of its parts, as character
+// strings for TXT records
+func linkMetadata(module *compiler.Module) [][]string {
+	var metadata [][]string
+
+	// Sort by name, so the zone doesn't change on every compilation
+	aliases := make([]string, 0, len(module.Imports))
+	for alias := range module.Imports {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	for _, alias := range aliases {
+		metadata = append(metadata, []string{compiler.ImportRecord, alias, module.Imports[alias]})
+	}
+
+	if module.Library {
+		metadata = append(metadata, []string{compiler.LibraryRecord})
+	}
+	symbols := make([]string, 0, len(module.Symbols))
+	for symbol := range module.Symbols {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	for _, symbol := range symbols {
+		metadata = append(metadata, []string{compiler.SymbolRecord, symbol, strconv.Itoa(module.Symbols[symbol])})
+	}
+
+	// Code is sorted by line number, so the last line tells the number of parts
+	if len(module.Code) > 0 {
+		parts := module.Code[len(module.Code)-1].Linenumber/compiler.PartSize + 1
+		metadata = append(metadata, []string{compiler.PartsRecord, strconv.Itoa(parts)})
+	}
+	return metadata
+}
+
+// Raises the serial of the zone above the serial of the zonefile written to the given path before, if there is one.
+// The serial is based on the current hour, so without this, writing the zone twice within an hour wouldn't change it.
+func raiseSerial(zone *dns.Zone, path string) {
+	previous, readErr := dns.ReadZoneFile(path, zone.Origin)
+	if readErr != nil || previous.SOA() == nil || zone.SOA() == nil {
+		// Nothing written before, or nothing we understand
+		return
+	}
+
+	soa := zone.SOA().Data.(*dns.SOA)
+	if previousSerial := previous.SOA().Data.(*dns.SOA).Serial; soa.Serial <= previousSerial {
+		soa.Serial = previousSerial + 1
+	}
+}
+
+// Writes the compiled program into the format of a Zonefile
+func writeZone(module *compiler.Module) error {
+	var zone strings.Builder
+
+	// Sign the zone, if requested. Signatures cover the serial, so it has to be final before.
+	built := buildZone(module, *baseDomain)
+	raiseSerial(built, *outputFilePath)
+	if signErr := signZone(built, true); signErr != nil {
+		return signErr
+	}
+
+	// Convert every record into its presentation format
+	for _, r := range built.Records {
+		zone.WriteString(r.String())
+		zone.WriteString("\n")
 	}
 
 	// And write built string to file
 	return ioutil.WriteFile(*outputFilePath, []byte(zone.String()), 0644)
-}
\ No newline at end of file
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"github.com/maride/mexico/dns"
+	"github.com/maride/mexico/mexico/compiler"
+	"path/filepath"
+	"testing"
+)
+
+// Returns the serial of the zonefile at the given path
+func writtenSerial(t *testing.T, path string) uint32 {
+	t.Helper()
+
+	zone, readErr := dns.ReadZoneFile(path, "")
+	if readErr != nil {
+		t.Fatalf("Failed to read %s: %s", path, readErr.Error())
+	}
+	if zone.SOA() == nil {
+		t.Fatalf("%s has no SOA record", path)
+	}
+	return zone.SOA().Data.(*dns.SOA).Serial
+}
+
+func TestWriteZoneRaisesSerial(t *testing.T) {
+	domain := signedDomain
+	output := filepath.Join(t.TempDir(), "fib.zone")
+	noKey := ""
+	baseDomain = &domain
+	outputFilePath = &output
+	keyPath = &noKey
+
+	// Each write raises the serial, even if the zone didn't change otherwise
+	var serials []uint32
+	for i := 0; i < 3; i++ {
+		if writeErr := writeZone(compiledModule(t)); writeErr != nil {
+			t.Fatalf("writeZone: %s", writeErr.Error())
+		}
+		serials = append(serials, writtenSerial(t, output))
+	}
+	if serials[1] != serials[0]+1 || serials[2] != serials[1]+1 {
+		t.Errorf("Got serials %v, want each one raised by one", serials)
+	}
+}
+
+func TestBuildZoneSplitsIntoParts(t *testing.T) {
+	module, diagnostics := compiler.CompileWithOptions("@65535 LAST:\n  push 1\n  pop\n", compiler.Options{
+		Domain: signedDomain,
+		Split:  true,
+	})
+	if diagnostics.HasErrors() {
+		t.Fatalf("Failed to compile: %v", diagnostics)
+	}
+	zone := buildZone(module, signedDomain)
+
+	// Line 65535 is the last one of the domain itself, line 65536 the first one of the next part
+	for _, want := range []struct {
+		domain     string
+		preference uint16
+		exchange   string
+	}{
+		{signedDomain, 65535, "push-1.mexico.invalid."},
+		{"part1." + signedDomain, 0, "pop.mexico.invalid."},
+	} {
+		records := zone.Lookup(want.domain, dns.TypeMX)
+		if len(records) != 1 {
+			t.Errorf("Got %d MX records for %s, want 1", len(records), want.domain)
+			continue
+		}
+		if mx := records[0].Data.(*dns.MX); mx.Preference != want.preference || mx.Exchange != want.exchange {
+			t.Errorf("Got MX record %s, want %d %s", records[0].String(), want.preference, want.exchange)
+		}
+	}
+
+	parts := false
+	for _, r := range zone.Lookup(signedDomain, dns.TypeTXT) {
+		if txt := r.Data.(*dns.TXT); txt.Strings[0] == compiler.PartsRecord {
+			parts = len(txt.Strings) == 2 && txt.Strings[1] == "2"
+		}
+	}
+	if !parts {
+		t.Errorf("Zone doesn't name 2 parts")
+	}
+}
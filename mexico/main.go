@@ -2,29 +2,52 @@ package main
 
 import (
 	"flag"
-	"github.com/maride/mexico/mexico/compiler"
 	"log"
+	"os"
+	"strings"
 )
 
 func main() {
+	// Check if a command was given as first argument, and cut it off the arguments so the flags can be parsed
+	command := "compile"
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		command = os.Args[1]
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+	}
+
+	switch command {
+	case "compile":
+		compile()
+	case "serve":
+		serve()
+	case "keygen":
+		keygen()
+	case "decompile":
+		decompile()
+	case "graph":
+		graph()
+	default:
+		log.Fatalf("Unknown command '%s'", command)
+	}
+}
+
+// Compiles the input file into a zonefile
+func compile() {
 	// Register flags
 	registerIOFlags()
+	registerSigningFlags()
+	registerCompilerFlags()
 	flag.Parse()
 
-	// Read file
-	fileContent, readErr := readFile()
-	handleErr(readErr)
-
-	// Parse and compile lines
-	code, compileErr := compiler.Compile(fileContent, *baseDomain)
+	// Read and compile file
+	module, compileErr := compileFile(*inputFilePath, *baseDomain)
 	handleErr(compileErr)
 
 	// Write Zonefile with given code
-	writeErr := writeZone(code)
+	writeErr := writeZone(module)
 	handleErr(writeErr)
 }
 
-
 // Checks if an error is present, and raises it.
 func handleErr(err error) {
 	if err != nil {
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/maride/mexico/dns"
+	"github.com/maride/mexico/mexico/server"
+	"github.com/pkg/errors"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	listenAddress  *string
+	reloadInterval *time.Duration
+)
+
+// A file handed over to the serve command, either mexico source code or a zonefile
+type servedFile struct {
+	path    string
+	domain  string
+	modTime time.Time
+}
+
+// Registers flags required for serving zones
+func registerServeFlags() {
+	listenAddress = flag.String("listen", "127.0.0.1:5353", "Address to answer DNS queries on, over UDP and TCP")
+	reloadInterval = flag.Duration("reloadInterval", time.Second, "Interval to check the served files for changes")
+}
+
+// Serves the files given as arguments on an authoritative DNS server, reloading them as soon as they change
+func serve() {
+	registerServeFlags()
+	registerSigningFlags()
+	registerCompilerFlags()
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		log.Fatal("Please specify the files to serve, like this: ./mexico serve [<domain>=]<file> ...")
+	}
+
+	// Load all files once, so we don't start with broken zones
+	srv := server.New(*listenAddress)
+	var files []*servedFile
+	for _, arg := range flag.Args() {
+		file, argErr := parseServeArgument(arg)
+		handleErr(argErr)
+		handleErr(file.load(srv))
+		files = append(files, file)
+	}
+
+	// Check for changes in the background
+	go watchFiles(files, srv)
+
+	log.Printf("Serving %d zones on %s", len(files), *listenAddress)
+	handleErr(srv.ListenAndServe())
+}
+
+// Parses an argument of the form [<domain>=]<file>
+func parseServeArgument(arg string) (*servedFile, error) {
+	file := servedFile{
+		path: arg,
+	}
+
+	// Check if a domain was given
+	if parts := strings.SplitN(arg, "=", 2); len(parts) == 2 {
+		file.domain = parts[0]
+		file.path = parts[1]
+	}
+
+	// Source code doesn't carry any domain, so we need one to compile it for
+	if file.isSource() && file.domain == "" {
+		return nil, errors.New(fmt.Sprintf("Please specify the domain to serve %s on, like this: <domain>=%s", arg, arg))
+	}
+
+	return &file, nil
+}
+
+// Checks if the file contains mexico source code, rather than a zonefile
+func (f *servedFile) isSource() bool {
+	return strings.HasSuffix(strings.ToLower(f.path), ".mxc")
+}
+
+// Loads the file, compiles it if required, and hands the resulting zone over to the server
+func (f *servedFile) load(srv *server.Server) error {
+	stat, statErr := os.Stat(f.path)
+	if statErr != nil {
+		return statErr
+	}
+	f.modTime = stat.ModTime()
+
+	var zone *dns.Zone
+	if f.isSource() {
+		// It's source code, compile it
+		module, compileErr := compileFile(f.path, f.domain)
+		if compileErr != nil {
+			return compileErr
+		}
+		zone = buildZone(module, f.domain)
+	} else {
+		// It's a zonefile, parse it
+		var parseErr error
+		zone, parseErr = dns.ReadZoneFile(f.path, f.domain)
+		if parseErr != nil {
+			return errors.New(fmt.Sprintf("Failed to parse %s: %s", f.path, parseErr.Error()))
+		}
+		if zone.Origin == "" {
+			return errors.New(fmt.Sprintf("Zonefile %s has no origin, please specify the domain like this: <domain>=%s", f.path, f.path))
+		}
+	}
+
+	// Signatures cover the serial, so it has to be final before signing
+	if *keyPath != "" {
+		if soa := zone.SOA(); soa != nil {
+			soa.Data.(*dns.SOA).Serial = srv.NextSerial(zone.Origin, soa.Data.(*dns.SOA).Serial)
+		}
+		if signErr := signZone(zone, false); signErr != nil {
+			return errors.New(fmt.Sprintf("Failed to sign %s: %s", f.path, signErr.Error()))
+		}
+	}
+
+	srv.SetZone(zone)
+	log.Printf("Loaded %s, serving %d records for %s", f.path, len(zone.Records), zone.Origin)
+	return nil
+}
+
+// Periodically checks the files for changes, and reloads them if required
+func watchFiles(files []*servedFile, srv *server.Server) {
+	for {
+		time.Sleep(*reloadInterval)
+
+		for _, f := range files {
+			stat, statErr := os.Stat(f.path)
+			if statErr != nil || stat.ModTime().Equal(f.modTime) {
+				// Either vanished (maybe it's just being replaced) or not changed at all
+				continue
+			}
+
+			log.Printf("%s changed, reloading it", f.path)
+			if loadErr := f.load(srv); loadErr != nil {
+				// Keep the old zone, but don't try again until the file changes again
+				log.Printf("Failed to reload %s, keeping the old version: %s", f.path, loadErr.Error())
+				f.modTime = stat.ModTime()
+			}
+		}
+	}
+}
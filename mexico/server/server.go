@@ -0,0 +1,424 @@
+package server
+
+import (
+	"encoding/binary"
+	"github.com/maride/mexico/dns"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Maximum time to wait for a TCP client to send its query
+	tcpTimeout = 10 * time.Second
+
+	// Number of records per message in zone transfers
+	transferChunkSize = 64
+)
+
+// An authoritative DNS server, serving the zones handed over to it
+type Server struct {
+	Address string
+	zones   map[string]*dns.Zone
+	lock    sync.RWMutex
+}
+
+// Returns a new server, listening on the given address once started
+func New(address string) *Server {
+	return &Server{
+		Address: address,
+		zones:   make(map[string]*dns.Zone),
+	}
+}
+
+// Adds the given zone to the served zones, replacing a zone with the same origin.
+// If the zone is replaced, its serial is raised if necessary, so clients notice the change.
+// Signed zones are left untouched, as that would break the signature of the SOA record - see NextSerial().
+func (s *Server) SetZone(zone *dns.Zone) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	origin := strings.ToLower(dns.Fqdn(zone.Origin))
+	if soa := zone.SOA(); soa != nil {
+		newSOA := soa.Data.(*dns.SOA)
+		if serial := s.nextSerial(origin, newSOA.Serial); serial != newSOA.Serial {
+			if len(zone.Lookup(origin, dns.TypeRRSIG)) > 0 {
+				log.Printf("Serial of signed zone %s didn't increase, clients may not notice the change", origin)
+			} else {
+				newSOA.Serial = serial
+			}
+		}
+	}
+
+	s.zones[origin] = zone
+}
+
+// Returns the serial to use for a new version of the zone with the given origin, which is raised above the serial of the served version if necessary
+func (s *Server) NextSerial(origin string, serial uint32) uint32 {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.nextSerial(strings.ToLower(dns.Fqdn(origin)), serial)
+}
+
+// Same as NextSerial(), but expects the caller to hold the lock, and the origin to be in lower case
+func (s *Server) nextSerial(origin string, serial uint32) uint32 {
+	if old, exists := s.zones[origin]; exists && old.SOA() != nil {
+		if oldSerial := old.SOA().Data.(*dns.SOA).Serial; serial <= oldSerial {
+			return oldSerial + 1
+		}
+	}
+	return serial
+}
+
+// Listens on UDP and TCP, and answers queries until an error occurs
+func (s *Server) ListenAndServe() error {
+	udpConn, udpErr := net.ListenPacket("udp", s.Address)
+	if udpErr != nil {
+		return udpErr
+	}
+	defer udpConn.Close()
+
+	tcpListener, tcpErr := net.Listen("tcp", s.Address)
+	if tcpErr != nil {
+		return tcpErr
+	}
+	defer tcpListener.Close()
+
+	// Serve both transports in parallel, and stop as soon as one of them fails
+	errChan := make(chan error, 2)
+	go func() {
+		errChan <- s.serveUDP(udpConn)
+	}()
+	go func() {
+		errChan <- s.serveTCP(tcpListener)
+	}()
+	return <-errChan
+}
+
+// Answers queries received over UDP
+func (s *Server) serveUDP(conn net.PacketConn) error {
+	buf := make([]byte, 65535)
+	for {
+		length, addr, readErr := conn.ReadFrom(buf)
+		if readErr != nil {
+			return readErr
+		}
+
+		responses := s.handle(buf[:length], false)
+		if len(responses) == 0 {
+			continue
+		}
+
+		if _, writeErr := conn.WriteTo(responses[0], addr); writeErr != nil {
+			log.Printf("Failed to answer %s: %s", addr.String(), writeErr.Error())
+		}
+	}
+}
+
+// Accepts TCP connections, and answers the queries received on them
+func (s *Server) serveTCP(listener net.Listener) error {
+	for {
+		conn, acceptErr := listener.Accept()
+		if acceptErr != nil {
+			return acceptErr
+		}
+		go s.handleTCP(conn)
+	}
+}
+
+// Answers queries on a single TCP connection, until the client closes it or stays silent for too long
+func (s *Server) handleTCP(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		conn.SetDeadline(time.Now().Add(tcpTimeout))
+
+		query, readErr := dns.ReadTCPMessage(conn)
+		if readErr != nil {
+			return
+		}
+
+		responses := s.handle(query, true)
+		if len(responses) == 0 {
+			return
+		}
+
+		for _, response := range responses {
+			if writeErr := dns.WriteTCPMessage(conn, response); writeErr != nil {
+				return
+			}
+		}
+	}
+}
+
+// Parses the query, and returns the packed response messages - or nil, if the query isn't worth an answer at all
+func (s *Server) handle(raw []byte, overTCP bool) [][]byte {
+	query, unpackErr := dns.Unpack(raw)
+	if unpackErr != nil {
+		// Not a DNS message. If we at least got a header, tell the client it's broken
+		if len(raw) < 12 {
+			return nil
+		}
+		query = &dns.Message{
+			Header: dns.Header{
+				ID: binary.BigEndian.Uint16(raw),
+			},
+		}
+		response := dns.NewResponse(query)
+		response.Rcode = dns.RcodeFormatError
+		packed, _ := response.Pack()
+		return [][]byte{packed}
+	}
+
+	// Never answer responses, to avoid loops
+	if query.Response {
+		return nil
+	}
+
+	// Zone transfers are handled separately, as they may span multiple messages
+	if len(query.Questions) == 1 && (query.Questions[0].Type == dns.TypeAXFR || query.Questions[0].Type == dns.TypeIXFR) {
+		return s.transfer(query, overTCP)
+	}
+
+	response := s.answer(query)
+
+	// Echo EDNS0 if the client used it
+	if query.EDNS0() != nil {
+		response.SetEDNS0(dns.DefaultEDNSSize)
+		response.SetDNSSECOK(query.DNSSECOK())
+	}
+
+	packed, packErr := response.Pack()
+	if packErr != nil {
+		log.Printf("Failed to pack response: %s", packErr.Error())
+		response = dns.NewResponse(query)
+		response.Rcode = dns.RcodeServerFailure
+		packed, _ = response.Pack()
+		return [][]byte{packed}
+	}
+
+	// Responses over UDP need to fit into the buffer of the client. If they don't, tell the client to retry over TCP
+	if !overTCP && len(packed) > query.UDPSize() {
+		response.Truncated = true
+		response.Answers = nil
+		response.Authority = nil
+		response.Additional = nil
+		if query.EDNS0() != nil {
+			response.SetEDNS0(dns.DefaultEDNSSize)
+			response.SetDNSSECOK(query.DNSSECOK())
+		}
+		packed, _ = response.Pack()
+	}
+
+	return [][]byte{packed}
+}
+
+// Builds the response messages for a zone transfer.
+// As we don't keep a history of the zones, incremental transfers are answered with the complete zone - unless the client is up to date.
+func (s *Server) transfer(query *dns.Message, overTCP bool) [][]byte {
+	response := dns.NewResponse(query)
+
+	// Transfers are too big for UDP, tell the client to use TCP
+	if !overTCP {
+		response.Truncated = true
+		packed, _ := response.Pack()
+		return [][]byte{packed}
+	}
+
+	// Transfers are only possible for complete zones
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	zone := s.zones[strings.ToLower(dns.Fqdn(query.Questions[0].Name))]
+	if zone == nil || zone.SOA() == nil {
+		response.Rcode = dns.RcodeRefused
+		packed, _ := response.Pack()
+		return [][]byte{packed}
+	}
+	soa := *zone.SOA()
+
+	// Check if the client already has the current version
+	if query.Questions[0].Type == dns.TypeIXFR && len(query.Authority) == 1 {
+		if known, isSOA := query.Authority[0].Data.(*dns.SOA); isSOA && known.Serial == soa.Data.(*dns.SOA).Serial {
+			response.Authoritative = true
+			response.Answers = []dns.RR{soa}
+			packed, _ := response.Pack()
+			return [][]byte{packed}
+		}
+	}
+
+	// The complete zone is framed by the SOA record
+	records := []dns.RR{soa}
+	for _, r := range zone.Records {
+		if r.Type != dns.TypeSOA {
+			records = append(records, r)
+		}
+	}
+	records = append(records, soa)
+
+	// Split the records up into multiple messages
+	var messages [][]byte
+	for start := 0; start < len(records); start += transferChunkSize {
+		end := start + transferChunkSize
+		if end > len(records) {
+			end = len(records)
+		}
+
+		chunk := dns.NewResponse(query)
+		chunk.Authoritative = true
+		chunk.Answers = records[start:end]
+		packed, packErr := chunk.Pack()
+		if packErr != nil {
+			log.Printf("Failed to pack zone transfer: %s", packErr.Error())
+			response.Rcode = dns.RcodeServerFailure
+			packed, _ = response.Pack()
+			return [][]byte{packed}
+		}
+		messages = append(messages, packed)
+	}
+	return messages
+}
+
+// Builds the response for the given query, based on the served zones
+func (s *Server) answer(query *dns.Message) *dns.Message {
+	response := dns.NewResponse(query)
+
+	// We only support standard queries with exactly one question
+	if query.Opcode != dns.OpcodeQuery {
+		response.Rcode = dns.RcodeNotImplemented
+		return response
+	}
+	if len(query.Questions) != 1 {
+		response.Rcode = dns.RcodeFormatError
+		return response
+	}
+	question := query.Questions[0]
+
+	// Find the zone responsible for the name
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	zone := s.findZone(question.Name)
+	if zone != nil && question.Type == dns.TypeDS && dns.EqualNames(zone.Origin, question.Name) {
+		// DS records of a zone belong to its parent zone. If we serve the parent as well, answer from there
+		if parent := s.findZone(parentName(question.Name)); parent != nil {
+			zone = parent
+		}
+	}
+	if zone == nil {
+		// Not our business.
+		response.Rcode = dns.RcodeRefused
+		return response
+	}
+	response.Authoritative = true
+
+	// Look up the records asked for, together with their signatures if the client is interested in them
+	withSignatures := query.DNSSECOK()
+	response.Answers = zone.Lookup(question.Name, question.Type)
+	if withSignatures {
+		response.Answers = append(response.Answers, signaturesFor(zone, question.Name, question.Type)...)
+	}
+	if len(response.Answers) > 0 {
+		return response
+	}
+
+	// No records found, the name either exists without records of that type, or doesn't exist at all.
+	// Either way, add the SOA to the authority section to allow negative caching.
+	if soa := zone.SOA(); soa != nil {
+		negative := *soa
+		if minimum := soa.Data.(*dns.SOA).Minimum; minimum < negative.TTL {
+			negative.TTL = minimum
+		}
+		response.Authority = []dns.RR{negative}
+		if withSignatures {
+			response.Authority = append(response.Authority, signaturesFor(zone, soa.Name, dns.TypeSOA)...)
+		}
+	}
+	exists := nameExists(zone, question.Name)
+	if !exists {
+		response.Rcode = dns.RcodeNameError
+	}
+
+	// Signed zones prove the non-existence with the NSEC record of the name, or the one covering it
+	if withSignatures {
+		if nsec := coveringNSEC(zone, question.Name, exists); nsec != nil {
+			response.Authority = append(response.Authority, *nsec)
+			response.Authority = append(response.Authority, signaturesFor(zone, nsec.Name, dns.TypeNSEC)...)
+		}
+	}
+	return response
+}
+
+// Returns the most specific zone the given name belongs to, or nil if the name isn't part of any served zone
+func (s *Server) findZone(name string) *dns.Zone {
+	var found *dns.Zone
+	foundOrigin := ""
+	for origin, zone := range s.zones {
+		if dns.IsSubdomain(name, origin) && len(origin) > len(foundOrigin) {
+			found = zone
+			foundOrigin = origin
+		}
+	}
+	return found
+}
+
+// Returns the name one level above the given name
+func parentName(name string) string {
+	name = dns.Fqdn(name)
+	if dot := strings.Index(name, "."); dot >= 0 && dot < len(name)-1 {
+		return name[dot+1:]
+	}
+	return "."
+}
+
+// Returns the NSEC record owned by the given name if it exists, or the NSEC record covering the gap the name would be in otherwise.
+// Returns nil if the zone isn't signed.
+func coveringNSEC(zone *dns.Zone, name string, exists bool) *dns.RR {
+	for i, r := range zone.Records {
+		nsec, isNSEC := r.Data.(*dns.NSEC)
+		if !isNSEC {
+			continue
+		}
+		if exists {
+			if dns.EqualNames(r.Name, name) {
+				return &zone.Records[i]
+			}
+			continue
+		}
+
+		// The last NSEC record points back to the apex, and covers everything behind it
+		afterOwner := dns.CompareNames(r.Name, name) < 0
+		beforeNext := dns.CompareNames(name, nsec.NextName) < 0
+		isLast := dns.CompareNames(nsec.NextName, r.Name) <= 0
+		if (afterOwner && beforeNext) || (isLast && afterOwner) {
+			return &zone.Records[i]
+		}
+	}
+	return nil
+}
+
+// Returns the RRSIG records of the zone covering the records of the given name and type
+func signaturesFor(zone *dns.Zone, name string, rrType uint16) []dns.RR {
+	if rrType == dns.TypeRRSIG || rrType == dns.TypeANY {
+		// Already part of the answer
+		return nil
+	}
+
+	var signatures []dns.RR
+	for _, r := range zone.Lookup(name, dns.TypeRRSIG) {
+		if sig, isRRSIG := r.Data.(*dns.RRSIG); isRRSIG && sig.TypeCovered == rrType {
+			signatures = append(signatures, r)
+		}
+	}
+	return signatures
+}
+
+// Checks if the name exists in the zone, either because it owns records or because names below it do
+func nameExists(zone *dns.Zone, name string) bool {
+	for _, r := range zone.Records {
+		if dns.IsSubdomain(r.Name, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,264 @@
+package server
+
+import (
+	"fmt"
+	"github.com/maride/mexico/dns"
+	"net"
+	"testing"
+	"time"
+)
+
+const (
+	// The zone served in the tests, and its serial
+	testOrigin = "mxc.example."
+	testSerial = 2026101700
+
+	// Number of MX records in the zone, enough to exceed a UDP message without EDNS0
+	testCodelines = 200
+)
+
+// Returns a zone holding a program with many code lines
+func testZone() *dns.Zone {
+	zone := dns.Zone{
+		Origin: testOrigin,
+		Records: []dns.RR{
+			{Name: testOrigin, TTL: 3600, Class: dns.ClassINET, Type: dns.TypeSOA, Data: &dns.SOA{
+				MName:   testOrigin,
+				RName:   "mexico." + testOrigin,
+				Serial:  testSerial,
+				Refresh: 3600,
+				Retry:   3600,
+				Expire:  3600,
+				Minimum: 3600,
+			}},
+			{Name: testOrigin, TTL: 3600, Class: dns.ClassINET, Type: dns.TypeNS, Data: &dns.NS{Host: testOrigin}},
+		},
+	}
+	for i := 0; i < testCodelines; i++ {
+		zone.Records = append(zone.Records, dns.RR{
+			Name:  testOrigin,
+			TTL:   3600,
+			Class: dns.ClassINET,
+			Type:  dns.TypeMX,
+			Data: &dns.MX{
+				Preference: uint16(i),
+				Exchange:   fmt.Sprintf("push-%d.mexico.invalid.", i),
+			},
+		})
+	}
+	return &zone
+}
+
+// Starts a server for the test zone on a loopback port, serving UDP and TCP on the same port until the test ends.
+// Returns the address of the server.
+func startServer(t *testing.T) string {
+	t.Helper()
+
+	tcpListener, tcpErr := net.Listen("tcp", "127.0.0.1:0")
+	if tcpErr != nil {
+		t.Fatalf("Failed to listen on TCP: %s", tcpErr.Error())
+	}
+	udpConn, udpErr := net.ListenPacket("udp", tcpListener.Addr().String())
+	if udpErr != nil {
+		tcpListener.Close()
+		t.Fatalf("Failed to listen on UDP: %s", udpErr.Error())
+	}
+	t.Cleanup(func() {
+		tcpListener.Close()
+		udpConn.Close()
+	})
+
+	s := New(tcpListener.Addr().String())
+	s.SetZone(testZone())
+	go s.serveUDP(udpConn)
+	go s.serveTCP(tcpListener)
+	return s.Address
+}
+
+// Sends the query to the server over UDP, and returns the response as it is
+func exchangeRawUDP(t *testing.T, server string, query *dns.Message) *dns.Message {
+	t.Helper()
+
+	conn, dialErr := net.Dial("udp", server)
+	if dialErr != nil {
+		t.Fatalf("Failed to connect: %s", dialErr.Error())
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Second))
+
+	packed, _ := query.Pack()
+	if _, writeErr := conn.Write(packed); writeErr != nil {
+		t.Fatalf("Failed to send query: %s", writeErr.Error())
+	}
+	buf := make([]byte, 65535)
+	length, readErr := conn.Read(buf)
+	if readErr != nil {
+		t.Fatalf("Failed to read response: %s", readErr.Error())
+	}
+	if length > query.UDPSize() {
+		t.Errorf("Response of %d bytes exceeds the UDP size of %d bytes", length, query.UDPSize())
+	}
+	response, unpackErr := dns.Unpack(buf[:length])
+	if unpackErr != nil {
+		t.Fatalf("Failed to unpack response: %s", unpackErr.Error())
+	}
+	return response
+}
+
+func TestTruncatedOverUDP(t *testing.T) {
+	server := startServer(t)
+
+	response := exchangeRawUDP(t, server, dns.NewQuery(1, testOrigin, dns.TypeMX))
+	if !response.Truncated || len(response.Answers) != 0 || response.ID != 1 {
+		t.Errorf("Got response with TC %t and %d answers, want a truncated response without answers", response.Truncated, len(response.Answers))
+	}
+
+	// The same response fits into a bigger buffer announced via EDNS0
+	query := dns.NewQuery(2, testOrigin, dns.TypeMX)
+	query.SetEDNS0(65000)
+	response = exchangeRawUDP(t, server, query)
+	if response.Truncated || len(response.AnswersFor(testOrigin, dns.TypeMX)) != testCodelines {
+		t.Errorf("Got response with TC %t and %d answers, want all %d MX records", response.Truncated, len(response.Answers), testCodelines)
+	}
+	if response.EDNS0() == nil {
+		t.Errorf("Response doesn't echo EDNS0")
+	}
+
+	// Small responses are never truncated
+	response = exchangeRawUDP(t, server, dns.NewQuery(3, testOrigin, dns.TypeNS))
+	if response.Truncated || len(response.Answers) != 1 {
+		t.Errorf("Got response with TC %t and %d answers, want the NS record", response.Truncated, len(response.Answers))
+	}
+}
+
+func TestFallbackToTCP(t *testing.T) {
+	server := startServer(t)
+	client := dns.Client{
+		Server:  server,
+		Timeout: time.Second,
+	}
+
+	response, queryErr := client.Query(testOrigin, dns.TypeMX)
+	if queryErr != nil {
+		t.Fatalf("Query: %s", queryErr.Error())
+	}
+	if !response.OverTCP || response.Truncated || !response.Authoritative {
+		t.Errorf("Got response over TCP %t, with TC %t, authoritative %t, want a complete authoritative response over TCP", response.OverTCP, response.Truncated, response.Authoritative)
+	}
+	if answers := response.AnswersFor(testOrigin, dns.TypeMX); len(answers) != testCodelines {
+		t.Errorf("Got %d MX records, want %d", len(answers), testCodelines)
+	}
+
+	// Small responses stay on UDP
+	response, queryErr = client.Query(testOrigin, dns.TypeSOA)
+	if queryErr != nil {
+		t.Fatalf("Query: %s", queryErr.Error())
+	}
+	if response.OverTCP {
+		t.Errorf("Small response was received over TCP")
+	}
+}
+
+func TestAXFRChunks(t *testing.T) {
+	server := startServer(t)
+
+	conn, dialErr := net.Dial("tcp", server)
+	if dialErr != nil {
+		t.Fatalf("Failed to connect: %s", dialErr.Error())
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Second))
+
+	query := dns.NewQuery(7, testOrigin, dns.TypeAXFR)
+	packed, _ := query.Pack()
+	if writeErr := dns.WriteTCPMessage(conn, packed); writeErr != nil {
+		t.Fatalf("Failed to send query: %s", writeErr.Error())
+	}
+
+	// The zone is framed by its SOA record, and split into messages of at most transferChunkSize records
+	var records []dns.RR
+	messages := 0
+	for len(records) < 2 || records[len(records)-1].Type != dns.TypeSOA {
+		raw, readErr := dns.ReadTCPMessage(conn)
+		if readErr != nil {
+			t.Fatalf("Failed to read message %d: %s", messages+1, readErr.Error())
+		}
+		response, unpackErr := dns.Unpack(raw)
+		if unpackErr != nil {
+			t.Fatalf("Failed to unpack message %d: %s", messages+1, unpackErr.Error())
+		}
+		if response.ID != 7 || !response.Authoritative || len(response.Answers) > transferChunkSize {
+			t.Errorf("Message %d: ID %d, authoritative %t, %d records", messages+1, response.ID, response.Authoritative, len(response.Answers))
+		}
+		records = append(records, response.Answers...)
+		messages++
+	}
+
+	total := testCodelines + 3
+	if len(records) != total || records[0].Type != dns.TypeSOA {
+		t.Errorf("Got %d records starting with %s, want %d records starting with SOA", len(records), dns.TypeToString(records[0].Type), total)
+	}
+	if want := (total + transferChunkSize - 1) / transferChunkSize; messages != want {
+		t.Errorf("Got %d messages, want %d", messages, want)
+	}
+}
+
+func TestAXFR(t *testing.T) {
+	server := startServer(t)
+	client := dns.Client{
+		Server:  server,
+		Timeout: time.Second,
+	}
+
+	transfer, transferErr := client.TransferZone(testOrigin)
+	if transferErr != nil {
+		t.Fatalf("TransferZone: %s", transferErr.Error())
+	}
+	if !transfer.Full || transfer.Serial != testSerial {
+		t.Errorf("Got transfer with full %t and serial %d, want full transfer of serial %d", transfer.Full, transfer.Serial, testSerial)
+	}
+	zone := dns.Zone{
+		Origin:  testOrigin,
+		Records: transfer.Records,
+	}
+	if mx := zone.Lookup(testOrigin, dns.TypeMX); len(mx) != testCodelines {
+		t.Errorf("Got %d MX records, want %d", len(mx), testCodelines)
+	}
+
+	// Unknown zones aren't transferred
+	if _, transferErr := client.TransferZone("other.example."); transferErr == nil {
+		t.Errorf("Transfer of unknown zone succeeded")
+	}
+
+	// Transfers don't fit into UDP
+	response := exchangeRawUDP(t, server, dns.NewQuery(8, testOrigin, dns.TypeAXFR))
+	if !response.Truncated || len(response.Answers) != 0 {
+		t.Errorf("Got AXFR response over UDP with TC %t and %d answers, want a truncated response", response.Truncated, len(response.Answers))
+	}
+}
+
+func TestIXFR(t *testing.T) {
+	server := startServer(t)
+	client := dns.Client{
+		Server:  server,
+		Timeout: time.Second,
+	}
+
+	// Clients knowing the current serial only get the SOA record
+	transfer, transferErr := client.TransferIncremental(testOrigin, testSerial)
+	if transferErr != nil {
+		t.Fatalf("TransferIncremental: %s", transferErr.Error())
+	}
+	if transfer.Full || len(transfer.Diffs) != 0 || len(transfer.Records) != 0 || transfer.Serial != testSerial {
+		t.Errorf("Got transfer with full %t, %d diffs, %d records and serial %d, want no changes", transfer.Full, len(transfer.Diffs), len(transfer.Records), transfer.Serial)
+	}
+
+	// Others get the complete zone, as the server keeps no history
+	transfer, transferErr = client.TransferIncremental(testOrigin, testSerial-1)
+	if transferErr != nil {
+		t.Fatalf("TransferIncremental: %s", transferErr.Error())
+	}
+	if !transfer.Full || transfer.Serial != testSerial || len(transfer.Records) != testCodelines+2 {
+		t.Errorf("Got transfer with full %t, %d records and serial %d, want the complete zone", transfer.Full, len(transfer.Records), transfer.Serial)
+	}
+}
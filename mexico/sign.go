@@ -0,0 +1,112 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/maride/mexico/dns"
+	"github.com/pkg/errors"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// How long signatures are valid before their creation, to cope with clocks running late
+	clockSkew = time.Hour
+)
+
+var (
+	keyPath           *string
+	signatureValidity *time.Duration
+	algorithmName     *string
+	keyDirectory      *string
+)
+
+var (
+	// Mapping of the algorithm names accepted on the command line to the algorithm numbers
+	signingAlgorithms = map[string]uint8{
+		"ed25519":   dns.AlgorithmED25519,
+		"ecdsap256": dns.AlgorithmECDSAP256SHA256,
+	}
+)
+
+// Registers flags required for signing zones
+func registerSigningFlags() {
+	keyPath = flag.String("key", "", "Sign the zone with the given key, as written by 'mexico keygen'")
+	signatureValidity = flag.Duration("signatureValidity", 30*24*time.Hour, "How long the signatures of a signed zone are valid")
+}
+
+// Registers flags required for generating keys
+func registerKeygenFlags() {
+	algorithmName = flag.String("algorithm", "ed25519", "Algorithm of the key, either ed25519 or ecdsap256")
+	keyDirectory = flag.String("keyDirectory", ".", "Directory to write the key files to")
+}
+
+// Generates a key to sign the zone given as argument with
+func keygen() {
+	registerKeygenFlags()
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		log.Fatal("Please specify the zone to generate a key for, like this: ./mexico keygen <zone>")
+	}
+	key, base, generateErr := generateKey(flag.Arg(0), *algorithmName, *keyDirectory)
+	handleErr(generateErr)
+	log.Printf("Wrote key %d to %s.key and %s.private", key.DNSKEY.KeyTag(), base, base)
+
+	// The DS record is what the parent zone needs to vouch for the key
+	ds, dsErr := key.DNSKEY.ToDS(key.Zone, dns.DigestSHA256)
+	handleErr(dsErr)
+	record := dns.RR{
+		Name:  key.Zone,
+		TTL:   zoneTTL,
+		Class: dns.ClassINET,
+		Type:  dns.TypeDS,
+		Data:  ds,
+	}
+	log.Println("Publish this DS record in the parent zone, or use it as trust anchor:")
+	fmt.Fprintln(os.Stdout, record.String())
+}
+
+// Generates a key for the zone with the named algorithm, and writes it into the given directory.
+// Returns the key, and the path of its files without extension.
+func generateKey(zone string, name string, directory string) (*dns.SigningKey, string, error) {
+	algorithm, knownAlgorithm := signingAlgorithms[strings.ToLower(name)]
+	if !knownAlgorithm {
+		return nil, "", errors.New(fmt.Sprintf("Unknown algorithm '%s', please choose ed25519 or ecdsap256", name))
+	}
+
+	// As mexico zones are signed with a single key, it acts as both key signing key and zone signing key
+	key, generateErr := dns.GenerateKey(zone, algorithm, dns.FlagZoneKey|dns.FlagSEP)
+	if generateErr != nil {
+		return nil, "", generateErr
+	}
+	base, writeErr := key.WriteFiles(directory)
+	if writeErr != nil {
+		return nil, "", writeErr
+	}
+	return key, base, nil
+}
+
+// Signs the zone with the key given on the command line, if any.
+// Zones the key doesn't belong to are left alone, unless strict is set - then, that's an error.
+func signZone(zone *dns.Zone, strict bool) error {
+	if *keyPath == "" {
+		return nil
+	}
+
+	key, readErr := dns.ReadKey(*keyPath)
+	if readErr != nil {
+		return readErr
+	}
+	if !dns.EqualNames(key.Zone, zone.Origin) {
+		if strict {
+			return errors.New(fmt.Sprintf("Key %s belongs to %s, can't sign %s with it", *keyPath, key.Zone, zone.Origin))
+		}
+		return nil
+	}
+
+	now := time.Now()
+	return dns.SignZone(zone, []*dns.SigningKey{key}, now.Add(-clockSkew), now.Add(*signatureValidity))
+}
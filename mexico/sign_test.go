@@ -0,0 +1,186 @@
+package main
+
+import (
+	"github.com/maride/mexico/dns"
+	"github.com/maride/mexico/mexico/compiler"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	// The domain the example is compiled for
+	signedDomain = "fib.mxc.example."
+)
+
+// Compiles the Fibonacci example so it is split into two parts
+func compiledModule(t *testing.T) *compiler.Module {
+	t.Helper()
+
+	lines, readErr := readFile("../examples/Fibonacci.mxc")
+	if readErr != nil {
+		t.Fatalf("Failed to read example: %s", readErr.Error())
+	}
+	module, diagnostics := compiler.CompileWithOptions(strings.Join(lines, "\n"), compiler.Options{
+		Domain: signedDomain,
+		Start:  compiler.PartSize - 5,
+		Split:  true,
+	})
+	if diagnostics.HasErrors() {
+		t.Fatalf("Failed to compile example: %v", diagnostics)
+	}
+	return module
+}
+
+// Returns the zone of the compiled Fibonacci example
+func compiledZone(t *testing.T) *dns.Zone {
+	t.Helper()
+
+	return buildZone(compiledModule(t), signedDomain)
+}
+
+// Answers UDP queries on a loopback port with the matching records of the zone and their signatures, until the test ends.
+// Returns the address of the server.
+func serveSignedZone(t *testing.T, zone *dns.Zone) string {
+	t.Helper()
+
+	conn, listenErr := net.ListenPacket("udp", "127.0.0.1:0")
+	if listenErr != nil {
+		t.Fatalf("Failed to listen: %s", listenErr.Error())
+	}
+	t.Cleanup(func() {
+		conn.Close()
+	})
+
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			length, addr, readErr := conn.ReadFrom(buf)
+			if readErr != nil {
+				return
+			}
+			query, unpackErr := dns.Unpack(buf[:length])
+			if unpackErr != nil || len(query.Questions) != 1 {
+				continue
+			}
+			response := dns.NewResponse(query)
+			response.Authoritative = true
+			question := query.Questions[0]
+			for _, r := range zone.Lookup(question.Name, dns.TypeANY) {
+				if sig, isRRSIG := r.Data.(*dns.RRSIG); r.Type == question.Type || (isRRSIG && sig.TypeCovered == question.Type) {
+					response.Answers = append(response.Answers, r)
+				}
+			}
+			if packed, packErr := response.Pack(); packErr == nil {
+				conn.WriteTo(packed, addr)
+			}
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestSignedZoneValidates(t *testing.T) {
+	validity := time.Hour
+	signatureValidity = &validity
+
+	for _, algorithm := range []string{"ed25519", "ecdsap256"} {
+		key, base, generateErr := generateKey(signedDomain, algorithm, t.TempDir())
+		if generateErr != nil {
+			t.Fatalf("%s: Failed to generate key: %s", algorithm, generateErr.Error())
+		}
+		keyPath = &base
+
+		zone := compiledZone(t)
+		if signErr := signZone(zone, true); signErr != nil {
+			t.Fatalf("%s: Failed to sign zone: %s", algorithm, signErr.Error())
+		}
+
+		// Trust the DS record printed by keygen, just like a user would
+		anchor, dsErr := key.DNSKEY.ToDS(key.Zone, dns.DigestSHA256)
+		if dsErr != nil {
+			t.Fatalf("%s: ToDS: %s", algorithm, dsErr.Error())
+		}
+		validator := dns.NewValidator(&dns.Client{
+			Server:  serveSignedZone(t, zone),
+			Timeout: time.Second,
+			UDPSize: dns.DefaultEDNSSize,
+			DNSSEC:  true,
+		}, []dns.RR{
+			{Name: key.Zone, Class: dns.ClassINET, Type: dns.TypeDS, Data: anchor},
+		})
+		for part := 0; part < 2; part++ {
+			domain := compiler.PartDomain(signedDomain, part)
+			if validateErr := validator.Validate(zone.Lookup(domain, dns.TypeANY)); validateErr != nil {
+				t.Errorf("%s: Failed to validate %s: %s", algorithm, domain, validateErr.Error())
+			}
+		}
+	}
+}
+
+func TestSignedZoneNSECChain(t *testing.T) {
+	key, base, generateErr := generateKey(signedDomain, "ed25519", t.TempDir())
+	if generateErr != nil {
+		t.Fatalf("Failed to generate key: %s", generateErr.Error())
+	}
+	keyPath = &base
+	validity := time.Hour
+	signatureValidity = &validity
+
+	zone := compiledZone(t)
+	if signErr := signZone(zone, true); signErr != nil {
+		t.Fatalf("Failed to sign zone: %s", signErr.Error())
+	}
+
+	// Collect the NSEC records in the order of the zone, and the names they have to cover
+	var chain []dns.RR
+	names := make(map[string]bool)
+	for _, r := range zone.Records {
+		if r.Type == dns.TypeNSEC {
+			chain = append(chain, r)
+		}
+		names[strings.ToLower(r.Name)] = true
+	}
+	if len(chain) != len(names) {
+		t.Fatalf("Got %d NSEC records for %d names", len(chain), len(names))
+	}
+	if !dns.EqualNames(chain[0].Name, key.Zone) {
+		t.Errorf("NSEC chain starts at %s, not at the zone itself", chain[0].Name)
+	}
+
+	for i, r := range chain {
+		nsec := r.Data.(*dns.NSEC)
+
+		// The names follow each other in canonical order, and the last one points back to the zone itself
+		next := key.Zone
+		if i+1 < len(chain) {
+			next = chain[i+1].Name
+			if dns.CompareNames(r.Name, next) >= 0 {
+				t.Errorf("NSEC record of %s comes before %s", r.Name, next)
+			}
+		}
+		if !dns.EqualNames(nsec.NextName, next) {
+			t.Errorf("NSEC record of %s points to %s, want %s", r.Name, nsec.NextName, next)
+		}
+
+		// The types listed are exactly those of the name
+		listed := make(map[uint16]bool)
+		for _, rrType := range nsec.Types {
+			listed[rrType] = true
+		}
+		present := make(map[uint16]bool)
+		for _, other := range zone.Lookup(r.Name, dns.TypeANY) {
+			present[other.Type] = true
+		}
+		for rrType := range present {
+			if !listed[rrType] {
+				t.Errorf("NSEC record of %s lacks type %s", r.Name, dns.TypeToString(rrType))
+			}
+		}
+		for rrType := range listed {
+			if !present[rrType] {
+				t.Errorf("NSEC record of %s lists type %s, which the name doesn't have", r.Name, dns.TypeToString(rrType))
+			}
+		}
+	}
+}
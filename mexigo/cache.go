@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/maride/mexico/dns"
+	"github.com/maride/mexico/mexigo/interpreter"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	cacheDir     *string
+	offlineMode  *bool
+	forceRefresh *bool
+)
+
+// A program as stored in the cache
+type cacheEntry struct {
+	Domain  string
+	Code    []interpreter.Codeline
+	Imports map[string]string `json:",omitempty"`
+	Library bool              `json:",omitempty"`
+	Symbols map[string]int    `json:",omitempty"`
+	TTL     uint32
+	Serial  uint32
+	Server  string
+	Secure  bool
+	Fetched time.Time
+}
+
+// Wraps another program source, serving the program from the on-disk cache as long as its TTL didn't expire
+type cachedSource struct {
+	inner  ProgramSource
+	domain string
+}
+
+// Registers flags required for caching
+func registerCacheFlags() {
+	cacheDir = flag.String("cacheDir", defaultCacheDir(), "Directory to cache programs in, or empty to disable the cache")
+	offlineMode = flag.Bool("offline", false, "Only run programs from the cache, without sending any queries")
+	forceRefresh = flag.Bool("refresh", false, "Ignore the cache and load the program again, updating the cache")
+}
+
+// Returns the default directory to cache programs in, or an empty string if there is none
+func defaultCacheDir() string {
+	userCacheDir, cacheDirErr := os.UserCacheDir()
+	if cacheDirErr != nil {
+		return ""
+	}
+	return filepath.Join(userCacheDir, "mexigo")
+}
+
+// Wraps the given source into a cached source, if the cache is enabled
+func withCache(source ProgramSource, domain string) (ProgramSource, error) {
+	if *offlineMode && *forceRefresh {
+		return nil, errors.New("Can't refresh the cache while being offline, please choose one of -offline and -refresh")
+	}
+	if *cacheDir == "" {
+		if *offlineMode {
+			return nil, errors.New("Can't run offline without a cache directory")
+		}
+		return source, nil
+	}
+
+	return &cachedSource{
+		inner:  source,
+		domain: domain,
+	}, nil
+}
+
+// Returns the program from the cache if it's still fresh, or loads it from the wrapped source otherwise
+func (s *cachedSource) Load() (*Program, error) {
+	entry, readErr := s.read()
+	if readErr != nil {
+		// A broken cache shouldn't stop us, we can still load the program
+		log.Printf("Failed to read cache: %s", readErr.Error())
+	}
+	if entry != nil && *requireDNSSEC && !entry.Secure {
+		// The cached program was never validated, so we can't trust it
+		log.Println("Cached program wasn't validated via DNSSEC, ignoring it")
+		entry = nil
+	}
+
+	if *offlineMode {
+		// We're not allowed to ask anyone, so the cache is all we've got
+		if entry == nil {
+			return nil, errors.New(fmt.Sprintf("Domain '%s' is not in the cache", s.domain))
+		}
+		if !entry.isFresh() {
+			log.Printf("Cached program expired %s ago, running it anyway", time.Since(entry.expires()).Round(time.Second).String())
+		}
+		return entry.program(), nil
+	}
+
+	if entry != nil && !*forceRefresh {
+		if entry.isFresh() {
+			log.Printf("Using cached program, expires in %s", time.Until(entry.expires()).Round(time.Second).String())
+			return entry.program(), nil
+		}
+
+		// The TTL expired, but maybe the zone didn't change at all. The serial tells us.
+		if entry.Serial != 0 {
+			serial, serialErr := LookupSerial(s.domain)
+			if serialErr != nil {
+				log.Printf("Cached program expired, and its serial couldn't be checked: %s", serialErr.Error())
+			} else if serial == entry.Serial {
+				log.Printf("Cached program expired, but the serial %d didn't change. Renewing it.", serial)
+				entry.Fetched = time.Now()
+				s.write(entry)
+				return entry.program(), nil
+			}
+		}
+	}
+
+	// Cache didn't help, load the program and remember it
+	program, loadErr := s.inner.Load()
+	if loadErr != nil {
+		return nil, loadErr
+	}
+	if program.Serial == 0 {
+		// Not all sources know the serial of the zone, ask for it
+		serial, serialErr := LookupSerial(s.domain)
+		if serialErr != nil {
+			log.Printf("Failed to look up the serial of '%s', changes won't be detected: %s", s.domain, serialErr.Error())
+		}
+		program.Serial = serial
+	}
+
+	s.write(&cacheEntry{
+		Domain:  program.Domain,
+		Code:    program.Code,
+		Imports: program.Imports,
+		Library: program.Library,
+		Symbols: program.Symbols,
+		TTL:     program.TTL,
+		Serial:  program.Serial,
+		Server:  program.Server,
+		Secure:  program.Secure,
+		Fetched: time.Now(),
+	})
+	return program, nil
+}
+
+func (s *cachedSource) String() string {
+	return fmt.Sprintf("%s (cached)", s.inner.String())
+}
+
+// Returns the path of the cache file for the domain. Servers may deliver different programs for the same domain, so
+// programs loaded from the server given with -server are cached apart from those loaded via the system resolver.
+func (s *cachedSource) path() string {
+	name := strings.ToLower(strings.TrimSuffix(dns.Fqdn(s.domain), "."))
+	if *dnsServer != "" {
+		name += "@" + strings.NewReplacer(":", "_", "/", "_", "\\", "_").Replace(strings.ToLower(*dnsServer))
+	}
+	return filepath.Join(*cacheDir, name+".json")
+}
+
+// Reads the cache entry of the domain. Returns nil if the domain isn't cached.
+func (s *cachedSource) read() (*cacheEntry, error) {
+	content, readErr := ioutil.ReadFile(s.path())
+	if os.IsNotExist(readErr) {
+		return nil, nil
+	} else if readErr != nil {
+		return nil, readErr
+	}
+
+	var entry cacheEntry
+	if jsonErr := json.Unmarshal(content, &entry); jsonErr != nil {
+		return nil, errors.New(fmt.Sprintf("Invalid cache file %s: %s", s.path(), jsonErr.Error()))
+	}
+	return &entry, nil
+}
+
+// Writes the cache entry of the domain. Failing to do so is not fatal, it's just logged.
+func (s *cachedSource) write(entry *cacheEntry) {
+	content, jsonErr := json.MarshalIndent(entry, "", "\t")
+	if jsonErr != nil {
+		log.Printf("Failed to write cache: %s", jsonErr.Error())
+		return
+	}
+
+	if mkdirErr := os.MkdirAll(*cacheDir, 0755); mkdirErr != nil {
+		log.Printf("Failed to write cache: %s", mkdirErr.Error())
+		return
+	}
+	if writeErr := ioutil.WriteFile(s.path(), content, 0644); writeErr != nil {
+		log.Printf("Failed to write cache: %s", writeErr.Error())
+	}
+}
+
+// Returns the point in time the entry expires
+func (e *cacheEntry) expires() time.Time {
+	return e.Fetched.Add(time.Duration(e.TTL) * time.Second)
+}
+
+// Checks if the TTL of the entry didn't expire yet
+func (e *cacheEntry) isFresh() bool {
+	return time.Now().Before(e.expires())
+}
+
+// Converts the entry back into a program
+func (e *cacheEntry) program() *Program {
+	return &Program{
+		Domain:        e.Domain,
+		Code:          e.Code,
+		Imports:       e.Imports,
+		Library:       e.Library,
+		Symbols:       e.Symbols,
+		TTL:           e.TTL,
+		Serial:        e.Serial,
+		Server:        e.Server,
+		Authoritative: false,
+		Secure:        e.Secure,
+	}
+}
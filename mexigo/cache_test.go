@@ -0,0 +1,212 @@
+package main
+
+import (
+	"github.com/maride/mexico/dns"
+	"github.com/maride/mexico/mexigo/interpreter"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const (
+	// The domain of the cached program
+	cachedDomain = "fib.mxc.example."
+)
+
+// A source counting how often the program was loaded
+type countingSource struct {
+	program Program
+	loads   int
+}
+
+func (s *countingSource) Load() (*Program, error) {
+	s.loads++
+	program := s.program
+	return &program, nil
+}
+
+func (s *countingSource) String() string {
+	return "counting source"
+}
+
+// Answers SOA queries on a loopback port with the serial stored in the given variable, until the test ends.
+// Sets -server to the address of the server.
+func serveSerial(t *testing.T, serial *uint32) {
+	t.Helper()
+
+	conn, listenErr := net.ListenPacket("udp", "127.0.0.1:0")
+	if listenErr != nil {
+		t.Fatalf("Failed to listen: %s", listenErr.Error())
+	}
+	t.Cleanup(func() {
+		conn.Close()
+	})
+
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			length, addr, readErr := conn.ReadFrom(buf)
+			if readErr != nil {
+				return
+			}
+			query, unpackErr := dns.Unpack(buf[:length])
+			if unpackErr != nil || len(query.Questions) != 1 {
+				continue
+			}
+			response := dns.NewResponse(query)
+			response.Answers = []dns.RR{
+				{Name: query.Questions[0].Name, TTL: 60, Class: dns.ClassINET, Type: dns.TypeSOA, Data: &dns.SOA{
+					MName:   "ns.mxc.example.",
+					RName:   "mexico.mxc.example.",
+					Serial:  atomic.LoadUint32(serial),
+					Refresh: 3600,
+					Retry:   3600,
+					Expire:  3600,
+					Minimum: 3600,
+				}},
+			}
+			if packed, packErr := response.Pack(); packErr == nil {
+				conn.WriteTo(packed, addr)
+			}
+		}
+	}()
+
+	setFlag(t, "server", conn.LocalAddr().String())
+	setFlag(t, "timeout", "1s")
+	setFlag(t, "retries", "0")
+}
+
+// Returns a cached source wrapping a counting source, with the cache in a temporary directory
+func newCachedSource(t *testing.T, ttl uint32, serial uint32) (*cachedSource, *countingSource) {
+	t.Helper()
+
+	setFlag(t, "cacheDir", t.TempDir())
+	inner := &countingSource{
+		program: Program{
+			Domain: cachedDomain,
+			Code: []interpreter.Codeline{
+				{Linenumber: 0, Code: "push 1"},
+			},
+			TTL:    ttl,
+			Serial: serial,
+			Secure: true,
+		},
+	}
+	source, cacheErr := withCache(inner, cachedDomain)
+	if cacheErr != nil {
+		t.Fatalf("withCache: %s", cacheErr.Error())
+	}
+	return source.(*cachedSource), inner
+}
+
+// Loads the program from the source, and checks how often the wrapped source was asked for it by now
+func loadCached(t *testing.T, source *cachedSource, inner *countingSource, wantLoads int) *Program {
+	t.Helper()
+
+	program, loadErr := source.Load()
+	if loadErr != nil {
+		t.Fatalf("Load: %s", loadErr.Error())
+	}
+	if len(program.Code) != 1 || program.Code[0].Code != "push 1" {
+		t.Errorf("Got code %v, want the cached program", program.Code)
+	}
+	if inner.loads != wantLoads {
+		t.Errorf("Program was loaded %d times, want %d", inner.loads, wantLoads)
+	}
+	return program
+}
+
+// Makes the cache entry of the source expire
+func expire(t *testing.T, source *cachedSource) {
+	t.Helper()
+
+	entry, readErr := source.read()
+	if readErr != nil || entry == nil {
+		t.Fatalf("Failed to read cache entry: %v", readErr)
+	}
+	entry.Fetched = time.Now().Add(-time.Duration(entry.TTL+1) * time.Second)
+	source.write(entry)
+}
+
+func TestCacheFresh(t *testing.T) {
+	source, inner := newCachedSource(t, 3600, 1)
+	loadCached(t, source, inner, 1)
+	if program := loadCached(t, source, inner, 1); program.Authoritative {
+		t.Errorf("Program from the cache claims to be authoritative")
+	}
+}
+
+func TestCacheExpiredSameSerial(t *testing.T) {
+	serial := uint32(1)
+	serveSerial(t, &serial)
+	source, inner := newCachedSource(t, 60, 1)
+	loadCached(t, source, inner, 1)
+
+	// The serial didn't change, so the entry is renewed rather than loaded again
+	expire(t, source)
+	loadCached(t, source, inner, 1)
+	if entry, _ := source.read(); !entry.isFresh() {
+		t.Errorf("Cache entry wasn't renewed")
+	}
+}
+
+func TestCacheExpiredNewSerial(t *testing.T) {
+	serial := uint32(2)
+	serveSerial(t, &serial)
+	source, inner := newCachedSource(t, 60, 1)
+	loadCached(t, source, inner, 1)
+
+	expire(t, source)
+	inner.program.Serial = 2
+	loadCached(t, source, inner, 2)
+	if entry, _ := source.read(); entry.Serial != 2 || !entry.isFresh() {
+		t.Errorf("Got cache entry with serial %d, fresh %t, want the new version", entry.Serial, entry.isFresh())
+	}
+}
+
+func TestCacheExpiredUnsignedSerial(t *testing.T) {
+	serial := uint32(1)
+	serveSerial(t, &serial)
+	setFlag(t, "dnssec", "true")
+	source, inner := newCachedSource(t, 60, 1)
+	loadCached(t, source, inner, 1)
+
+	// With -dnssec, an unsigned serial isn't trusted to renew the entry
+	expire(t, source)
+	loadCached(t, source, inner, 2)
+}
+
+func TestCacheOffline(t *testing.T) {
+	source, inner := newCachedSource(t, 60, 1)
+
+	// Nothing cached yet
+	setFlag(t, "offline", "true")
+	if _, loadErr := source.Load(); loadErr == nil {
+		t.Errorf("Load succeeded offline without cache entry")
+	}
+	if inner.loads != 0 {
+		t.Errorf("Program was loaded while offline")
+	}
+
+	// Expired entries are used anyway
+	setFlag(t, "offline", "false")
+	loadCached(t, source, inner, 1)
+	expire(t, source)
+	setFlag(t, "offline", "true")
+	loadCached(t, source, inner, 1)
+}
+
+func TestCacheRefresh(t *testing.T) {
+	source, inner := newCachedSource(t, 3600, 1)
+	loadCached(t, source, inner, 1)
+
+	setFlag(t, "refresh", "true")
+	loadCached(t, source, inner, 2)
+
+	// Refreshing while offline makes no sense
+	setFlag(t, "offline", "true")
+	if _, cacheErr := withCache(inner, cachedDomain); cacheErr == nil {
+		t.Errorf("withCache accepted -offline and -refresh")
+	}
+}
@@ -0,0 +1,730 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/maride/mexico/mexigo/interpreter"
+	"github.com/pkg/errors"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	// Number of code lines shown by 'list', and of those shown before the current line
+	listLength = 10
+	listBefore = 3
+
+	// Number of cells shown by 'tape' on each side of the head
+	tapeContext = 10
+)
+
+var (
+	debugMode *bool
+
+	// Returned by the quit command, to leave the debugger
+	errQuit = errors.New("Quit")
+)
+
+// What a watchpoint watches
+type watchKind int
+
+const (
+	// The value of a tape cell, pausing whenever it changes
+	watchCell watchKind = iota
+
+	// The number of values on the stack, pausing when it grows to a given depth
+	watchDepth
+)
+
+// Pauses the program when a tape cell changes, or when the stack grows to a given depth
+type watchpoint struct {
+	kind watchKind
+
+	// The position of the cell, or the stack depth to pause at
+	position int
+
+	// The value of the cell, or the stack depth, before the last step
+	last int
+}
+
+// An interactive debugger, running the program step by step
+type debugger struct {
+	interpreter *interpreter.Interpreter
+
+	// The line numbers of the labels by their name, and the labels of each line
+	labels map[string]int
+	names  map[int][]string
+
+	breakpoints map[int]bool
+	watchpoints []*watchpoint
+
+	// Interrupts pause the running program, rather than killing mexigo
+	interrupts chan os.Signal
+
+	// The last command, repeated on an empty line if it runs the program
+	last []string
+
+	// The number of instructions run, and the time spent running them, to enforce the limits on them. The time paused
+	// at the prompt doesn't count.
+	steps   int
+	running time.Duration
+}
+
+// A command of the debugger
+type debuggerCommand struct {
+	names []string
+	usage string
+	help  string
+
+	// Whether an empty line repeats the command
+	repeat bool
+
+	run func(d *debugger, args []string) error
+}
+
+// Registers flags required for debugging the program
+func registerDebuggerFlags() {
+	debugMode = flag.Bool("debug", false, "Run the program in the interactive debugger, pausing before the first instruction")
+}
+
+// Returns the commands of the debugger, in the order they are listed by 'help'
+func debuggerCommands() []debuggerCommand {
+	return []debuggerCommand{
+		{[]string{"step", "s"}, "step [count]", "Run the next instruction, or the given number of instructions", true, (*debugger).step},
+		{[]string{"next", "n"}, "next", "Run the next instruction, running called subroutines as a whole", true, (*debugger).next},
+		{[]string{"finish", "f"}, "finish", "Run until the current subroutine returns", true, (*debugger).finish},
+		{[]string{"continue", "c"}, "continue", "Run until a breakpoint or watchpoint is hit, or the program ends. Ctrl-C pauses", true, (*debugger).cont},
+		{[]string{"break", "b"}, "break [line|label]", "Pause before running the line, or list breakpoints and watchpoints", false, (*debugger).setBreakpoint},
+		{[]string{"delete", "d"}, "delete <line|label|all>", "Remove the breakpoint on the line, or all breakpoints", false, (*debugger).deleteBreakpoint},
+		{[]string{"watch", "w"}, "watch <cell|depth> <n>", "Pause when tape cell n changes, or when the stack grows to n values", false, (*debugger).setWatchpoint},
+		{[]string{"unwatch", "u"}, "unwatch <number|all>", "Remove the watchpoint with the given number, or all watchpoints", false, (*debugger).deleteWatchpoint},
+		{[]string{"list", "l"}, "list [line|label]", "Show the code around the line, or around the current line", false, (*debugger).list},
+		{[]string{"info", "i"}, "info", "Show the program counter, the head, and the depth of the stack and the return stack", false, (*debugger).info},
+		{[]string{"stack"}, "stack", "Show the values on the stack, the topmost first", false, (*debugger).stack},
+		{[]string{"tape"}, "tape [from [to]]", "Show the cells of the tape, around the head by default", false, (*debugger).tape},
+		{[]string{"set"}, "set stack <depth> <value>", "Change the value at the given depth of the stack, 0 being the topmost", false, (*debugger).set},
+		{[]string{}, "set cell <n> <value>", "Change the value of tape cell n", false, nil},
+		{[]string{}, "set head <n>", "Move the head to tape cell n", false, nil},
+		{[]string{}, "set pc <line|label>", "Continue running at the given line", false, nil},
+		{[]string{"push"}, "push <value>", "Push the value onto the stack", false, (*debugger).push},
+		{[]string{"del"}, "del", "Remove the topmost value from the stack", false, (*debugger).del},
+		{[]string{"help", "h"}, "help", "Show this list of commands", false, (*debugger).help},
+		{[]string{"quit", "q"}, "quit", "Stop the program and leave the debugger", false, (*debugger).quit},
+	}
+}
+
+// Returns a debugger for the program of the interpreter, with the given labels
+func newDebugger(i *interpreter.Interpreter, labels map[string]int) *debugger {
+	d := debugger{
+		interpreter: i,
+		labels:      labels,
+		names:       make(map[int][]string),
+		breakpoints: make(map[int]bool),
+		interrupts:  make(chan os.Signal, 1),
+	}
+	for label, linenumber := range labels {
+		d.names[linenumber] = append(d.names[linenumber], label)
+	}
+	for _, names := range d.names {
+		sort.Strings(names)
+	}
+	return &d
+}
+
+// Runs the program in the debugger, reading commands from stdin until the user quits
+func debug(i *interpreter.Interpreter, labels map[string]int) {
+	d := newDebugger(i, labels)
+	signal.Notify(d.interrupts, os.Interrupt)
+	defer signal.Stop(d.interrupts)
+
+	fmt.Println("Paused before the first instruction. Type 'help' for a list of commands.")
+	d.showCurrent()
+	for {
+		fmt.Print("(mexigo) ")
+		line, readErr := stdin.ReadString('\n')
+		if readErr != nil && line == "" {
+			// End of the input, leave just like 'quit'
+			fmt.Println()
+			return
+		}
+
+		args := strings.Fields(line)
+		if len(args) == 0 {
+			if d.last == nil {
+				continue
+			}
+			args = d.last
+		}
+		command := findCommand(args[0])
+		if command == nil {
+			fmt.Printf("Unknown command '%s', type 'help' for a list of commands\n", args[0])
+			continue
+		}
+
+		d.last = nil
+		if command.repeat {
+			d.last = args
+		}
+		runErr := command.run(d, args[1:])
+		if runErr == errQuit {
+			return
+		}
+		if runErr != nil {
+			fmt.Println(runErr.Error())
+		}
+	}
+}
+
+// Returns the command with the given name, or nil if there is none
+func findCommand(name string) *debuggerCommand {
+	commands := debuggerCommands()
+	for c := range commands {
+		for _, n := range commands[c].names {
+			if n == strings.ToLower(name) {
+				return &commands[c]
+			}
+		}
+	}
+	return nil
+}
+
+// Runs the program until it ends or fails, a breakpoint or watchpoint is hit, the user interrupts it, or done returns
+// true. done is asked after every instruction.
+func (d *debugger) run(done func() bool) error {
+	if _, isRunning := d.interpreter.CurrentCommand(); !isRunning {
+		return errors.New(fmt.Sprintf("The program ended at line %d, there's nothing left to run", d.interpreter.ProgramCounter()))
+	}
+
+	// Forget about interrupts while the program was paused
+	select {
+	case <-d.interrupts:
+	default:
+	}
+	for _, w := range d.watchpoints {
+		w.last = d.watched(w)
+	}
+
+	start := time.Now()
+	defer func() {
+		d.running += time.Since(start)
+	}()
+	for {
+		if limitErr := d.interpreter.CheckRunLimits(d.steps, d.running+time.Since(start)); limitErr != nil {
+			fmt.Println(limitErr.Error())
+			fmt.Println("The program can't run any further. Raise the limit with the command line flag to run it longer.")
+			d.showCurrent()
+			return nil
+		}
+		d.steps++
+
+		isRunning, stepErr := d.interpreter.Step()
+		if stepErr != nil {
+			fmt.Println(stepErr.Error())
+			fmt.Println("The instruction didn't change the stack or the tape. Fix them with 'set', 'push' or 'del' to run it again.")
+			d.showCurrent()
+			return nil
+		}
+		if !isRunning {
+			fmt.Printf("Program ended at line %d\n", d.interpreter.ProgramCounter())
+			return nil
+		}
+
+		watched := d.checkWatchpoints()
+		if watched || done() {
+			d.showCurrent()
+			return nil
+		}
+		if d.breakpoints[d.interpreter.ProgramCounter()] {
+			fmt.Printf("Breakpoint at line %d\n", d.interpreter.ProgramCounter())
+			d.showCurrent()
+			return nil
+		}
+		select {
+		case <-d.interrupts:
+			fmt.Println("Interrupted")
+			d.showCurrent()
+			return nil
+		default:
+		}
+	}
+}
+
+// Reports the watchpoints which triggered during the last step, and remembers the watched values for the next one
+func (d *debugger) checkWatchpoints() bool {
+	triggered := false
+	for n, w := range d.watchpoints {
+		value := d.watched(w)
+		switch w.kind {
+		case watchCell:
+			if value != w.last {
+				fmt.Printf("Watchpoint %d: cell %d changed from %d to %d\n", n+1, w.position, w.last, value)
+				triggered = true
+			}
+		case watchDepth:
+			if w.last < w.position && value >= w.position {
+				fmt.Printf("Watchpoint %d: stack grew to %d values\n", n+1, value)
+				triggered = true
+			}
+		}
+		w.last = value
+	}
+	return triggered
+}
+
+// Returns the current value the watchpoint watches
+func (d *debugger) watched(w *watchpoint) int {
+	machine := d.interpreter.Machine()
+	if w.kind == watchCell {
+		return machine.Tape.Cell(uint(w.position))
+	}
+	return machine.Stack.Size()
+}
+
+func (d *debugger) step(args []string) error {
+	count := 1
+	if len(args) > 0 {
+		parsed, atoiErr := strconv.Atoi(args[0])
+		if atoiErr != nil || parsed < 1 {
+			return errors.New(fmt.Sprintf("Not a number of instructions: '%s'", args[0]))
+		}
+		count = parsed
+	}
+	return d.run(func() bool {
+		count--
+		return count == 0
+	})
+}
+
+func (d *debugger) next(args []string) error {
+	cmd, isRunning := d.interpreter.CurrentCommand()
+	if !isRunning || strings.SplitN(cmd.Code, " ", 2)[0] != "call" {
+		return d.step(nil)
+	}
+
+	// Run until the subroutine returned, to the line after the call
+	returnStack := &d.interpreter.Machine().ReturnStack
+	depth := returnStack.Size()
+	return d.run(func() bool {
+		return returnStack.Size() <= depth
+	})
+}
+
+func (d *debugger) finish(args []string) error {
+	returnStack := &d.interpreter.Machine().ReturnStack
+	depth := returnStack.Size()
+	if depth == 0 {
+		return errors.New("Not inside a subroutine, there's nothing to finish")
+	}
+	return d.run(func() bool {
+		return returnStack.Size() < depth
+	})
+}
+
+func (d *debugger) cont(args []string) error {
+	return d.run(func() bool {
+		return false
+	})
+}
+
+func (d *debugger) setBreakpoint(args []string) error {
+	if len(args) == 0 {
+		d.listPoints()
+		return nil
+	}
+	c, locationErr := d.location(args[0])
+	if locationErr != nil {
+		return locationErr
+	}
+	d.breakpoints[c.Linenumber] = true
+	fmt.Printf("Breakpoint at line %d\n", c.Linenumber)
+	return nil
+}
+
+func (d *debugger) deleteBreakpoint(args []string) error {
+	if len(args) != 1 {
+		return errors.New("Please specify the line or label of the breakpoint to remove, or 'all'")
+	}
+	if args[0] == "all" {
+		d.breakpoints = make(map[int]bool)
+		return nil
+	}
+	c, locationErr := d.location(args[0])
+	if locationErr != nil {
+		return locationErr
+	}
+	if !d.breakpoints[c.Linenumber] {
+		return errors.New(fmt.Sprintf("There's no breakpoint at line %d", c.Linenumber))
+	}
+	delete(d.breakpoints, c.Linenumber)
+	return nil
+}
+
+func (d *debugger) setWatchpoint(args []string) error {
+	if len(args) == 0 {
+		d.listPoints()
+		return nil
+	}
+	if len(args) != 2 {
+		return errors.New("Please specify what to watch, like 'watch cell 3' or 'watch depth 100'")
+	}
+	position, atoiErr := strconv.Atoi(args[1])
+	if atoiErr != nil || position < 0 {
+		return errors.New(fmt.Sprintf("Not a cell or stack depth: '%s'", args[1]))
+	}
+
+	w := watchpoint{
+		position: position,
+	}
+	switch args[0] {
+	case "cell":
+		w.kind = watchCell
+	case "depth":
+		w.kind = watchDepth
+	default:
+		return errors.New(fmt.Sprintf("Can't watch '%s', please use 'cell' or 'depth'", args[0]))
+	}
+	d.watchpoints = append(d.watchpoints, &w)
+	fmt.Printf("Watchpoint %d: %s\n", len(d.watchpoints), w.String())
+	return nil
+}
+
+func (d *debugger) deleteWatchpoint(args []string) error {
+	if len(args) != 1 {
+		return errors.New("Please specify the number of the watchpoint to remove, or 'all'")
+	}
+	if args[0] == "all" {
+		d.watchpoints = nil
+		return nil
+	}
+	number, atoiErr := strconv.Atoi(args[0])
+	if atoiErr != nil || number < 1 || number > len(d.watchpoints) {
+		return errors.New(fmt.Sprintf("There's no watchpoint %s", args[0]))
+	}
+	d.watchpoints = append(d.watchpoints[:number-1], d.watchpoints[number:]...)
+	return nil
+}
+
+// Lists the breakpoints, and the watchpoints with their numbers
+func (d *debugger) listPoints() {
+	if len(d.breakpoints) == 0 && len(d.watchpoints) == 0 {
+		fmt.Println("No breakpoints or watchpoints set")
+		return
+	}
+
+	lines := make([]int, 0, len(d.breakpoints))
+	for linenumber := range d.breakpoints {
+		lines = append(lines, linenumber)
+	}
+	sort.Ints(lines)
+	if len(lines) > 0 {
+		fmt.Println("Breakpoints:")
+	}
+	for _, linenumber := range lines {
+		c, _ := d.location(strconv.Itoa(linenumber))
+		fmt.Println(d.format(c))
+	}
+	if len(d.watchpoints) > 0 {
+		fmt.Println("Watchpoints:")
+	}
+	for n, w := range d.watchpoints {
+		fmt.Printf("%6d: %s\n", n+1, w.String())
+	}
+}
+
+func (d *debugger) list(args []string) error {
+	program := d.interpreter.Program()
+	start := len(program) - 1
+	if len(args) > 0 {
+		c, locationErr := d.location(args[0])
+		if locationErr != nil {
+			return locationErr
+		}
+		start = d.index(c.Linenumber)
+	} else if cmd, isRunning := d.interpreter.CurrentCommand(); isRunning {
+		start = d.index(cmd.Linenumber)
+	}
+
+	start -= listBefore
+	if start < 0 {
+		start = 0
+	}
+	for n := start; n < len(program) && n < start+listLength; n++ {
+		fmt.Println(d.format(program[n]))
+	}
+	return nil
+}
+
+func (d *debugger) info(args []string) error {
+	machine := d.interpreter.Machine()
+	d.showCurrent()
+	fmt.Printf("Head at cell %d, holding %d%s, of %d cells\n", machine.Tape.Head(), machine.Tape.Cell(machine.Tape.Head()), character(machine.Tape.Cell(machine.Tape.Head())), machine.Tape.Size())
+	fmt.Printf("Stack holds %d values\n", machine.Stack.Size())
+	if machine.ReturnStack.Size() == 0 {
+		fmt.Println("Not inside a subroutine")
+	} else {
+		returns := make([]string, machine.ReturnStack.Size())
+		for depth := range returns {
+			returns[depth] = strconv.Itoa(machine.ReturnStack.Peek(depth))
+		}
+		fmt.Printf("Inside %d nested subroutines, returning to lines %s\n", len(returns), strings.Join(returns, ", "))
+	}
+	d.listPoints()
+	return nil
+}
+
+func (d *debugger) stack(args []string) error {
+	s := &d.interpreter.Machine().Stack
+	fmt.Printf("Stack holds %d values\n", s.Size())
+	for depth := 0; depth < s.Size(); depth++ {
+		fmt.Printf("%6d: %d%s\n", depth, s.Peek(depth), character(s.Peek(depth)))
+	}
+	return nil
+}
+
+func (d *debugger) tape(args []string) error {
+	t := &d.interpreter.Machine().Tape
+	from := int(t.Head()) - tapeContext
+	if from < 0 {
+		from = 0
+	}
+	to := int(t.Head()) + tapeContext
+	if len(args) > 0 {
+		var parseErr error
+		if from, parseErr = parseCell(args[0]); parseErr != nil {
+			return parseErr
+		}
+		to = from + 2*tapeContext
+	}
+	if len(args) > 1 {
+		var parseErr error
+		if to, parseErr = parseCell(args[1]); parseErr != nil {
+			return parseErr
+		}
+	}
+
+	// Cells behind the end of the tape were never written, and the tape can't grow beyond its limit anyway
+	last := t.Size() - 1
+	if last < int(t.Head()) {
+		last = int(t.Head())
+	}
+	if from > last {
+		return errors.New(fmt.Sprintf("The tape ends at cell %d, all cells behind it hold 0", last))
+	}
+	if to > last {
+		to = last
+	}
+
+	fmt.Printf("Head at cell %d, of %d cells\n", t.Head(), t.Size())
+	for cell := from; cell <= to; cell++ {
+		marker := " "
+		if uint(cell) == t.Head() {
+			marker = ">"
+		}
+		fmt.Printf("%s%6d: %d%s\n", marker, cell, t.Cell(uint(cell)), character(t.Cell(uint(cell))))
+	}
+	return nil
+}
+
+func (d *debugger) set(args []string) error {
+	machine := d.interpreter.Machine()
+	if len(args) == 2 && args[0] == "head" {
+		cell, parseErr := parseCell(args[1])
+		if parseErr != nil {
+			return parseErr
+		}
+		if tapeErr := machine.Limits.CheckCell(cell); tapeErr != nil {
+			return tapeErr
+		}
+		machine.Tape.SetHead(uint(cell))
+		return nil
+	}
+	if len(args) == 2 && args[0] == "pc" {
+		c, locationErr := d.location(args[1])
+		if locationErr != nil {
+			return locationErr
+		}
+		d.interpreter.SetProgramCounter(c.Linenumber)
+		d.showCurrent()
+		return nil
+	}
+	if len(args) != 3 {
+		return errors.New("Please specify what to set, like 'set stack 0 42', 'set cell 3 65', 'set head 0' or 'set pc loop'")
+	}
+
+	value, parseErr := parseValue(args[2])
+	if parseErr != nil {
+		return parseErr
+	}
+	switch args[0] {
+	case "stack":
+		depth, atoiErr := strconv.Atoi(args[1])
+		if atoiErr != nil {
+			return errors.New(fmt.Sprintf("Not a stack depth: '%s'", args[1]))
+		}
+		return machine.Stack.Set(depth, value)
+	case "cell":
+		cell, parseErr := parseCell(args[1])
+		if parseErr != nil {
+			return parseErr
+		}
+		if tapeErr := machine.Limits.CheckCell(cell); tapeErr != nil {
+			return tapeErr
+		}
+		machine.Tape.SetCell(uint(cell), value)
+	default:
+		return errors.New(fmt.Sprintf("Can't set '%s', please use 'stack', 'cell', 'head' or 'pc'", args[0]))
+	}
+	return nil
+}
+
+func (d *debugger) push(args []string) error {
+	if len(args) != 1 {
+		return errors.New("Please specify the value to push")
+	}
+	value, parseErr := parseValue(args[0])
+	if parseErr != nil {
+		return parseErr
+	}
+	machine := d.interpreter.Machine()
+	if stackErr := machine.Limits.CheckStackDepth(machine.Stack.Size() + 1); stackErr != nil {
+		return stackErr
+	}
+	machine.Stack.Push(value)
+	return nil
+}
+
+func (d *debugger) del(args []string) error {
+	value, popErr := d.interpreter.Machine().Stack.Pop()
+	if popErr != nil {
+		return popErr
+	}
+	fmt.Printf("Removed %d%s\n", value, character(value))
+	return nil
+}
+
+func (d *debugger) help(args []string) error {
+	for _, c := range debuggerCommands() {
+		aliases := ""
+		if len(c.names) > 1 {
+			aliases = fmt.Sprintf("(%s)", strings.Join(c.names[1:], ", "))
+		}
+		fmt.Printf("  %-28s %-4s %s\n", c.usage, aliases, c.help)
+	}
+	fmt.Println("Labels match regardless of case, unless a label is spelled exactly like that.")
+	fmt.Println("An empty line repeats the last command running the program.")
+	return nil
+}
+
+func (d *debugger) quit(args []string) error {
+	return errQuit
+}
+
+// Shows the code line the program is paused at
+func (d *debugger) showCurrent() {
+	cmd, isRunning := d.interpreter.CurrentCommand()
+	if !isRunning {
+		fmt.Printf("Program ended at line %d\n", d.interpreter.ProgramCounter())
+		return
+	}
+	fmt.Println(d.format(cmd))
+}
+
+// Formats the code line with its labels, marking the current line with '>' and breakpoints with '*'
+func (d *debugger) format(c interpreter.Codeline) string {
+	marker := []byte("  ")
+	if cmd, isRunning := d.interpreter.CurrentCommand(); isRunning && cmd.Linenumber == c.Linenumber {
+		marker[0] = '>'
+	}
+	if d.breakpoints[c.Linenumber] {
+		marker[1] = '*'
+	}
+
+	labels := ""
+	if names := d.names[c.Linenumber]; len(names) > 0 {
+		labels = strings.Join(names, ", ") + ": "
+	}
+	return fmt.Sprintf("%s %8d  %s%s", marker, c.Linenumber, labels, c.Code)
+}
+
+// Returns the code line of the given line number or label, or the next line holding code after it
+func (d *debugger) location(arg string) (interpreter.Codeline, error) {
+	linenumber, atoiErr := strconv.Atoi(arg)
+	if atoiErr != nil {
+		label, isLabel := matchName(d.labelNames(), arg)
+		if !isLabel && len(d.labels) == 0 {
+			return interpreter.Codeline{}, errors.New(fmt.Sprintf("No label '%s' known. Labels are known for .mxc files, libraries, and programs compiled with -symbols", arg))
+		}
+		if !isLabel {
+			return interpreter.Codeline{}, errors.New(fmt.Sprintf("No label '%s' known", arg))
+		}
+		linenumber = d.labels[label]
+	}
+
+	program := d.interpreter.Program()
+	if n := d.index(linenumber); n < len(program) {
+		return program[n], nil
+	}
+	return interpreter.Codeline{}, errors.New(fmt.Sprintf("No code at or after line %d", linenumber))
+}
+
+// Returns the names of all labels, sorted
+func (d *debugger) labelNames() []string {
+	names := make([]string, 0, len(d.labels))
+	for label := range d.labels {
+		names = append(names, label)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Returns the index of the first code line at or after the given line number, or the number of code lines if there is none
+func (d *debugger) index(linenumber int) int {
+	program := d.interpreter.Program()
+	return sort.Search(len(program), func(n int) bool {
+		return program[n].Linenumber >= linenumber
+	})
+}
+
+// Describes what the watchpoint watches
+func (w *watchpoint) String() string {
+	if w.kind == watchCell {
+		return fmt.Sprintf("cell %d", w.position)
+	}
+	return fmt.Sprintf("stack depth %d", w.position)
+}
+
+// Parses the position of a tape cell
+func parseCell(arg string) (int, error) {
+	cell, atoiErr := strconv.Atoi(arg)
+	if atoiErr != nil || cell < 0 {
+		return 0, errors.New(fmt.Sprintf("Not a tape cell: '%s'", arg))
+	}
+	return cell, nil
+}
+
+// Parses a value, either as number or as quoted character like 'A'
+func parseValue(arg string) (int, error) {
+	if value, atoiErr := strconv.Atoi(arg); atoiErr == nil {
+		return value, nil
+	}
+	if len(arg) >= 3 && arg[0] == '\'' && arg[len(arg)-1] == '\'' {
+		char, _, tail, unquoteErr := strconv.UnquoteChar(arg[1:len(arg)-1], '\'')
+		if unquoteErr == nil && tail == "" {
+			return int(char), nil
+		}
+	}
+	return 0, errors.New(fmt.Sprintf("Not a number or quoted character: '%s'", arg))
+}
+
+// Returns the value as quoted character, if it's a printable one, to show next to the number
+func character(value int) string {
+	if value < 0 || value > unicode.MaxRune || !unicode.IsPrint(rune(value)) {
+		return ""
+	}
+	return fmt.Sprintf(" (%q)", rune(value))
+}
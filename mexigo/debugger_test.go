@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bytes"
+	"github.com/maride/mexico/mexigo/interpreter"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Returns a debugger for the commands, one per line starting at line 0, running within the given limits
+func debuggerFor(t *testing.T, limits interpreter.Limits, labels map[string]int, cmds ...string) *debugger {
+	t.Helper()
+
+	var program []interpreter.Codeline
+	for linenumber, cmd := range cmds {
+		program = append(program, interpreter.Codeline{Linenumber: linenumber, Code: cmd})
+	}
+	var i interpreter.Interpreter
+	if setErr := i.SetCommands(program); setErr != nil {
+		t.Fatalf("SetCommands: %s", setErr.Error())
+	}
+	i.SetIO(strings.NewReader(""), &bytes.Buffer{})
+	i.SetLimits(limits)
+	return newDebugger(&i, labels)
+}
+
+// Returns what the function printed to stdout, as the debugger talks to the user there
+func captureStdout(t *testing.T, run func()) string {
+	t.Helper()
+
+	reader, writer, pipeErr := os.Pipe()
+	if pipeErr != nil {
+		t.Fatalf("Failed to create pipe: %s", pipeErr.Error())
+	}
+	printed := make(chan string)
+	go func() {
+		content, _ := ioutil.ReadAll(reader)
+		printed <- string(content)
+	}()
+
+	stdout := os.Stdout
+	os.Stdout = writer
+	defer func() {
+		os.Stdout = stdout
+	}()
+	run()
+	writer.Close()
+	return <-printed
+}
+
+// Returns the values on the stack, the topmost first
+func stackOf(d *debugger) []int {
+	s := &d.interpreter.Machine().Stack
+	values := []int{}
+	for depth := 0; depth < s.Size(); depth++ {
+		values = append(values, s.Peek(depth))
+	}
+	return values
+}
+
+// Checks that the debugger is paused at the given line, with the given values on the stack
+func checkPaused(t *testing.T, name string, d *debugger, line int, stack []int) {
+	t.Helper()
+
+	cmd, isRunning := d.interpreter.CurrentCommand()
+	if !isRunning || cmd.Linenumber != line || !reflect.DeepEqual(stackOf(d), stack) {
+		t.Errorf("%s: Paused at line %d (running: %t) with stack %v, want line %d with stack %v", name, cmd.Linenumber, isRunning, stackOf(d), line, stack)
+	}
+}
+
+func TestDebuggerStepLimit(t *testing.T) {
+	d := debuggerFor(t, interpreter.Limits{Steps: 5}, nil, "push 1", "push 0", "jmp")
+	if contErr := d.cont(nil); contErr != nil {
+		t.Fatalf("continue: %s", contErr.Error())
+	}
+	if d.steps != 5 || d.interpreter.ProgramCounter() != 2 {
+		t.Errorf("Paused after %d steps at line %d, want 5 steps at line 2", d.steps, d.interpreter.ProgramCounter())
+	}
+
+	// The limit holds for the whole session, not just a single command
+	if stepErr := d.step(nil); stepErr != nil {
+		t.Fatalf("step: %s", stepErr.Error())
+	}
+	if d.steps != 5 || d.interpreter.ProgramCounter() != 2 {
+		t.Errorf("Ran on to %d steps at line %d after hitting the limit", d.steps, d.interpreter.ProgramCounter())
+	}
+}
+
+func TestDebuggerTimeLimit(t *testing.T) {
+	d := debuggerFor(t, interpreter.Limits{Time: 10 * time.Millisecond}, nil, "push 0", "jmp")
+	if contErr := d.cont(nil); contErr != nil {
+		t.Fatalf("continue: %s", contErr.Error())
+	}
+	if d.running <= 10*time.Millisecond {
+		t.Errorf("Paused after running for %s, before hitting the limit", d.running.String())
+	}
+
+	steps := d.steps
+	if stepErr := d.step(nil); stepErr != nil {
+		t.Fatalf("step: %s", stepErr.Error())
+	}
+	if d.steps != steps {
+		t.Errorf("Ran %d more steps after hitting the limit", d.steps-steps)
+	}
+}
+
+func TestDebuggerPushLimit(t *testing.T) {
+	d := debuggerFor(t, interpreter.Limits{StackDepth: 2}, nil, "push 1", "print")
+	for _, value := range []string{"1", "'A'"} {
+		if pushErr := d.push([]string{value}); pushErr != nil {
+			t.Fatalf("push %s: %s", value, pushErr.Error())
+		}
+	}
+	pushErr := d.push([]string{"3"})
+	if pushErr == nil || pushErr.Error() != "Exceeded the maximum stack depth of 2" {
+		t.Errorf("Got error %v pushing beyond the limit", pushErr)
+	}
+	if size := d.interpreter.Machine().Stack.Size(); size != 2 {
+		t.Errorf("Stack holds %d values, want 2", size)
+	}
+}
+
+func TestDebuggerBreakpoints(t *testing.T) {
+	d := debuggerFor(t, interpreter.Limits{}, map[string]int{"LOOP": 1}, "push 2", "push 1", "swap", "sub", "dup", "push 1", "jmpc", "del")
+
+	// Labels match regardless of case
+	if breakErr := d.setBreakpoint([]string{"loop"}); breakErr != nil {
+		t.Fatalf("break: %s", breakErr.Error())
+	}
+	d.cont(nil)
+	checkPaused(t, "first iteration", d, 1, []int{2})
+	d.cont(nil)
+	checkPaused(t, "second iteration", d, 1, []int{1})
+
+	if deleteErr := d.deleteBreakpoint([]string{"1"}); deleteErr != nil {
+		t.Fatalf("delete: %s", deleteErr.Error())
+	}
+	if deleteErr := d.deleteBreakpoint([]string{"LOOP"}); deleteErr == nil {
+		t.Errorf("Deleted the breakpoint twice")
+	}
+	output := captureStdout(t, func() {
+		d.cont(nil)
+	})
+	if !strings.Contains(output, "Program ended at line 8") {
+		t.Errorf("Printed %q running to the end", output)
+	}
+	if contErr := d.cont(nil); contErr == nil || !strings.Contains(contErr.Error(), "there's nothing left to run") {
+		t.Errorf("Got error %v continuing after the end", contErr)
+	}
+}
+
+func TestDebuggerSubroutines(t *testing.T) {
+	d := debuggerFor(t, interpreter.Limits{}, nil, "push 3", "push 6", "call", "printnum", "push 100", "jmp", "dup", "mult", "ret")
+	if finishErr := d.finish(nil); finishErr == nil {
+		t.Errorf("Finished without being inside a subroutine")
+	}
+
+	// next runs the call as a whole
+	d.step([]string{"2"})
+	checkPaused(t, "before the call", d, 2, []int{6, 3})
+	d.next(nil)
+	checkPaused(t, "after next", d, 3, []int{9})
+
+	// step enters it, and finish runs until it returns
+	d.interpreter.SetProgramCounter(0)
+	d.step([]string{"3"})
+	checkPaused(t, "inside the subroutine", d, 6, []int{3, 9})
+	d.finish(nil)
+	checkPaused(t, "after finish", d, 3, []int{9, 9})
+}
+
+func TestDebuggerFailingInstruction(t *testing.T) {
+	d := debuggerFor(t, interpreter.Limits{}, nil, "push 0", "push 7", "div", "push 100", "jmp")
+	output := captureStdout(t, func() {
+		d.cont(nil)
+	})
+	if !strings.Contains(output, "Division by zero in line 2") {
+		t.Errorf("Printed %q on the failing instruction", output)
+	}
+	checkPaused(t, "failed", d, 2, []int{7, 0})
+
+	// The instruction runs again once the stack is fixed
+	if setErr := d.set([]string{"stack", "1", "2"}); setErr != nil {
+		t.Fatalf("set: %s", setErr.Error())
+	}
+	d.step(nil)
+	checkPaused(t, "fixed", d, 3, []int{3})
+}
+
+func TestDebuggerWatchpoints(t *testing.T) {
+	d := debuggerFor(t, interpreter.Limits{}, nil, "push 1", "pop", "push 1", "pop", "push 2", "push 3", "del", "del")
+	for _, args := range [][]string{{"cell", "0"}, {"depth", "2"}} {
+		if watchErr := d.setWatchpoint(args); watchErr != nil {
+			t.Fatalf("watch %v: %s", args, watchErr.Error())
+		}
+	}
+
+	// Writing the value the cell already holds doesn't change it
+	d.cont(nil)
+	checkPaused(t, "cell changed", d, 2, []int{})
+	d.cont(nil)
+	checkPaused(t, "stack grew", d, 6, []int{3, 2})
+
+	for _, args := range [][]string{{"cell"}, {"cell", "-1"}, {"head", "0"}} {
+		if watchErr := d.setWatchpoint(args); watchErr == nil {
+			t.Errorf("watch %v: Set an invalid watchpoint", args)
+		}
+	}
+	if deleteErr := d.deleteWatchpoint([]string{"3"}); deleteErr == nil {
+		t.Errorf("Deleted a watchpoint which doesn't exist")
+	}
+	if deleteErr := d.deleteWatchpoint([]string{"1"}); deleteErr != nil || len(d.watchpoints) != 1 || d.watchpoints[0].kind != watchDepth {
+		t.Errorf("Failed to delete the first watchpoint: %v", deleteErr)
+	}
+}
+
+func TestDebuggerSet(t *testing.T) {
+	d := debuggerFor(t, interpreter.Limits{TapeSize: 4}, map[string]int{"END": 2}, "push 1", "push 2", "print")
+	machine := d.interpreter.Machine()
+
+	for _, args := range [][]string{{"cell", "3", "'A'"}, {"head", "3"}, {"pc", "end"}} {
+		if setErr := d.set(args); setErr != nil {
+			t.Errorf("set %v: %s", args, setErr.Error())
+		}
+	}
+	if machine.Tape.Cell(3) != 'A' || machine.Tape.Head() != 3 || d.interpreter.ProgramCounter() != 2 {
+		t.Errorf("Got cell 3 %d, head %d, program counter %d", machine.Tape.Cell(3), machine.Tape.Head(), d.interpreter.ProgramCounter())
+	}
+
+	for _, args := range [][]string{{"cell", "4", "1"}, {"head", "4"}, {"stack", "0", "1"}, {"pc", "START"}, {"cell", "0", "A"}, {"tape", "0", "1"}} {
+		if setErr := d.set(args); setErr == nil {
+			t.Errorf("set %v: Set an invalid value", args)
+		}
+	}
+}
+
+func TestDebuggerTape(t *testing.T) {
+	d := debuggerFor(t, interpreter.Limits{}, nil, "push 7", "pop", "right", "push 8", "pop", "left")
+	d.cont(nil)
+
+	// Only the cells of the tape are shown, however far the range goes
+	output := captureStdout(t, func() {
+		if tapeErr := d.tape([]string{"0", "1000000"}); tapeErr != nil {
+			t.Errorf("tape: %s", tapeErr.Error())
+		}
+	})
+	want := "Head at cell 0, of 2 cells\n>     0: 7\n      1: 8\n"
+	if output != want {
+		t.Errorf("Printed %q, want %q", output, want)
+	}
+
+	if tapeErr := d.tape([]string{"2"}); tapeErr == nil || !strings.Contains(tapeErr.Error(), "The tape ends at cell 1") {
+		t.Errorf("Got error %v showing cells behind the tape", tapeErr)
+	}
+	if tapeErr := d.tape([]string{"-1"}); tapeErr == nil {
+		t.Errorf("Showed a negative cell")
+	}
+}
+
+func TestParseValue(t *testing.T) {
+	tests := []struct {
+		arg  string
+		want int
+	}{
+		{"42", 42},
+		{"-7", -7},
+		{"'A'", 'A'},
+		{"'ä'", 'ä'},
+		{"'\\n'", '\n'},
+		{"'\\''", '\''},
+	}
+	for _, test := range tests {
+		value, parseErr := parseValue(test.arg)
+		if parseErr != nil || value != test.want {
+			t.Errorf("%s: got %d (%v), want %d", test.arg, value, parseErr, test.want)
+		}
+	}
+
+	for _, arg := range []string{"", "A", "'AB'", "''", "'A", "0x10"} {
+		if _, parseErr := parseValue(arg); parseErr == nil {
+			t.Errorf("%q: Parsed an invalid value", arg)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/maride/mexico/dns"
+	"github.com/pkg/errors"
+	"log"
+)
+
+var (
+	requireDNSSEC   *bool
+	trustAnchorPath *string
+)
+
+// Registers flags required for DNSSEC validation
+func registerDNSSECFlags() {
+	requireDNSSEC = flag.Bool("dnssec", false, "Validate the DNSSEC signatures of the program, and refuse to run unsigned or bogus code")
+	trustAnchorPath = flag.String("trustAnchor", "", "Zonefile containing the DS or DNSKEY records to trust. Defaults to the trust anchor of the root zone")
+}
+
+// Validates the DNSSEC signatures of the given records, using the RRSIG records among them
+func validateRecords(records []dns.RR) error {
+	anchors := dns.RootTrustAnchors()
+	if *trustAnchorPath != "" {
+		zone, readErr := dns.ReadZoneFile(*trustAnchorPath, ".")
+		if readErr != nil {
+			return errors.New(fmt.Sprintf("Failed to read trust anchors from '%s': %s", *trustAnchorPath, readErr.Error()))
+		}
+		anchors = nil
+		for _, r := range zone.Records {
+			if r.Type == dns.TypeDS || r.Type == dns.TypeDNSKEY {
+				anchors = append(anchors, r)
+			}
+		}
+		if len(anchors) == 0 {
+			return errors.New(fmt.Sprintf("No DS or DNSKEY records found in '%s'", *trustAnchorPath))
+		}
+	}
+
+	validator := dns.NewValidator(newClient(), anchors)
+	if validateErr := validator.Validate(records); validateErr != nil {
+		return errors.New(fmt.Sprintf("Refusing to run program, DNSSEC validation failed: %s", validateErr.Error()))
+	}
+	log.Println("DNSSEC signatures of the program are valid")
+	return nil
+}
+
+// Returns the records of the given name and type among the records, along with the RRSIG records covering them
+func signedRRset(records []dns.RR, name string, rrType uint16) []dns.RR {
+	var rrset []dns.RR
+	for _, r := range records {
+		if !dns.EqualNames(r.Name, name) {
+			continue
+		}
+		if sig, isRRSIG := r.Data.(*dns.RRSIG); r.Type == rrType || (isRRSIG && sig.TypeCovered == rrType) {
+			rrset = append(rrset, r)
+		}
+	}
+	return rrset
+}
@@ -0,0 +1,117 @@
+package interpreter
+
+import (
+	"fmt"
+)
+
+// The kind of a runtime error, for embedders to react to specific errors
+type ErrorKind int
+
+const (
+	// An instruction needed more values than the stack or the return stack held
+	StackUnderflow ErrorKind = iota
+
+	// div or mod was asked to divide by zero
+	DivisionByZero
+
+	// The instruction isn't known, or its argument is malformed
+	UnknownInstruction
+
+	// The program flow can't continue: ret without a call to return from, or jmp, jmpc or call to a negative line
+	// number with no library linked there
+	InvalidJump
+
+	// Reading input or writing output failed
+	IOError
+
+	// A limit on the resources of the program was exceeded, e.g. the maximum call depth or the number of steps
+	LimitExceeded
+
+	// The values on the stack or the argument aren't valid for the instruction, e.g. shifting by a negative number of
+	// bits, or picking a negative position on the stack
+	InvalidArgument
+
+	// The context the program was run with was canceled
+	Canceled
+)
+
+// An error which occurred while running a program, with the state of the machine at that point
+type RuntimeError struct {
+	Kind ErrorKind
+
+	// The line number and the instruction which failed
+	Line        int
+	Instruction string
+
+	// What went wrong, in words
+	Message string
+
+	// The state of the machine when the instruction failed, before it changed anything
+	Snapshot Snapshot
+
+	// The error causing this one, e.g. of reading input, if any
+	Cause error
+}
+
+// A copy of the state of the machine
+type Snapshot struct {
+	Stack       []int
+	ReturnStack []int
+	Tape        []int
+	Head        uint
+}
+
+// Returns the name of the error kind
+func (k ErrorKind) String() string {
+	switch k {
+	case StackUnderflow:
+		return "Stack underflow"
+	case DivisionByZero:
+		return "Division by zero"
+	case UnknownInstruction:
+		return "Unknown instruction"
+	case InvalidJump:
+		return "Invalid jump"
+	case IOError:
+		return "I/O error"
+	case LimitExceeded:
+		return "Limit exceeded"
+	case InvalidArgument:
+		return "Invalid argument"
+	case Canceled:
+		return "Canceled"
+	}
+	return fmt.Sprintf("Error %d", int(k))
+}
+
+// Returns the error in the format "Kind in line N ('instruction'): message"
+func (e *RuntimeError) Error() string {
+	return fmt.Sprintf("%s in line %d ('%s'): %s", e.Kind.String(), e.Line, e.Instruction, e.Message)
+}
+
+// Returns the error causing this one, if any
+func (e *RuntimeError) Unwrap() error {
+	return e.Cause
+}
+
+// Builds a runtime error for the given command, at the line currently running
+func (m *Machine) fail(kind ErrorKind, cmd string, cause error, format string, args ...interface{}) *RuntimeError {
+	return &RuntimeError{
+		Kind:        kind,
+		Line:        m.Line,
+		Instruction: cmd,
+		Message:     fmt.Sprintf(format, args...),
+		Snapshot:    m.Snapshot(),
+		Cause:       cause,
+	}
+}
+
+// Returns a copy of the state of the machine
+func (m *Machine) Snapshot() Snapshot {
+	return Snapshot{
+		Stack:       append([]int{}, m.Stack.values...),
+		ReturnStack: append([]int{}, m.ReturnStack.values...),
+		Tape:        append([]int{}, m.Tape.cells...),
+		Head:        m.Tape.head,
+	}
+}
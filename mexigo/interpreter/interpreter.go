@@ -1,8 +1,10 @@
 package interpreter
 
 import (
-	"fmt"
+	"context"
 	"github.com/pkg/errors"
+	"io"
+	"time"
 )
 
 type Interpreter struct {
@@ -10,6 +12,10 @@ type Interpreter struct {
 	program []Codeline
 	programCounter int
 	programPointer int
+	updates <-chan []Codeline
+
+	// Whether the program ran past its last command
+	ended bool
 }
 
 // Feeds a new mexico machine with given code.
@@ -28,9 +34,44 @@ func Run(commands []Codeline) error {
 
 // Sets the given array as new program for the interpreter
 func (i *Interpreter) SetCommands(commands []Codeline) error {
-	i.program = commands
+	i.setProgram(commands)
 	i.programCounter = 0
-	return i.GoToNextCommand()
+	i.ended = !i.GoToNextCommand()
+	if i.ended {
+		return errors.New("Found no commands in the program")
+	}
+	return nil
+}
+
+// Replaces the commands of the program, keeping the program counter
+func (i *Interpreter) setProgram(commands []Codeline) {
+	i.program = commands
+	i.machine.firstLine = 0
+	if len(commands) > 0 {
+		i.machine.firstLine = commands[0].Linenumber
+	}
+}
+
+// Lets the interpreter pick up new versions of the program from the given channel while it is running.
+// A new version replaces the program as a whole, but keeps the program counter and the state of the machine.
+func (i *Interpreter) WatchUpdates(updates <-chan []Codeline) {
+	i.updates = updates
+}
+
+// Sets where read takes its characters from, and print writes them to. Default to stdin and stdout.
+func (i *Interpreter) SetIO(input io.Reader, output io.Writer) {
+	i.machine.SetInput(input)
+	i.machine.Output = output
+}
+
+// Sets how print writes values, either as raw characters or in the debug format
+func (i *Interpreter) SetOutputMode(mode OutputMode) {
+	i.machine.OutputMode = mode
+}
+
+// Sets the limits on the resources the program may use
+func (i *Interpreter) SetLimits(limits Limits) {
+	i.machine.Limits = limits
 }
 
 // Searches for the next command, starting from the current value of the programCounter.
@@ -38,52 +79,146 @@ func (i *Interpreter) SetCommands(commands []Codeline) error {
 // for a function like this. However, mexico has a BASIC-style program line numbering, means we need to search for the
 // next line number containing code, because there may be one or more empty lines between the current and the next line.
 // This is exactly what GoToNextCommand() does.
-// If there is no next command, most likely because we reached the end of the program, an error is thrown.
-func (i *Interpreter) GoToNextCommand() error {
+// If there is no next command, because we reached the end of the program, false is returned.
+func (i *Interpreter) GoToNextCommand() bool {
 	// Iterate over all lines to find the first which has a greater line number than the current one
 	for index, line := range i.program {
 		if line.Linenumber >= i.programCounter {
 			// Found, set and return
 			i.programCounter = line.Linenumber
 			i.programPointer = index
-			return nil
+			return true
 		}
 	}
 
-	// No next command found. Throw error.
-	return errors.New(fmt.Sprintf("Found no commands after line %d. Stopping.", i.programCounter))
+	// No next command found, the program ends here.
+	return false
+}
+
+// Returns the current value of the program counter. Once the program ended, it's the line number it ended at.
+func (i *Interpreter) ProgramCounter() int {
+	return i.programCounter
+}
+
+// Moves the program counter to the given line, or the next line holding code after it. Returns false if there is no
+// such line, the program ends then.
+func (i *Interpreter) SetProgramCounter(line int) bool {
+	i.programCounter = line
+	i.ended = !i.GoToNextCommand()
+	return !i.ended
+}
+
+// Returns the command the program counter points to, and false if the program ended
+func (i *Interpreter) CurrentCommand() (Codeline, bool) {
+	if i.ended {
+		return Codeline{}, false
+	}
+	return i.program[i.programPointer], true
+}
+
+// Returns the commands of the program, sorted by line number
+func (i *Interpreter) Program() []Codeline {
+	return i.program
 }
 
-// Runs the commands, unless an error is encountered, then it doesn't run the commands.
+// Returns the machine running the program, to inspect or change its state between steps
+func (i *Interpreter) Machine() *Machine {
+	return &i.machine
+}
+
+// Runs the commands, until the program ends or an error is encountered. Reaching the end of the program is not an error,
+// nil is returned then. Errors of the program itself are returned as *RuntimeError.
 func (i *Interpreter) Run() error {
-	defer i.machine.Tape.DebugPrintTape()
-	defer i.machine.Stack.DebugPrintStack()
+	return i.RunContext(context.Background())
+}
+
+// Runs the commands like Run, but stops with a *RuntimeError of kind Canceled as soon as the context is done.
+// Exceeding the limits on the number of steps or the run time is returned as *RuntimeError of kind LimitExceeded.
+func (i *Interpreter) RunContext(ctx context.Context) error {
+	start := time.Now()
+	steps := 0
+
+	if i.machine.OutputMode == OutputDebug {
+		// Show the state of the machine afterwards, it's not mixed up with text printed by the program then
+		defer i.machine.Tape.DebugPrintTape()
+		defer i.machine.Stack.DebugPrintStack()
+	}
 
-	for {
+	for !i.ended {
 		// Get current command
 		cmd := i.program[i.programPointer]
 
-		// Run command in the machine
-		jumpLine, doJump, runErr := i.machine.RunCommand(cmd.Code)
-		if runErr != nil {
-			// Encountered an error during runtime, stop execution
-			return runErr
+		// Check if we are still allowed to run it
+		i.machine.Line = i.programCounter
+		select {
+		case <-ctx.Done():
+			return i.machine.fail(Canceled, cmd.Code, ctx.Err(), "Stopped after %d steps: %s", steps, ctx.Err().Error())
+		default:
 		}
-
-		// Check if we should jump anywhere else than to the next code line
-		if doJump {
-			// Yes, do it then.
-			i.programCounter = jumpLine
-		} else {
-			// We are not asked to jump anywhere, move on to the next code line then.
-			i.programCounter++
+		if limitErr := i.CheckRunLimits(steps, time.Since(start)); limitErr != nil {
+			return limitErr
 		}
+		steps++
 
-		// Skip empty lines if there are any.
-		nextCmdErr := i.GoToNextCommand()
-		if nextCmdErr != nil {
-			// Encountered error finding the next command, throw it
-			return nextCmdErr
+		if _, stepErr := i.Step(); stepErr != nil {
+			// Encountered an error during runtime, stop execution
+			return stepErr
 		}
 	}
+	return nil
+}
+
+// Checks if the next command may run, after the given number of steps and the given run time, without exceeding the
+// limits on them. Returns nil if it may, and a *RuntimeError of kind LimitExceeded otherwise.
+// Run does so on its own, but callers running the program with Step need to check before every step.
+func (i *Interpreter) CheckRunLimits(steps int, running time.Duration) error {
+	if i.ended {
+		return nil
+	}
+	cmd := i.program[i.programPointer]
+	i.machine.Line = i.programCounter
+	if i.machine.Limits.Steps > 0 && steps >= i.machine.Limits.Steps {
+		return i.machine.fail(LimitExceeded, cmd.Code, nil, "Exceeded the maximum of %d steps", i.machine.Limits.Steps)
+	}
+	if i.machine.Limits.Time > 0 && running > i.machine.Limits.Time {
+		return i.machine.fail(LimitExceeded, cmd.Code, nil, "Exceeded the maximum run time of %s after %d steps", i.machine.Limits.Time.String(), steps)
+	}
+	return nil
+}
+
+// Runs the current command, and moves on to the next one. Returns false once the program ended.
+// If the command fails, the program counter stays where it is, so the command may be run again, e.g. after fixing the
+// stack in a debugger. The limits on the number of steps and the run time are up to the caller, see CheckRunLimits.
+func (i *Interpreter) Step() (bool, error) {
+	if i.ended {
+		return false, nil
+	}
+
+	// Run command in the machine
+	cmd := i.program[i.programPointer]
+	i.machine.Line = i.programCounter
+	jumpLine, doJump, runErr := i.machine.RunCommand(cmd.Code)
+	if runErr != nil {
+		return true, runErr
+	}
+
+	// Check if we should jump anywhere else than to the next code line
+	if doJump {
+		// Yes, do it then.
+		i.programCounter = jumpLine
+	} else {
+		// We are not asked to jump anywhere, move on to the next code line then.
+		i.programCounter++
+	}
+
+	// Check if there's a new version of the program waiting
+	select {
+	case commands := <-i.updates:
+		i.setProgram(commands)
+	default:
+	}
+
+	// Skip empty lines if there are any. If there are no lines left, we're done.
+	i.ended = !i.GoToNextCommand()
+	return !i.ended, nil
 }
@@ -0,0 +1,135 @@
+package interpreter
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// The way print writes values to the output
+type OutputMode int
+
+const (
+	// Writes values as characters, encoded as UTF-8, so programs can print text
+	OutputRaw OutputMode = iota
+
+	// Writes values as quoted character followed by their number, one per line, like 'A' (65)
+	OutputDebug
+)
+
+// Sets where read takes its characters from. Characters buffered from the previous input are dropped.
+func (m *Machine) SetInput(input io.Reader) {
+	m.Input = input
+	m.reader = nil
+}
+
+// Returns the buffered input of the machine, reading from stdin if no input was set
+func (m *Machine) input() *bufio.Reader {
+	if m.reader == nil {
+		if m.Input == nil {
+			m.Input = os.Stdin
+		}
+		m.reader = bufio.NewReader(m.Input)
+	}
+	return m.reader
+}
+
+// Returns the output of the machine, writing to stdout if no output was set
+func (m *Machine) output() io.Writer {
+	if m.Output == nil {
+		m.Output = os.Stdout
+	}
+	return m.Output
+}
+
+// Reads a single character off the input. Returns -1 at the end of the input.
+func (m *Machine) readCharacter() (int, error) {
+	char, _, readErr := m.input().ReadRune()
+	if readErr == io.EOF {
+		return -1, nil
+	}
+	if readErr != nil {
+		return 0, readErr
+	}
+	return int(char), nil
+}
+
+// Reads a signed decimal number off the input. Whitespace in front of it is skipped, and reading stops right behind it.
+func (m *Machine) readNumber() (int, error) {
+	input := m.input()
+
+	// Skip whitespace, and look for a sign
+	char, _, readErr := input.ReadRune()
+	for readErr == nil && unicode.IsSpace(char) {
+		char, _, readErr = input.ReadRune()
+	}
+	if readErr == io.EOF {
+		return 0, errors.New("Reached the end of the input")
+	}
+	if readErr != nil {
+		return 0, readErr
+	}
+
+	var digits strings.Builder
+	if char == '-' || char == '+' {
+		digits.WriteRune(char)
+		char, _, readErr = input.ReadRune()
+	}
+	for readErr == nil && char >= '0' && char <= '9' {
+		digits.WriteRune(char)
+		char, _, readErr = input.ReadRune()
+	}
+	if readErr == nil {
+		// That's the first character behind the number, leave it for the next read
+		input.UnreadRune()
+	} else if readErr != io.EOF {
+		return 0, readErr
+	}
+
+	num, atoiErr := strconv.Atoi(digits.String())
+	if numErr, isNumErr := atoiErr.(*strconv.NumError); isNumErr && numErr.Err == strconv.ErrRange {
+		return 0, errors.New(fmt.Sprintf("Number %s is out of range", digits.String()))
+	}
+	if atoiErr != nil {
+		if readErr == nil {
+			return 0, errors.New(fmt.Sprintf("Expected a decimal number, but found '%s%c'", digits.String(), char))
+		}
+		return 0, errors.New(fmt.Sprintf("Expected a decimal number, but found '%s'", digits.String()))
+	}
+	return num, nil
+}
+
+// Formats the value as character, in the format of the output mode
+func (m *Machine) formatCharacter(val int) string {
+	if m.OutputMode == OutputDebug {
+		return fmt.Sprintf("%q (%d)\n", rune(val), val)
+	}
+	return string(rune(val))
+}
+
+// Formats the value as decimal number. In the debug format, every number gets a line of its own.
+func (m *Machine) formatNumber(val int) string {
+	if m.OutputMode == OutputDebug {
+		return fmt.Sprintf("%d\n", val)
+	}
+	return strconv.Itoa(val)
+}
+
+// Writes the text to the output for the given command, unless that exceeds the limit on the output
+func (m *Machine) write(cmd string, text string) error {
+	if m.Limits.OutputBytes > 0 && m.written+len(text) > m.Limits.OutputBytes {
+		return m.fail(LimitExceeded, cmd, nil, "Exceeded the maximum output of %d bytes", m.Limits.OutputBytes)
+	}
+
+	written, writeErr := io.WriteString(m.output(), text)
+	m.written += written
+	if writeErr != nil {
+		return m.fail(IOError, cmd, writeErr, "Failed to print: %s", writeErr.Error())
+	}
+	return nil
+}
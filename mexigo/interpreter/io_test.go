@@ -0,0 +1,162 @@
+package interpreter
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// Runs the commands on a machine reading the given input, and returns what it printed and the stack afterwards
+func runWithIO(t *testing.T, mode OutputMode, input string, cmds ...string) (string, []int, error) {
+	t.Helper()
+
+	var output bytes.Buffer
+	m := Machine{Output: &output, OutputMode: mode}
+	m.SetInput(strings.NewReader(input))
+	for _, cmd := range cmds {
+		if _, _, execErr := m.RunCommand(cmd); execErr != nil {
+			return output.String(), nil, execErr
+		}
+	}
+
+	stack := []int{}
+	for i := 0; i < m.Stack.Size(); i++ {
+		stack = append(stack, m.Stack.Peek(i))
+	}
+	return output.String(), stack, nil
+}
+
+func TestReadAtEndOfInput(t *testing.T) {
+	// read pushes the character, and -1 once the input ended - over and over again
+	_, stack, readErr := runWithIO(t, OutputRaw, "ä", "read", "read", "read")
+	if readErr != nil {
+		t.Fatalf("read: %s", readErr.Error())
+	}
+	if len(stack) != 3 || stack[0] != -1 || stack[1] != -1 || stack[2] != 'ä' {
+		t.Errorf("Got stack %v, want [-1 -1 %d]", stack, 'ä')
+	}
+}
+
+func TestOutputModes(t *testing.T) {
+	tests := []struct {
+		mode OutputMode
+		cmds []string
+		want string
+	}{
+		{OutputRaw, []string{"push 10", "push 105", "push 72", "print", "print", "print"}, "Hi\n"},
+		{OutputRaw, []string{"push 0", "push 10", "push 228", "push 72", "printstr"}, "Hä\n"},
+		{OutputRaw, []string{"push 42", "printnum", "push -7", "printnum"}, "42-7"},
+		{OutputDebug, []string{"push 10", "push 72", "print", "print"}, "'H' (72)\n'\\n' (10)\n"},
+		{OutputDebug, []string{"push 0", "push 228", "push 72", "printstr"}, "'H' (72)\n'ä' (228)\n"},
+		{OutputDebug, []string{"push 42", "printnum", "push -7", "printnum"}, "42\n-7\n"},
+	}
+
+	for _, test := range tests {
+		output, _, execErr := runWithIO(t, test.mode, "", test.cmds...)
+		if execErr != nil {
+			t.Errorf("%v: %s", test.cmds, execErr.Error())
+			continue
+		}
+		if output != test.want {
+			t.Errorf("%v in mode %d: Printed %q, want %q", test.cmds, test.mode, output, test.want)
+		}
+	}
+}
+
+func TestSetInput(t *testing.T) {
+	m := Machine{Output: &bytes.Buffer{}}
+	m.SetInput(strings.NewReader("ab"))
+	if _, _, execErr := m.RunCommand("read"); execErr != nil {
+		t.Fatalf("read: %s", execErr.Error())
+	}
+
+	// Characters buffered from the first input aren't read from the second one
+	m.SetInput(strings.NewReader("x"))
+	for _, want := range []int{'x', -1} {
+		if _, _, execErr := m.RunCommand("read"); execErr != nil {
+			t.Fatalf("read: %s", execErr.Error())
+		}
+		if got := m.Stack.Peek(0); got != want {
+			t.Errorf("Read %d, want %d", got, want)
+		}
+	}
+}
+
+func TestSetIOAfterRunning(t *testing.T) {
+	var i Interpreter
+	if setErr := i.SetCommands([]Codeline{{Linenumber: 0, Code: "read"}, {Linenumber: 1, Code: "print"}}); setErr != nil {
+		t.Fatalf("SetCommands: %s", setErr.Error())
+	}
+
+	var output bytes.Buffer
+	for _, input := range []string{"ab", "c"} {
+		i.SetIO(strings.NewReader(input), &output)
+		i.SetProgramCounter(0)
+		if runErr := i.Run(); runErr != nil {
+			t.Fatalf("Run: %s", runErr.Error())
+		}
+	}
+	if output.String() != "ac" {
+		t.Errorf("Printed %q, want \"ac\"", output.String())
+	}
+}
+
+func TestReadNumber(t *testing.T) {
+	tests := []struct {
+		input string
+
+		// The numbers read, then the character left on the input, or the part of the expected error
+		want []int
+		err  string
+	}{
+		{input: "12a", want: []int{12, 'a'}},
+		{input: "  -7\n", want: []int{-7, '\n'}},
+		{input: "+3", want: []int{3, -1}},
+		{input: "-", err: "Expected a decimal number, but found '-'"},
+		{input: "-x", err: "Expected a decimal number, but found '-x'"},
+		{input: "a12", err: "Expected a decimal number, but found 'a'"},
+		{input: "", err: "Reached the end of the input"},
+		{input: " \n\t", err: "Reached the end of the input"},
+		{input: "99999999999999999999", err: "Number 99999999999999999999 is out of range"},
+		{input: "-99999999999999999999", err: "Number -99999999999999999999 is out of range"},
+	}
+
+	for _, test := range tests {
+		_, stack, execErr := runWithIO(t, OutputRaw, test.input, "readnum", "read")
+		if test.err != "" {
+			runtimeErr, isRuntimeErr := execErr.(*RuntimeError)
+			if !isRuntimeErr || runtimeErr.Kind != IOError || !strings.Contains(runtimeErr.Error(), test.err) {
+				t.Errorf("%q: got error %v, want an I/O error containing %q", test.input, execErr, test.err)
+			}
+			continue
+		}
+		if execErr != nil {
+			t.Errorf("%q: %s", test.input, execErr.Error())
+			continue
+		}
+		if len(stack) != 2 || stack[1] != test.want[0] || stack[0] != test.want[1] {
+			t.Errorf("%q: got stack %v, want %d followed by %d", test.input, stack, test.want[0], test.want[1])
+		}
+	}
+}
+
+func TestPrintString(t *testing.T) {
+	// An empty string prints nothing, but removes its 0
+	output, stack, execErr := runWithIO(t, OutputRaw, "", "push 5", "push 0", "printstr")
+	if execErr != nil {
+		t.Fatalf("printstr: %s", execErr.Error())
+	}
+	if output != "" || len(stack) != 1 || stack[0] != 5 {
+		t.Errorf("Printed %q and left stack %v, want nothing printed and [5]", output, stack)
+	}
+
+	// A string without a 0 at its end prints nothing, and fails
+	output, _, execErr = runWithIO(t, OutputRaw, "", "push 105", "push 72", "printstr")
+	runtimeErr, isRuntimeErr := execErr.(*RuntimeError)
+	if !isRuntimeErr || runtimeErr.Kind != StackUnderflow || !strings.Contains(runtimeErr.Error(), "Found no 0 on the stack to end the string") {
+		t.Errorf("Got error %v, want a stack underflow", execErr)
+	}
+	if output != "" {
+		t.Errorf("Printed %q of an unterminated string", output)
+	}
+}
@@ -0,0 +1,69 @@
+package interpreter
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// Limits on the resources a program may use. A limit of 0 means no limit.
+type Limits struct {
+	// Number of instructions to run, and the time to run them in
+	Steps int
+	Time  time.Duration
+
+	// Number of values on the stack, and of nested calls
+	StackDepth int
+	CallDepth  int
+
+	// Number of cells of the tape
+	TapeSize int
+
+	// Number of bytes to print
+	OutputBytes int
+}
+
+// Instructions which leave one more value on the stack than they found
+var growsStack = map[string]bool{
+	"pusht": true, "push": true, "dup": true, "over": true, "pick": true, "read": true, "readnum": true,
+}
+
+// Checks if running the command would exceed the limits of the stack, the return stack or the tape.
+// Returns nil if the command may run.
+func (m *Machine) checkLimits(cmd string, name string) error {
+	if growsStack[name] {
+		if stackErr := m.Limits.CheckStackDepth(m.Stack.Size() + 1); stackErr != nil {
+			return m.fail(LimitExceeded, cmd, nil, "%s", stackErr.Error())
+		}
+	}
+	if m.Limits.CallDepth > 0 && name == "call" && m.ReturnStack.Size() >= m.Limits.CallDepth {
+		return m.fail(LimitExceeded, cmd, nil, "Exceeded the maximum call depth of %d", m.Limits.CallDepth)
+	}
+	if name == "right" {
+		if tapeErr := m.Limits.CheckCell(int(m.Tape.head) + 1); tapeErr != nil {
+			return m.fail(LimitExceeded, cmd, nil, "%s", tapeErr.Error())
+		}
+	}
+	return nil
+}
+
+// Checks if the tape may hold the cell at the given position without exceeding its maximum size, e.g. before moving
+// the head there. Returns nil if it may.
+func (l Limits) CheckCell(pos int) error {
+	if pos < 0 {
+		return errors.New(fmt.Sprintf("There's no cell %d, the tape starts at cell 0", pos))
+	}
+	if l.TapeSize > 0 && pos >= l.TapeSize {
+		return errors.New(fmt.Sprintf("Exceeded the maximum tape size of %d cells", l.TapeSize))
+	}
+	return nil
+}
+
+// Checks if the stack may hold the given number of values without exceeding its maximum depth, e.g. before pushing a
+// value. Returns nil if it may.
+func (l Limits) CheckStackDepth(depth int) error {
+	if l.StackDepth > 0 && depth > l.StackDepth {
+		return errors.New(fmt.Sprintf("Exceeded the maximum stack depth of %d", l.StackDepth))
+	}
+	return nil
+}
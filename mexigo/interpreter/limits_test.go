@@ -0,0 +1,137 @@
+package interpreter
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Returns an interpreter running the commands, one per line starting at line 0, within the given limits
+func limitedInterpreter(t *testing.T, limits Limits, output *bytes.Buffer, cmds ...string) *Interpreter {
+	t.Helper()
+
+	var program []Codeline
+	for linenumber, cmd := range cmds {
+		program = append(program, Codeline{Linenumber: linenumber, Code: cmd})
+	}
+	var i Interpreter
+	if setErr := i.SetCommands(program); setErr != nil {
+		t.Fatalf("SetCommands: %s", setErr.Error())
+	}
+	i.SetIO(strings.NewReader(""), output)
+	i.SetLimits(limits)
+	return &i
+}
+
+// Checks that the error is a *RuntimeError of the given kind, raised in the given line, with the given message
+func checkRuntimeError(t *testing.T, name string, err error, kind ErrorKind, line int, message string) {
+	t.Helper()
+
+	runtimeErr, isRuntimeErr := err.(*RuntimeError)
+	if !isRuntimeErr {
+		t.Errorf("%s: got error %v, want a *RuntimeError", name, err)
+		return
+	}
+	if runtimeErr.Kind != kind || runtimeErr.Line != line || !strings.Contains(runtimeErr.Message, message) {
+		t.Errorf("%s: got %s in line %d: %s, want %s in line %d containing %q", name, runtimeErr.Kind.String(), runtimeErr.Line, runtimeErr.Message, kind.String(), line, message)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits Limits
+		cmds   []string
+
+		// The line the limit is exceeded in, the part of the message, and what the program printed until then
+		line    int
+		want    string
+		printed string
+	}{
+		{
+			name:   "steps",
+			limits: Limits{Steps: 5},
+			cmds:   []string{"push 0", "jmp"},
+			line:   1,
+			want:   "Exceeded the maximum of 5 steps",
+		},
+		{
+			name:   "time",
+			limits: Limits{Time: 10 * time.Millisecond},
+			cmds:   []string{"push 0", "jmp"},
+			want:   "Exceeded the maximum run time of 10ms",
+		},
+		{
+			name:   "stack depth",
+			limits: Limits{StackDepth: 2},
+			cmds:   []string{"push 1", "dup", "pick 1"},
+			line:   2,
+			want:   "Exceeded the maximum stack depth of 2",
+		},
+		{
+			name:   "tape size",
+			limits: Limits{TapeSize: 2},
+			cmds:   []string{"right", "right"},
+			line:   1,
+			want:   "Exceeded the maximum tape size of 2 cells",
+		},
+		{
+			name:    "output",
+			limits:  Limits{OutputBytes: 3},
+			cmds:    []string{"push 72", "print", "push 105", "print", "push 228", "print"},
+			line:    5,
+			want:    "Exceeded the maximum output of 3 bytes",
+			printed: "Hi",
+		},
+		{
+			name:   "call depth",
+			limits: Limits{CallDepth: 3},
+			cmds:   []string{"push 0", "call"},
+			line:   1,
+			want:   "Exceeded the maximum call depth of 3",
+		},
+	}
+
+	for _, test := range tests {
+		var output bytes.Buffer
+		i := limitedInterpreter(t, test.limits, &output, test.cmds...)
+		runErr := i.Run()
+		if test.limits.Time > 0 {
+			// The limit may be hit in any line of the loop
+			test.line = i.ProgramCounter()
+		}
+		checkRuntimeError(t, test.name, runErr, LimitExceeded, test.line, test.want)
+		if output.String() != test.printed {
+			t.Errorf("%s: Printed %q, want %q", test.name, output.String(), test.printed)
+		}
+	}
+}
+
+func TestRunContextCanceled(t *testing.T) {
+	// Canceled before the program starts
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	i := limitedInterpreter(t, Limits{}, &bytes.Buffer{}, "push 0", "jmp")
+	checkRuntimeError(t, "canceled", i.RunContext(ctx), Canceled, 0, "Stopped after 0 steps")
+
+	// Canceled while the program runs
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	i = limitedInterpreter(t, Limits{}, &bytes.Buffer{}, "push 0", "jmp")
+	runErr := i.RunContext(ctx)
+	checkRuntimeError(t, "timed out", runErr, Canceled, i.ProgramCounter(), "context deadline exceeded")
+	if runtimeErr, isRuntimeErr := runErr.(*RuntimeError); isRuntimeErr && runtimeErr.Cause != context.DeadlineExceeded {
+		t.Errorf("Got cause %v, want the error of the context", runtimeErr.Cause)
+	}
+}
+
+func TestCheckRunLimits(t *testing.T) {
+	i := limitedInterpreter(t, Limits{Steps: 2, Time: time.Second}, &bytes.Buffer{}, "push 1", "push 2")
+	if limitErr := i.CheckRunLimits(1, time.Second); limitErr != nil {
+		t.Errorf("Got error %s within the limits", limitErr.Error())
+	}
+	checkRuntimeError(t, "steps", i.CheckRunLimits(2, 0), LimitExceeded, 0, "Exceeded the maximum of 2 steps")
+	checkRuntimeError(t, "time", i.CheckRunLimits(0, 2*time.Second), LimitExceeded, 0, "Exceeded the maximum run time of 1s after 0 steps")
+}
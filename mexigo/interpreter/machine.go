@@ -1,22 +1,70 @@
 package interpreter
 
 import (
-	"fmt"
-	"github.com/pkg/errors"
-	"os"
+	"bufio"
+	"io"
 	"strconv"
 	"strings"
 )
 
+// Number of values each instruction needs on the stack. pick and roll need as many more as their argument says.
+var stackUsage = map[string]int{
+	"pop": 1, "dup": 1, "del": 1, "swap": 2, "over": 2, "rot": 3, "pick": 1, "roll": 1,
+	"eq": 2, "not": 1, "gt": 2, "lt": 2, "add": 2, "sub": 2, "mult": 2, "div": 2, "mod": 2,
+	"and": 2, "or": 2, "xor": 2, "shl": 2, "shr": 2, "pow": 2, "min": 2, "max": 2, "neg": 1, "abs": 1, "lnot": 1,
+	"print": 1, "printnum": 1, "printstr": 1, "jmp": 1, "jmpc": 2, "call": 1,
+}
+
 type Machine struct {
 	Stack Stack
 	Tape Tape
+
+	// The line numbers to return to from subroutines, one for each active call
+	ReturnStack Stack
+
+	// Limits on the resources the program may use
+	Limits Limits
+
+	// Number of bytes printed so far
+	written int
+
+	// The line number of the command currently running, set by the interpreter. Calls return to the line after it.
+	Line int
+
+	// The line number of the first command, set by the interpreter. Only linked libraries live below line 0, so jumps
+	// to negative line numbers below it fail.
+	firstLine int
+
+	// Where read takes its characters from, and print writes them to. Default to stdin and stdout. Use SetInput to
+	// change the input once the machine has read from it.
+	Input  io.Reader
+	Output io.Writer
+
+	// How print writes values
+	OutputMode OutputMode
+
+	// Buffers the input, so characters are read one at a time
+	reader *bufio.Reader
 }
 
 // Runs the given command.
 // Returns the next line (comparable to the 'Program Counter') to be executed, but just if doJump is true.
-// May also return an error. It's advised to stop the execution of further commands if this command throws an error.
+// May also return an error, which is a *RuntimeError. It's advised to stop the execution of further commands if this
+// command throws an error. Commands failing because of the values on the stack don't change the machine.
 func (m *Machine) RunCommand(cmd string) (jumpLine int, doJump bool, execErr error) {
+	// Make sure the stack holds enough values for the command, before it changes anything
+	name := strings.SplitN(cmd, " ", 2)[0]
+	if needed, isKnown := stackUsage[name]; isKnown && m.Stack.Size() < needed {
+		execErr = m.fail(StackUnderflow, cmd, nil, "'%s' needs %d values on the stack, but it holds %d", name, needed, m.Stack.Size())
+		return
+	}
+	if execErr = m.checkLimits(cmd, name); execErr != nil {
+		return
+	}
+	if execErr = m.checkJump(cmd); execErr != nil {
+		return
+	}
+
 	// Let's check which command we are told to run.
 	if cmd == "left" {
 		// Moves the tape head one cell to the left
@@ -37,27 +85,70 @@ func (m *Machine) RunCommand(cmd string) (jumpLine int, doJump bool, execErr err
 		intVal, atoiErr := strconv.Atoi(strVal)
 		if atoiErr != nil {
 			// Conversion failed.
-			execErr = errors.New(fmt.Sprintf("Tried to push non-integer value '%s' to the stack. %s", strVal, atoiErr.Error()))
+			execErr = m.fail(UnknownInstruction, cmd, atoiErr, "Tried to push non-integer value '%s' to the stack", strVal)
 			return
 		} else {
 			// Conversion successful, push constant
 			m.Stack.Push(intVal)
 		}
+	} else if strings.HasPrefix(cmd, "pick ") || strings.HasPrefix(cmd, "roll ") {
+		// Copies (pick) or moves (roll) the value at stack[n] on top of the stack
+		strVal := strings.Trim(cmd[5:], " ")
+		depth, atoiErr := strconv.Atoi(strVal)
+		if atoiErr != nil {
+			execErr = m.fail(UnknownInstruction, cmd, atoiErr, "Tried to use non-integer value '%s' as position on the stack", strVal)
+			return
+		}
+		if depth < 0 {
+			execErr = m.fail(InvalidArgument, cmd, nil, "Tried to use negative value '%d' as position on the stack", depth)
+			return
+		}
+		if depth >= m.Stack.Size() {
+			execErr = m.fail(StackUnderflow, cmd, nil, "Tried to %s stack[%d], but the stack only holds %d values", cmd[:4], depth, m.Stack.Size())
+			return
+		}
+
+		if cmd[:4] == "pick" {
+			m.Stack.Push(m.Stack.Peek(depth))
+		} else {
+			m.Stack.Push(m.Stack.Remove(depth))
+		}
 	} else if cmd == "pop" {
 		// Pops top stack value to the current cell
-		m.Tape.Set(m.Stack.Pop())
+		m.Tape.Set(m.Stack.pop())
 	} else if cmd == "dup" {
 		// Duplicates the topmost stack value
-		val := m.Stack.Pop()
+		val := m.Stack.pop()
 		m.Stack.Push(val)
 		m.Stack.Push(val)
 	} else if cmd == "del" {
 		// Deletes the topmost stack value, ignoring its value
-		m.Stack.Pop()
+		m.Stack.pop()
+	} else if cmd == "swap" {
+		// Swaps stack[0] and stack[1]
+		stack0 := m.Stack.pop()
+		stack1 := m.Stack.pop()
+		m.Stack.Push(stack0)
+		m.Stack.Push(stack1)
+	} else if cmd == "over" {
+		// Copies stack[1] on top of the stack
+		stack0 := m.Stack.pop()
+		stack1 := m.Stack.pop()
+		m.Stack.Push(stack1)
+		m.Stack.Push(stack0)
+		m.Stack.Push(stack1)
+	} else if cmd == "rot" {
+		// Moves stack[2] on top of the stack
+		stack0 := m.Stack.pop()
+		stack1 := m.Stack.pop()
+		stack2 := m.Stack.pop()
+		m.Stack.Push(stack1)
+		m.Stack.Push(stack0)
+		m.Stack.Push(stack2)
 	} else if cmd == "eq" {
 		// Checks if stack[0] == stack[1]. Pushes 1 to the stack if equal, 0 otherwise
-		stack0 := m.Stack.Pop()
-		stack1 := m.Stack.Pop()
+		stack0 := m.Stack.pop()
+		stack1 := m.Stack.pop()
 
 		if stack0 == stack1 {
 			m.Stack.Push(1)
@@ -66,21 +157,16 @@ func (m *Machine) RunCommand(cmd string) (jumpLine int, doJump bool, execErr err
 		}
 	} else if cmd == "not" {
 		// Inverses stack[0]
-		stack0 := m.Stack.Pop()
-
-		if stack0 == 0 {
-			m.Stack.Push(1)
-		} else if stack0 == 1 {
-			m.Stack.Push(0)
-		} else {
+		if stack0 := m.Stack.Peek(0); stack0 != 0 && stack0 != 1 {
 			// Not a binary number, not going to inverse it.
-			execErr = errors.New(fmt.Sprintf("Tried to inverse non-binary integer value '%d'", stack0))
+			execErr = m.fail(InvalidArgument, cmd, nil, "Tried to inverse non-binary integer value '%d'", stack0)
 			return
 		}
+		m.Stack.Push(1 - m.Stack.pop())
 	} else if cmd == "gt" {
 		// Checks if stack[0] > stack[1]. Pushes 1 to the stack if greater, 0 otherwise
-		stack0 := m.Stack.Pop()
-		stack1 := m.Stack.Pop()
+		stack0 := m.Stack.pop()
+		stack1 := m.Stack.pop()
 
 		if stack0 > stack1 {
 			m.Stack.Push(1)
@@ -89,8 +175,8 @@ func (m *Machine) RunCommand(cmd string) (jumpLine int, doJump bool, execErr err
 		}
 	} else if cmd == "lt" {
 		// Checks if stack[0] < stack[1]. Pushes 1 to the stack if greater, 0 otherwise
-		stack0 := m.Stack.Pop()
-		stack1 := m.Stack.Pop()
+		stack0 := m.Stack.pop()
+		stack1 := m.Stack.pop()
 
 		if stack0 < stack1 {
 			m.Stack.Push(1)
@@ -99,62 +185,188 @@ func (m *Machine) RunCommand(cmd string) (jumpLine int, doJump bool, execErr err
 		}
 	} else if cmd == "add" {
 		// Calculates stack[0] + stack[1], and pushes the result to the stack
-		m.Stack.Push(m.Stack.Pop() + m.Stack.Pop())
+		m.Stack.Push(m.Stack.pop() + m.Stack.pop())
 	} else if cmd == "sub" {
 		// Calculates stack[0] - stack[1], and pushes the result to the stack
-		m.Stack.Push(m.Stack.Pop() - m.Stack.Pop())
+		m.Stack.Push(m.Stack.pop() - m.Stack.pop())
 	} else if cmd == "mult" {
 		// Calculates stack[0] * stack[1], and pushes the result to the stack
-		m.Stack.Push(m.Stack.Pop() * m.Stack.Pop())
+		m.Stack.Push(m.Stack.pop() * m.Stack.pop())
 	} else if cmd == "div" {
 		// Calculates stack[0] / stack[1], and pushes the result to the stack
-		m.Stack.Push(m.Stack.Pop() / m.Stack.Pop())
+		if m.Stack.Peek(1) == 0 {
+			execErr = m.fail(DivisionByZero, cmd, nil, "Tried to divide %d by zero", m.Stack.Peek(0))
+			return
+		}
+		m.Stack.Push(m.Stack.pop() / m.Stack.pop())
 	} else if cmd == "mod" {
 		// Calculates stack[0] % stack[1], and pushes the result to the stack
-		m.Stack.Push(m.Stack.Pop() % m.Stack.Pop())
-	} else if cmd == "read" {
-		// Reads a character from the user, and pushes its char value to the stack
-		var readChar []byte
-
-		// Read character(s)
-		numChars, readErr := os.Stdin.Read(readChar)
-		if readErr != nil {
-			// Failed to read from stdin.
-			execErr = errors.New(fmt.Sprintf("Failed to read character from stdin: %s", readErr.Error()))
+		if m.Stack.Peek(1) == 0 {
+			execErr = m.fail(DivisionByZero, cmd, nil, "Tried to divide %d by zero", m.Stack.Peek(0))
 			return
 		}
-
-		if numChars < 1 || readChar == nil {
-			// Didn't even read a single character.
-			execErr = errors.New("Failed to read character from stdin.")
+		m.Stack.Push(m.Stack.pop() % m.Stack.pop())
+	} else if cmd == "and" {
+		// Calculates stack[0] & stack[1] bitwise, and pushes the result to the stack
+		m.Stack.Push(m.Stack.pop() & m.Stack.pop())
+	} else if cmd == "or" {
+		// Calculates stack[0] | stack[1] bitwise, and pushes the result to the stack
+		m.Stack.Push(m.Stack.pop() | m.Stack.pop())
+	} else if cmd == "xor" {
+		// Calculates stack[0] ^ stack[1] bitwise, and pushes the result to the stack
+		m.Stack.Push(m.Stack.pop() ^ m.Stack.pop())
+	} else if cmd == "shl" || cmd == "shr" || cmd == "pow" {
+		// Shifts stack[0] left or right by stack[1] bits, or raises it to the power of stack[1], and pushes the result to the stack
+		if m.Stack.Peek(1) < 0 {
+			execErr = m.fail(InvalidArgument, cmd, nil, "Tried to %s %d by the negative value %d", cmd, m.Stack.Peek(0), m.Stack.Peek(1))
 			return
 		}
+		stack0 := m.Stack.pop()
+		stack1 := m.Stack.pop()
 
-		// Push character to stack
-		m.Stack.Push(int(readChar[0]))
-
-		// Check if user typed more than asked for
-		if numChars > 1 {
-			// Ugh, what a spammer
-			execErr = errors.New("Read more than one character - ignoring all but the first character.")
+		if cmd == "shl" {
+			m.Stack.Push(stack0 << uint(stack1))
+		} else if cmd == "shr" {
+			// Keeps the sign, so -8 shifted right by 1 is -4
+			m.Stack.Push(stack0 >> uint(stack1))
+		} else {
+			m.Stack.Push(Power(stack0, stack1))
+		}
+	} else if cmd == "min" {
+		// Pushes the smaller one of stack[0] and stack[1] to the stack
+		stack0 := m.Stack.pop()
+		stack1 := m.Stack.pop()
+		if stack1 < stack0 {
+			stack0 = stack1
+		}
+		m.Stack.Push(stack0)
+	} else if cmd == "max" {
+		// Pushes the greater one of stack[0] and stack[1] to the stack
+		stack0 := m.Stack.pop()
+		stack1 := m.Stack.pop()
+		if stack1 > stack0 {
+			stack0 = stack1
+		}
+		m.Stack.Push(stack0)
+	} else if cmd == "neg" {
+		// Negates stack[0]
+		m.Stack.Push(-m.Stack.pop())
+	} else if cmd == "abs" {
+		// Pushes the absolute value of stack[0]
+		stack0 := m.Stack.pop()
+		if stack0 < 0 {
+			stack0 = -stack0
+		}
+		m.Stack.Push(stack0)
+	} else if cmd == "lnot" {
+		// Inverses stack[0] logically: 0 becomes 1, any other value becomes 0
+		if m.Stack.pop() == 0 {
+			m.Stack.Push(1)
+		} else {
+			m.Stack.Push(0)
+		}
+	} else if cmd == "read" {
+		// Reads a character from the input, and pushes its char value to the stack - or -1 at the end of the input
+		char, readErr := m.readCharacter()
+		if readErr != nil {
+			execErr = m.fail(IOError, cmd, readErr, "Failed to read character: %s", readErr.Error())
 			return
 		}
+		m.Stack.Push(char)
 	} else if cmd == "print" {
 		// Prints stack[0] as a character
-		val := m.Stack.Pop()
-		fmt.Printf("%q (%d)\n", rune(val), val)
+		if execErr = m.write(cmd, m.formatCharacter(m.Stack.Peek(0))); execErr != nil {
+			return
+		}
+		m.Stack.pop()
+	} else if cmd == "printnum" {
+		// Prints stack[0] as decimal number
+		if execErr = m.write(cmd, m.formatNumber(m.Stack.Peek(0))); execErr != nil {
+			return
+		}
+		m.Stack.pop()
+	} else if cmd == "readnum" {
+		// Reads a signed decimal number from the input, and pushes it to the stack
+		num, readErr := m.readNumber()
+		if readErr != nil {
+			execErr = m.fail(IOError, cmd, readErr, "Failed to read number: %s", readErr.Error())
+			return
+		}
+		m.Stack.Push(num)
+	} else if cmd == "printstr" {
+		// Prints characters off the stack, starting with stack[0], until reaching a 0 - which is removed as well
+		length := 0
+		for length < m.Stack.Size() && m.Stack.Peek(length) != 0 {
+			length++
+		}
+		if length == m.Stack.Size() {
+			execErr = m.fail(StackUnderflow, cmd, nil, "Found no 0 on the stack to end the string")
+			return
+		}
+		var text strings.Builder
+		for i := 0; i < length; i++ {
+			text.WriteString(m.formatCharacter(m.Stack.Peek(i)))
+		}
+		if execErr = m.write(cmd, text.String()); execErr != nil {
+			return
+		}
+		for ; length >= 0; length-- {
+			m.Stack.pop()
+		}
 	} else if cmd == "jmp" {
 		// Jumps to the line number specified by stack[0]
-		jumpLine = m.Stack.Pop()
+		jumpLine = m.Stack.pop()
 		doJump = true
 	} else if cmd == "jmpc" {
 		// Jumps to the line number specified by stack[0], if stack[1] is not 0.
-		jumpLine = m.Stack.Pop()
-		doJump = m.Stack.Pop() != 0
+		jumpLine = m.Stack.pop()
+		doJump = m.Stack.pop() != 0
+	} else if cmd == "call" {
+		// Calls the subroutine at the line number specified by stack[0], returning to the next line afterwards
+		jumpLine = m.Stack.pop()
+		doJump = true
+		m.ReturnStack.Push(m.Line + 1)
+	} else if cmd == "ret" {
+		// Returns from the subroutine to the line after the call
+		if len(m.ReturnStack.values) == 0 {
+			execErr = m.fail(InvalidJump, cmd, nil, "Tried to return from a subroutine, but the return stack is empty - there was no call to return from")
+			return
+		}
+		jumpLine = m.ReturnStack.pop()
+		doJump = true
 	} else {
 		// ... no such command.
-		execErr = errors.New(fmt.Sprintf("Command not found: %s", cmd))
+		execErr = m.fail(UnknownInstruction, cmd, nil, "Command not found: %s", cmd)
 	}
 
 	return
 }
+
+// Makes sure a jump, call or taken conditional jump doesn't lead to a negative line number, unless a library is linked
+// there. Without this, the program would simply go on at its first line.
+func (m *Machine) checkJump(cmd string) error {
+	if cmd != "jmp" && cmd != "jmpc" && cmd != "call" {
+		return nil
+	}
+	if cmd == "jmpc" && m.Stack.Peek(1) == 0 {
+		// Not taken, so the target doesn't matter
+		return nil
+	}
+	if target := m.Stack.Peek(0); target < 0 && target < m.firstLine {
+		return m.fail(InvalidJump, cmd, nil, "Tried to jump to line %d, but line numbers below 0 are reserved for libraries, and none is linked there", target)
+	}
+	return nil
+}
+
+// Raises the base to the given non-negative power, like pow does. Just like multiplication, the result wraps around on
+// overflow.
+func Power(base int, exponent int) int {
+	result := 1
+	for ; exponent > 0; exponent >>= 1 {
+		if exponent&1 == 1 {
+			result *= base
+		}
+		base *= base
+	}
+	return result
+}
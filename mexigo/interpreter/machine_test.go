@@ -0,0 +1,273 @@
+package interpreter
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Runs the command on a machine holding the given stack, with stack[0] being the topmost value.
+// Returns the stack afterwards, topmost value first.
+func runOnStack(t *testing.T, stack []int, cmd string) ([]int, error) {
+	t.Helper()
+
+	var m Machine
+	for i := len(stack) - 1; i >= 0; i-- {
+		m.Stack.Push(stack[i])
+	}
+	_, _, execErr := m.RunCommand(cmd)
+
+	result := []int{}
+	for i := 0; i < m.Stack.Size(); i++ {
+		result = append(result, m.Stack.Peek(i))
+	}
+	return result, execErr
+}
+
+func TestArithmeticOperandOrder(t *testing.T) {
+	tests := []struct {
+		cmd   string
+		stack []int
+		want  int
+	}{
+		// stack[0] is the left operand, stack[1] the right one
+		{"sub", []int{-3, 5}, -8},
+		{"sub", []int{5, -3}, 8},
+		{"sub", []int{-3, -5}, 2},
+		{"div", []int{-7, 2}, -3},
+		{"div", []int{7, -2}, -3},
+		{"div", []int{-7, -2}, 3},
+		{"div", []int{2, -7}, 0},
+		{"mod", []int{-7, 2}, -1},
+		{"mod", []int{7, -2}, 1},
+		{"mod", []int{-7, -2}, -1},
+		{"pow", []int{-2, 3}, -8},
+		{"pow", []int{-3, 2}, 9},
+		{"pow", []int{-5, 0}, 1},
+		{"pow", []int{2, 10}, 1024},
+		{"shl", []int{-1, 4}, -16},
+		{"shl", []int{-3, 1}, -6},
+		{"shr", []int{-8, 1}, -4},
+		{"shr", []int{-1, 10}, -1},
+		{"shr", []int{-9, 1}, -5},
+		{"and", []int{-4, 6}, 4},
+		{"or", []int{-8, 3}, -5},
+		{"xor", []int{-1, 5}, -6},
+		{"min", []int{-3, 2}, -3},
+		{"min", []int{2, -3}, -3},
+		{"max", []int{-3, 2}, 2},
+		{"max", []int{2, -3}, 2},
+		// Unary operations only take stack[0]
+		{"neg", []int{-5}, 5},
+		{"neg", []int{0}, 0},
+		{"abs", []int{-5}, 5},
+		{"abs", []int{5}, 5},
+		{"lnot", []int{0}, 1},
+		{"lnot", []int{-3}, 0},
+	}
+
+	for _, test := range tests {
+		stack, execErr := runOnStack(t, test.stack, test.cmd)
+		if execErr != nil {
+			t.Errorf("%s on %v: unexpected error: %s", test.cmd, test.stack, execErr.Error())
+			continue
+		}
+		if !reflect.DeepEqual(stack, []int{test.want}) {
+			t.Errorf("%s on %v: got stack %v, want [%d]", test.cmd, test.stack, stack, test.want)
+		}
+	}
+}
+
+func TestStackOperandOrder(t *testing.T) {
+	tests := []struct {
+		cmd   string
+		stack []int
+		want  []int
+	}{
+		{"swap", []int{1, 2, 3}, []int{2, 1, 3}},
+		{"over", []int{1, 2}, []int{2, 1, 2}},
+		{"rot", []int{1, 2, 3, 4}, []int{3, 1, 2, 4}},
+		{"pick 0", []int{1, 2, 3}, []int{1, 1, 2, 3}},
+		{"pick 2", []int{1, 2, 3}, []int{3, 1, 2, 3}},
+		{"roll 0", []int{1, 2, 3}, []int{1, 2, 3}},
+		{"roll 1", []int{1, 2, 3}, []int{2, 1, 3}},
+		{"roll 2", []int{1, 2, 3}, []int{3, 1, 2}},
+	}
+
+	for _, test := range tests {
+		stack, execErr := runOnStack(t, test.stack, test.cmd)
+		if execErr != nil {
+			t.Errorf("%s on %v: unexpected error: %s", test.cmd, test.stack, execErr.Error())
+			continue
+		}
+		if !reflect.DeepEqual(stack, test.want) {
+			t.Errorf("%s on %v: got stack %v, want %v", test.cmd, test.stack, stack, test.want)
+		}
+	}
+}
+
+func TestRuntimeErrorKinds(t *testing.T) {
+	tests := []struct {
+		cmd   string
+		stack []int
+		want  ErrorKind
+	}{
+		{"add", []int{1}, StackUnderflow},
+		{"rot", []int{1, 2}, StackUnderflow},
+		{"dup", []int{}, StackUnderflow},
+		{"pick 2", []int{1, 2}, StackUnderflow},
+		{"roll 5", []int{1, 2}, StackUnderflow},
+		{"pick -1", []int{1, 2}, InvalidArgument},
+		{"roll -1", []int{1, 2}, InvalidArgument},
+		{"pick x", []int{1, 2}, UnknownInstruction},
+		{"printstr", []int{72, 105}, StackUnderflow},
+		{"div", []int{5, 0}, DivisionByZero},
+		{"div", []int{0, 0}, DivisionByZero},
+		{"mod", []int{-5, 0}, DivisionByZero},
+		{"not", []int{2}, InvalidArgument},
+		{"not", []int{-1}, InvalidArgument},
+		{"shl", []int{1, -1}, InvalidArgument},
+		{"shr", []int{-8, -1}, InvalidArgument},
+		{"pow", []int{2, -1}, InvalidArgument},
+		{"jmp", []int{-5}, InvalidJump},
+		{"jmpc", []int{-5, 1}, InvalidJump},
+		{"call", []int{-1}, InvalidJump},
+		{"ret", []int{}, InvalidJump},
+	}
+
+	for _, test := range tests {
+		stack, execErr := runOnStack(t, test.stack, test.cmd)
+		runtimeErr, isRuntimeErr := execErr.(*RuntimeError)
+		if !isRuntimeErr {
+			t.Errorf("%s on %v: got error %v, want a *RuntimeError", test.cmd, test.stack, execErr)
+			continue
+		}
+		if runtimeErr.Kind != test.want {
+			t.Errorf("%s on %v: got %s, want %s", test.cmd, test.stack, runtimeErr.Kind.String(), test.want.String())
+		}
+
+		// Failing commands don't change the machine
+		if !reflect.DeepEqual(stack, test.stack) {
+			t.Errorf("%s on %v: stack changed to %v", test.cmd, test.stack, stack)
+		}
+	}
+}
+
+func TestStackPop(t *testing.T) {
+	var s Stack
+	if _, popErr := s.Pop(); popErr != ErrEmptyStack {
+		t.Errorf("Pop on empty stack: got error %v, want ErrEmptyStack", popErr)
+	}
+
+	s.Push(-4)
+	val, popErr := s.Pop()
+	if popErr != nil || val != -4 {
+		t.Errorf("Pop: got %d, %v, want -4, nil", val, popErr)
+	}
+}
+
+func TestNegativeJumps(t *testing.T) {
+	// Conditional jumps which aren't taken don't care about their target
+	if _, execErr := runOnStack(t, []int{-5, 0}, "jmpc"); execErr != nil {
+		t.Errorf("jmpc not taken: %s", execErr.Error())
+	}
+
+	// Libraries are linked below line 0, the program starts at line 0 nevertheless
+	library := []Codeline{{Linenumber: -2, Code: "ret"}}
+	program := []Codeline{{Linenumber: 0, Code: "push -2"}, {Linenumber: 1, Code: "call"}}
+	var linked Interpreter
+	if setErr := linked.SetCommands(append(library, program...)); setErr != nil {
+		t.Fatalf("SetCommands: %s", setErr.Error())
+	}
+	if runErr := linked.Run(); runErr != nil {
+		t.Errorf("Calling the library failed: %s", runErr.Error())
+	}
+
+	var unlinked Interpreter
+	if setErr := unlinked.SetCommands(program); setErr != nil {
+		t.Fatalf("SetCommands: %s", setErr.Error())
+	}
+	if runtimeErr, isRuntimeErr := unlinked.Run().(*RuntimeError); !isRuntimeErr || runtimeErr.Kind != InvalidJump || runtimeErr.Line != 1 {
+		t.Errorf("Calling line -2 without a library there: got %v, want an invalid jump in line 1", runtimeErr)
+	}
+}
+
+// Squares 3 in a subroutine called by another one, which adds 1, and prints the result
+var nestedCalls = []Codeline{
+	{Linenumber: 0, Code: "push 3"},
+	{Linenumber: 1, Code: "push 10"},
+	{Linenumber: 2, Code: "call"},
+	{Linenumber: 3, Code: "printnum"},
+	{Linenumber: 4, Code: "push 100"},
+	{Linenumber: 5, Code: "jmp"},
+	{Linenumber: 10, Code: "push 20"},
+	{Linenumber: 11, Code: "call"},
+	{Linenumber: 12, Code: "push 1"},
+	{Linenumber: 13, Code: "add"},
+	{Linenumber: 14, Code: "ret"},
+	{Linenumber: 20, Code: "dup"},
+	{Linenumber: 21, Code: "mult"},
+	{Linenumber: 22, Code: "ret"},
+}
+
+func TestCallAndReturn(t *testing.T) {
+	var i Interpreter
+	var output bytes.Buffer
+	i.SetIO(strings.NewReader(""), &output)
+	if setErr := i.SetCommands(nestedCalls); setErr != nil {
+		t.Fatalf("SetCommands: %s", setErr.Error())
+	}
+
+	// Inside the inner subroutine, both calls return to the line after them
+	for i.ProgramCounter() != 20 {
+		if _, stepErr := i.Step(); stepErr != nil {
+			t.Fatalf("Step: %s", stepErr.Error())
+		}
+	}
+	returns := &i.Machine().ReturnStack
+	if returns.Size() != 2 || returns.Peek(0) != 12 || returns.Peek(1) != 3 {
+		t.Errorf("Got %d return lines, want [12 3]", returns.Size())
+	}
+
+	if runErr := i.Run(); runErr != nil {
+		t.Fatalf("Run: %s", runErr.Error())
+	}
+	if output.String() != "10" || returns.Size() != 0 {
+		t.Errorf("Printed %q with %d return lines left, want \"10\" and none", output.String(), returns.Size())
+	}
+}
+
+func TestCallDepthLimit(t *testing.T) {
+	tests := []struct {
+		limit int
+		fails bool
+	}{
+		{0, false},
+		{2, false},
+		{1, true},
+	}
+
+	for _, test := range tests {
+		var i Interpreter
+		i.SetIO(strings.NewReader(""), &bytes.Buffer{})
+		i.SetLimits(Limits{CallDepth: test.limit})
+		if setErr := i.SetCommands(nestedCalls); setErr != nil {
+			t.Fatalf("SetCommands: %s", setErr.Error())
+		}
+		runErr := i.Run()
+		if !test.fails {
+			if runErr != nil {
+				t.Errorf("Limit %d: Run: %s", test.limit, runErr.Error())
+			}
+			continue
+		}
+
+		// The call exceeding the limit fails without jumping
+		checkRuntimeError(t, fmt.Sprintf("Limit %d", test.limit), runErr, LimitExceeded, 11, "Exceeded the maximum call depth of 1")
+		if i.ProgramCounter() != 11 || i.Machine().ReturnStack.Size() != 1 {
+			t.Errorf("Limit %d: Stopped at line %d with %d return lines", test.limit, i.ProgramCounter(), i.Machine().ReturnStack.Size())
+		}
+	}
+}
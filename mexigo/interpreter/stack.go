@@ -1,6 +1,12 @@
 package interpreter
 
-import "log"
+import (
+	"fmt"
+	"github.com/pkg/errors"
+)
+
+// Returned when popping a value off an empty stack
+var ErrEmptyStack = errors.New("Tried to pop value from empty stack")
 
 type Stack struct {
 	values []int
@@ -11,17 +17,49 @@ func (s *Stack) Push(val int) {
 	s.values = append(s.values, val)
 }
 
-// Pops the top element from the stack and return its value
-func (s *Stack) Pop() int {
+// Pops the top element from the stack and returns its value, or an error if the stack is empty
+func (s *Stack) Pop() (int, error) {
 	// Check if the stack contains at least one element
-	if len(s.values) > 0 {
-		// There's at least one element, pop it: get value and delete element
-		val := s.values[len(s.values)-1]
-		s.values = s.values[:len(s.values)-1]
-		return val
+	if len(s.values) == 0 {
+		// Stack is empty, but we should pop... Damn.
+		return 0, ErrEmptyStack
 	}
+	return s.pop(), nil
+}
+
+// Pops the top element from the stack and returns its value. The caller needs to make sure the stack isn't empty, like
+// the machine does before running a command.
+func (s *Stack) pop() int {
+	val := s.values[len(s.values)-1]
+	s.values = s.values[:len(s.values)-1]
+	return val
+}
+
+// Returns the value at the given depth, with 0 being the topmost value, without removing it.
+// The depth needs to be less than the size of the stack.
+func (s *Stack) Peek(depth int) int {
+	return s.values[len(s.values)-1-depth]
+}
+
+// Removes the value at the given depth from the stack, with 0 being the topmost value, and returns it.
+// The depth needs to be less than the size of the stack.
+func (s *Stack) Remove(depth int) int {
+	index := len(s.values) - 1 - depth
+	val := s.values[index]
+	s.values = append(s.values[:index], s.values[index+1:]...)
+	return val
+}
+
+// Replaces the value at the given depth, with 0 being the topmost value. Returns an error if there is no value at that depth.
+func (s *Stack) Set(depth int, val int) error {
+	if depth < 0 || depth >= len(s.values) {
+		return errors.New(fmt.Sprintf("There's no value at depth %d, the stack holds %d values", depth, len(s.values)))
+	}
+	s.values[len(s.values)-1-depth] = val
+	return nil
+}
 
-	// Stack is empty, but we should pop... Damn.
-	log.Panic("Tried to pop value from empty stack.")
-	return 0
+// Returns the number of values on the stack
+func (s *Stack) Size() int {
+	return len(s.values)
 }
@@ -49,3 +49,27 @@ func (t *Tape) Set(newVal int) {
 	t.GrowUpTo(t.head)
 	t.cells[t.head] = newVal
 }
+
+// Returns the position of the head
+func (t *Tape) Head() uint {
+	return t.head
+}
+
+// Returns the value of the cell at the given position, without growing the tape
+func (t *Tape) Cell(pos uint) int {
+	if pos >= uint(len(t.cells)) {
+		return 0
+	}
+	return t.cells[pos]
+}
+
+// Sets the cell at the given position to the new value
+func (t *Tape) SetCell(pos uint, newVal int) {
+	t.GrowUpTo(pos)
+	t.cells[pos] = newVal
+}
+
+// Returns the number of cells the tape holds
+func (t *Tape) Size() int {
+	return len(t.cells)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"github.com/maride/mexico/mexigo/interpreter"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+)
+
+var (
+	inputPath  *string
+	outputPath *string
+	printMode  *string
+
+	// The standard input, buffered once, so the program and the debugger can share it
+	stdin = bufio.NewReader(os.Stdin)
+)
+
+// Registers flags required for the input and output of the program
+func registerIOFlags() {
+	inputPath = flag.String("input", "", "File to read the input of the program from, instead of stdin")
+	outputPath = flag.String("output", "", "File to write the output of the program to, instead of stdout")
+	printMode = flag.String("print", "raw", "How to print characters, either 'raw' as text, or 'debug' as quoted character and number, one per line, followed by the state of the machine")
+}
+
+// Sets up the input and output of the interpreter as requested on the command line. The returned files need to be closed after running the program.
+func setupIO(i *interpreter.Interpreter) ([]io.Closer, error) {
+	switch *printMode {
+	case "raw":
+		i.SetOutputMode(interpreter.OutputRaw)
+	case "debug":
+		i.SetOutputMode(interpreter.OutputDebug)
+	default:
+		return nil, errors.New(fmt.Sprintf("Unknown print mode '%s', please use 'raw' or 'debug'", *printMode))
+	}
+
+	var files []io.Closer
+	var input io.Reader = stdin
+	var output io.Writer = os.Stdout
+	if *inputPath != "" {
+		inputFile, openErr := os.Open(*inputPath)
+		if openErr != nil {
+			return nil, errors.New(fmt.Sprintf("Failed to open input file: %s", openErr.Error()))
+		}
+		files = append(files, inputFile)
+		input = inputFile
+	}
+	if *outputPath != "" {
+		outputFile, createErr := os.Create(*outputPath)
+		if createErr != nil {
+			closeAll(files)
+			return nil, errors.New(fmt.Sprintf("Failed to create output file: %s", createErr.Error()))
+		}
+		files = append(files, outputFile)
+		output = outputFile
+	}
+	i.SetIO(input, output)
+	return files, nil
+}
+
+// Closes all the given files
+func closeAll(files []io.Closer) {
+	for _, f := range files {
+		f.Close()
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"flag"
+	"github.com/maride/mexico/mexigo/interpreter"
+	"time"
+)
+
+var (
+	maxSteps     *int
+	maxTime      *time.Duration
+	maxStack     *int
+	maxTape      *int
+	maxOutput    *int
+	maxCallDepth *int
+)
+
+// Registers flags required for limiting the resources a program may use
+func registerLimitFlags() {
+	maxSteps = flag.Int("maxSteps", 100000000, "Maximum number of instructions to run, or 0 for no limit")
+	maxTime = flag.Duration("maxTime", 0, "Maximum time to run the program, e.g. 30s, or 0 for no limit")
+	maxStack = flag.Int("maxStack", 1000000, "Maximum number of values on the stack, or 0 for no limit")
+	maxTape = flag.Int("maxTape", 1000000, "Maximum number of tape cells, or 0 for no limit")
+	maxOutput = flag.Int("maxOutput", 10485760, "Maximum number of bytes to print, or 0 for no limit")
+	maxCallDepth = flag.Int("maxCallDepth", 10000, "Maximum number of nested subroutine calls, or 0 for no limit")
+}
+
+// Applies the limits given on the command line to the interpreter
+func applyLimits(i *interpreter.Interpreter) {
+	i.SetLimits(interpreter.Limits{
+		Steps:       *maxSteps,
+		Time:        *maxTime,
+		StackDepth:  *maxStack,
+		CallDepth:   *maxCallDepth,
+		TapeSize:    *maxTape,
+		OutputBytes: *maxOutput,
+	})
+}
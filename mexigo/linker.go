@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"github.com/maride/mexico/dns"
+	"github.com/maride/mexico/mexico/compiler"
+	"github.com/maride/mexico/mexigo/interpreter"
+	"github.com/pkg/errors"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Number of line numbers reserved for each linked library. Libraries are linked below line 0, so the program
+	// itself keeps its line numbers, and never runs into a library by simply reaching its end.
+	moduleSize = 1 << 24
+)
+
+// Links a program with all the libraries it imports, directly or through other libraries
+type linker struct {
+	// The line number each library starts at, by its domain
+	bases map[string]int
+
+	// The loaded libraries, by their domain
+	libraries map[string]*Program
+
+	// The domains of the libraries currently being linked, to detect import cycles
+	linking []string
+
+	// The line number right behind the program, jumping there ends it
+	end int
+
+	// The linked code of all modules
+	code []interpreter.Codeline
+
+	// The line numbers of the known labels, by their name. Labels of libraries are qualified with the name
+	// they are imported as, like in the source code.
+	labels map[string]int
+}
+
+// Loads all libraries imported by the program, and returns the code of the program linked with them, and the line
+// numbers of all labels the program and the libraries export
+func link(program *Program) ([]interpreter.Codeline, map[string]int, error) {
+	labels := make(map[string]int)
+	for symbol, linenumber := range program.Symbols {
+		labels[symbol] = linenumber
+	}
+	if len(program.Imports) == 0 && !program.Library {
+		// Nothing to link, keep the program as it is
+		return program.Code, labels, nil
+	}
+
+	l := linker{
+		bases:     make(map[string]int),
+		libraries: make(map[string]*Program),
+		end:       program.Code[len(program.Code)-1].Linenumber + 1,
+		labels:    labels,
+	}
+	if linkErr := l.linkModule(program, 0); linkErr != nil {
+		return nil, nil, linkErr
+	}
+
+	sort.SliceStable(l.code, func(a, b int) bool {
+		return l.code[a].Linenumber < l.code[b].Linenumber
+	})
+	log.Printf("Linked %d libraries, running %d code lines in total", len(l.libraries), len(l.code))
+	return l.code, l.labels, nil
+}
+
+// Links the code of the module at the given line number, and all libraries imported by it
+func (l *linker) linkModule(module *Program, base int) error {
+	l.linking = append(l.linking, module.Domain)
+	defer func() {
+		l.linking = l.linking[:len(l.linking)-1]
+	}()
+
+	// The line numbers of the imported libraries are needed to resolve their labels, so link them first
+	for _, alias := range sortedAliases(module.Imports) {
+		if linkErr := l.linkLibrary(module.Imports[alias]); linkErr != nil {
+			return errors.New(fmt.Sprintf("Failed to link library '%s' imported by %s: %s", alias, module.Domain, linkErr.Error()))
+		}
+		l.addLabels(alias, module.Imports[alias])
+	}
+
+	for _, c := range module.Code {
+		code, resolveErr := l.resolve(module, base, c)
+		if resolveErr != nil {
+			return resolveErr
+		}
+		l.code = append(l.code, interpreter.Codeline{
+			Linenumber: base + c.Linenumber,
+			Code:       code,
+		})
+	}
+	return nil
+}
+
+// Loads and links the library of the given domain, unless that was already done
+func (l *linker) linkLibrary(domain string) error {
+	domain = strings.ToLower(dns.Fqdn(domain))
+	for i, linking := range l.linking {
+		if strings.ToLower(linking) == domain {
+			return errors.New(fmt.Sprintf("Import cycle: %s -> %s", strings.Join(l.linking[i:], " -> "), domain))
+		}
+	}
+	if _, isLinked := l.bases[domain]; isLinked {
+		return nil
+	}
+
+	library, loadErr := loadLibrary(domain)
+	if loadErr != nil {
+		return loadErr
+	}
+	if !library.Library {
+		return errors.New(fmt.Sprintf("%s is no library, please compile it with -library", domain))
+	}
+	if last := library.Code[len(library.Code)-1].Linenumber; last >= moduleSize-2 {
+		return errors.New(fmt.Sprintf("%s is too large to be linked, its last line is %d", domain, last))
+	}
+
+	// Each library gets its own range of line numbers below 0
+	base := -(len(l.bases) + 1) * moduleSize
+	l.bases[domain] = base
+	l.libraries[domain] = library
+	log.Printf("Linking library %s with %d code lines at line %d", domain, len(library.Code), base)
+
+	// Reaching the end of a library ends the program, rather than running into the code following it
+	l.code = append(l.code, interpreter.Codeline{
+		Linenumber: base + moduleSize - 2,
+		Code:       fmt.Sprintf("push %d", l.end),
+	}, interpreter.Codeline{
+		Linenumber: base + moduleSize - 1,
+		Code:       "jmp",
+	})
+	return l.linkModule(library, base)
+}
+
+// Resolves the labels of libraries and relative line numbers in the code line of the given module
+func (l *linker) resolve(module *Program, base int, c interpreter.Codeline) (string, error) {
+	parts := strings.SplitN(c.Code, " ", 2)
+	if len(parts) < 2 {
+		return c.Code, nil
+	}
+	instruction, argument := strings.ToLower(parts[0]), parts[1]
+
+	// A line number relative to the start of the library
+	if instruction == compiler.RelocatableInstruction {
+		linenumber, atoiErr := strconv.Atoi(argument)
+		if atoiErr != nil {
+			return "", errors.New(fmt.Sprintf("Line %d of %s: Not a relative line number: '%s'", c.Linenumber, module.Domain, parts[1]))
+		}
+		return fmt.Sprintf("push %d", base+linenumber), nil
+	}
+
+	// A label of an imported library
+	names := strings.SplitN(argument, ".", 2)
+	if len(names) < 2 {
+		return c.Code, nil
+	}
+	alias, isImported := matchName(sortedAliases(module.Imports), names[0])
+	if !isImported {
+		return "", errors.New(fmt.Sprintf("Line %d of %s: No library is imported as '%s'", c.Linenumber, module.Domain, names[0]))
+	}
+	domain := strings.ToLower(dns.Fqdn(module.Imports[alias]))
+	library := l.libraries[domain]
+	symbol, isSymbol := matchName(sortedSymbols(library.Symbols), names[1])
+	if !isSymbol {
+		return "", errors.New(fmt.Sprintf("Line %d of %s: Library %s has no label '%s'", c.Linenumber, module.Domain, domain, names[1]))
+	}
+	return fmt.Sprintf("%s %d", instruction, l.bases[domain]+library.Symbols[symbol]), nil
+}
+
+// Adds the labels of the linked library of the given domain, qualified with the name it is imported as.
+// If libraries import each other under the same name, the labels found first are kept.
+func (l *linker) addLabels(alias string, domain string) {
+	domain = strings.ToLower(dns.Fqdn(domain))
+	for symbol, linenumber := range l.libraries[domain].Symbols {
+		name := alias + "." + symbol
+		if _, isKnown := l.labels[name]; !isKnown {
+			l.labels[name] = l.bases[domain] + linenumber
+		}
+	}
+}
+
+// Loads a library, from the zonefile if it's in there, or from the DNS otherwise
+func loadLibrary(domain string) (*Program, error) {
+	if *zonefilePath != "" {
+		library, loadErr := (&zonefileSource{
+			path:   *zonefilePath,
+			domain: domain,
+		}).Load()
+		if loadErr == nil {
+			return library, nil
+		}
+	}
+
+	source, sourceErr := withCache(&dnsSource{
+		domain: domain,
+	}, domain)
+	if sourceErr != nil {
+		return nil, sourceErr
+	}
+	log.Printf("Loading library from %s", source.String())
+	return source.Load()
+}
+
+// Returns the aliases of the imports, sorted, so libraries are always linked at the same line numbers
+func sortedAliases(imports map[string]string) []string {
+	aliases := make([]string, 0, len(imports))
+	for alias := range imports {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	return aliases
+}
+
+// Returns the labels of a library, sorted
+func sortedSymbols(symbols map[string]int) []string {
+	names := make([]string, 0, len(symbols))
+	for symbol := range symbols {
+		names = append(names, symbol)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Returns the name spelled like the given one. The exact spelling is preferred, but names in MX records may lose their
+// case on their way through the DNS, so names differing only in case match as well.
+func matchName(names []string, name string) (string, bool) {
+	for _, n := range names {
+		if n == name {
+			return n, true
+		}
+	}
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return n, true
+		}
+	}
+	return "", false
+}
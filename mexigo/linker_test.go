@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/maride/mexico/mexigo/interpreter"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Programs and libraries importing each other, as written by the compiler
+const linkerZone = `$ORIGIN mxc.example.
+$TTL 300
+@	IN	SOA	ns.mxc.example. hostmaster.mxc.example. 1 3600 600 86400 300
+
+; Squares 3 twice with the library, and prints the result
+fib	MX	0 push-3.mexico.invalid.
+fib	MX	1 push-Lib.Twice.mexico.invalid.
+fib	MX	2 call.mexico.invalid.
+fib	MX	3 printnum.mexico.invalid.
+fib	TXT	"mexico:import" "Lib" "lib.mxc.example."
+
+; Runs into the end of the library, which ends the program
+fall	MX	0 push-lib.fall.mexico.invalid.
+fall	MX	1 jmp.mexico.invalid.
+fall	MX	2 push-7.mexico.invalid.
+fall	MX	3 printnum.mexico.invalid.
+fall	TXT	"mexico:import" "Lib" "lib.mxc.example."
+
+; The library, calling its own label relative to its start
+lib	MX	0 dup.mexico.invalid.
+lib	MX	1 mult.mexico.invalid.
+lib	MX	2 ret.mexico.invalid.
+lib	MX	3 pushr-0.mexico.invalid.
+lib	MX	4 call.mexico.invalid.
+lib	MX	5 pushr-0.mexico.invalid.
+lib	MX	6 call.mexico.invalid.
+lib	MX	7 ret.mexico.invalid.
+lib	MX	8 push-1.mexico.invalid.
+lib	TXT	"mexico:library"
+lib	TXT	"mexico:symbol" "Square" "0"
+lib	TXT	"mexico:symbol" "Twice" "3"
+lib	TXT	"mexico:symbol" "Fall" "8"
+
+; Libraries importing each other
+cycle	MX	0 push-A.X.mexico.invalid.
+cycle	TXT	"mexico:import" "A" "a.mxc.example."
+a	MX	0 push-B.X.mexico.invalid.
+a	TXT	"mexico:import" "B" "b.mxc.example."
+a	TXT	"mexico:library"
+a	TXT	"mexico:symbol" "X" "0"
+b	MX	0 push-A.X.mexico.invalid.
+b	TXT	"mexico:import" "A" "a.mxc.example."
+b	TXT	"mexico:library"
+b	TXT	"mexico:symbol" "X" "0"
+
+; Importing a program which isn't a library
+nolib	MX	0 push-Fib.X.mexico.invalid.
+nolib	TXT	"mexico:import" "Fib" "fib.mxc.example."
+
+; Using a label the library doesn't have
+nolabel	MX	0 push-Lib.Cube.mexico.invalid.
+nolabel	TXT	"mexico:import" "Lib" "lib.mxc.example."
+
+; Using a library it doesn't import
+noimport	MX	0 push-Lib.Square.mexico.invalid.
+noimport	TXT	"mexico:import" "Other" "lib.mxc.example."
+`
+
+// Writes the zone of the linker tests, and makes libraries load from it
+func useLinkerZone(t *testing.T) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "mxc.example.zone")
+	if writeErr := ioutil.WriteFile(path, []byte(linkerZone), 0644); writeErr != nil {
+		t.Fatalf("Failed to write zonefile: %s", writeErr.Error())
+	}
+	setFlag(t, "zonefile", path)
+	setFlag(t, "cacheDir", "")
+	return path
+}
+
+// Loads the program of the given domain from the zone of the linker tests, and links it
+func linkFromZone(t *testing.T, domain string) ([]interpreter.Codeline, map[string]int, error) {
+	t.Helper()
+
+	program, loadErr := (&zonefileSource{
+		path:   useLinkerZone(t),
+		domain: domain,
+	}).Load()
+	if loadErr != nil {
+		t.Fatalf("Failed to load %s: %s", domain, loadErr.Error())
+	}
+	return link(program)
+}
+
+func TestLinkRelocates(t *testing.T) {
+	code, labels, linkErr := linkFromZone(t, "fib.mxc.example.")
+	if linkErr != nil {
+		t.Fatalf("link: %s", linkErr.Error())
+	}
+	lines := make(map[int]string)
+	for _, c := range code {
+		lines[c.Linenumber] = c.Code
+	}
+
+	// The only library is linked right below the program. Its labels, both used by the program and pushed by the
+	// library itself, are moved there.
+	base := -moduleSize
+	for linenumber, want := range map[int]string{
+		0:                     "push 3",
+		1:                     fmt.Sprintf("push %d", base+3),
+		base:                  "dup",
+		base + 3:              fmt.Sprintf("push %d", base),
+		base + 5:              fmt.Sprintf("push %d", base),
+		base + moduleSize - 2: "push 4",
+		base + moduleSize - 1: "jmp",
+	} {
+		if lines[linenumber] != want {
+			t.Errorf("Line %d: got '%s', want '%s'", linenumber, lines[linenumber], want)
+		}
+	}
+	if len(code) != 4+9+2 {
+		t.Errorf("Got %d code lines, want the program, the library and its end", len(code))
+	}
+	if labels["Lib.Twice"] != base+3 || labels["Lib.Fall"] != base+8 {
+		t.Errorf("Got labels %v", labels)
+	}
+}
+
+func TestLinkRuns(t *testing.T) {
+	tests := []struct {
+		domain string
+		want   string
+	}{
+		{"fib.mxc.example.", "81"},
+		{"fall.mxc.example.", ""},
+	}
+
+	for _, test := range tests {
+		code, _, linkErr := linkFromZone(t, test.domain)
+		if linkErr != nil {
+			t.Fatalf("%s: link: %s", test.domain, linkErr.Error())
+		}
+
+		var i interpreter.Interpreter
+		var output bytes.Buffer
+		i.SetIO(strings.NewReader(""), &output)
+		if setErr := i.SetCommands(code); setErr != nil {
+			t.Fatalf("%s: SetCommands: %s", test.domain, setErr.Error())
+		}
+		if runErr := i.Run(); runErr != nil {
+			t.Errorf("%s: Run: %s", test.domain, runErr.Error())
+		}
+		if output.String() != test.want {
+			t.Errorf("%s: Printed '%s', want '%s'", test.domain, output.String(), test.want)
+		}
+	}
+}
+
+func TestLinkErrors(t *testing.T) {
+	tests := []struct {
+		domain string
+		want   string
+	}{
+		{"cycle.mxc.example.", "Import cycle: a.mxc.example. -> b.mxc.example. -> a.mxc.example."},
+		{"nolib.mxc.example.", "fib.mxc.example. is no library, please compile it with -library"},
+		{"nolabel.mxc.example.", "Library lib.mxc.example. has no label 'Cube'"},
+		{"noimport.mxc.example.", "No library is imported as 'Lib'"},
+	}
+
+	for _, test := range tests {
+		_, _, linkErr := linkFromZone(t, test.domain)
+		if linkErr == nil || !strings.Contains(linkErr.Error(), test.want) {
+			t.Errorf("%s: got error %v, want one containing %q", test.domain, linkErr, test.want)
+		}
+	}
+}
@@ -1,43 +1,105 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"github.com/maride/mexico/mexigo/interpreter"
 	"log"
+	"os"
+	"os/signal"
 )
 
 func main() {
 	// Important things first
 	printBanner()
 
-	// Get desired domain off arguments
+	// Register flags, and get desired domain off arguments
+	registerFlags()
 	flag.Parse()
 	domain := flag.Arg(0)
-	if domain == "" {
-		// No domain entered.
-		log.Println("Please specify a domain to receive code from as first argument, like this: ./mexigo <domain>")
+
+	// Find out where to get the program code from
+	source, sourceErr := getProgramSource(domain)
+	if sourceErr != nil {
+		// No usable source given.
+		log.Println(sourceErr.Error())
 		return
 	}
 
-	// Get program code from that domain
-	log.Printf("Resolving %s for MX records", domain)
-	code := LookupMX(domain)
-	if len(code) == 0 {
-		// Failed to look up mexico code on that domain. Log and exit.
-		log.Printf("No code found on domain '%s'. Exiting.", domain)
+	// Get program code from that source
+	log.Printf("Loading code from %s", source.String())
+	program, loadErr := source.Load()
+	if loadErr != nil {
+		// Failed to load mexico code from that source. Log and exit.
+		log.Printf("%s. Exiting.", loadErr.Error())
 		return
 	}
 
 	// Inform user about successful resolving
-	log.Printf("Found %d code lines, interpreting them...", len(code))
+	log.Printf("Found %d code lines with a TTL of %d seconds, interpreting them...", len(program.Code), program.TTL)
+
+	// Load and link the libraries the program imports
+	code, labels, linkErr := link(program)
+	if linkErr != nil {
+		log.Println(linkErr.Error())
+		return
+	}
 
 	// Set up interpreter
-	runErr := interpreter.Run(code)
+	var i interpreter.Interpreter
+	applyLimits(&i)
+	files, ioErr := setupIO(&i)
+	if ioErr != nil {
+		log.Println(ioErr.Error())
+		return
+	}
+	defer closeAll(files)
+	setErr := i.SetCommands(code)
+	if setErr != nil {
+		log.Println(setErr.Error())
+		return
+	}
+
+	// Pick up new versions of the program while running, if requested
+	if refreshable, isRefreshable := source.(RefreshableSource); isRefreshable && *watchInterval > 0 {
+		updates := make(chan []interpreter.Codeline)
+		go watchProgram(refreshable, *watchInterval, updates)
+		i.WatchUpdates(updates)
+	}
+
+	// Let the user run the program step by step, if requested
+	if *debugMode {
+		debug(&i, labels)
+		return
+	}
+
+	// Stop the program on the first interrupt, a second one kills mexigo as usual - e.g. if it's waiting for input
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	// Let's run this program :)
+	runErr := i.RunContext(ctx)
 	if runErr != nil {
 		// Encountered error while executing code. Log and exit.
 		log.Println(runErr.Error())
 		return
 	}
+	log.Printf("Found no commands after line %d. Stopping.", i.ProgramCounter())
+}
+
+// Registers the flags of all parts of mexigo
+func registerFlags() {
+	registerSourceFlags()
+	registerResolverFlags()
+	registerCacheFlags()
+	registerDNSSECFlags()
+	registerLimitFlags()
+	registerIOFlags()
+	registerDebuggerFlags()
 }
 
 // Prints a small banner :)
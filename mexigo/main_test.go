@@ -0,0 +1,30 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"log"
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// The flags are used all over the place, so they need to exist. Tests set them as required, see setFlag().
+	registerFlags()
+	flag.Parse()
+	log.SetOutput(ioutil.Discard)
+	os.Exit(m.Run())
+}
+
+// Sets the flag to the given value until the test ends
+func setFlag(t *testing.T, name string, value string) {
+	t.Helper()
+
+	previous := flag.Lookup(name).Value.String()
+	if setErr := flag.Set(name, value); setErr != nil {
+		t.Fatalf("Failed to set -%s: %s", name, setErr.Error())
+	}
+	t.Cleanup(func() {
+		flag.Set(name, previous)
+	})
+}
@@ -1,11 +1,13 @@
 package main
 
 import (
-	"github.com/maride/mexico/mexigo/interpreter"
+	"flag"
+	"fmt"
+	"github.com/maride/mexico/dns"
+	"github.com/pkg/errors"
 	"log"
-	"math"
-	"net"
 	"strings"
+	"time"
 )
 
 const (
@@ -13,59 +15,118 @@ const (
 	MexicoFakeDomain = "mexico.invalid."
 )
 
-// This is a wrapper function for net.LookupMX(), filtering for mexico records, and sorting the remaining by linenum
-func LookupMX(basedomain string) []interpreter.Codeline {
-	// Do the basic lookup
-	rawMX, lookupErr := net.LookupMX(basedomain)
-	if lookupErr != nil {
-		// Encountered error while looking up basedomain - log and return
-		log.Printf("Failed to resolve '%s': %s", basedomain, lookupErr.Error())
-		return nil
+var (
+	dnsServer     *string
+	useTCP        *bool
+	lookupTimeout *time.Duration
+	lookupRetries *int
+	ednsSize      *uint
+)
+
+// Registers flags required for resolving
+func registerResolverFlags() {
+	dnsServer = flag.String("server", "", "DNS server to send queries to, as host[:port]. Defaults to the nameservers of the system")
+	useTCP = flag.Bool("tcp", false, "Send queries over TCP instead of UDP")
+	lookupTimeout = flag.Duration("timeout", 5*time.Second, "Timeout for a single lookup attempt")
+	lookupRetries = flag.Int("retries", 2, "Number of retries if a lookup attempt fails")
+	ednsSize = flag.Uint("bufsize", dns.DefaultEDNSSize, "UDP buffer size to announce via EDNS0, or 0 to disable EDNS0")
+}
+
+// Returns a DNS client set up as requested on the command line
+func newClient() *dns.Client {
+	return &dns.Client{
+		Server:  *dnsServer,
+		TCP:     *useTCP,
+		Timeout: *lookupTimeout,
+		Retries: *lookupRetries,
+		UDPSize: uint16(*ednsSize),
+		DNSSEC:  *requireDNSSEC,
 	}
+}
 
-	// Filter results for the (fake) domain "mexico.invalid."
-	var filteredMX []*net.MX
+// Looks up the records of the given name and type, validating them if DNSSEC is required. Returns no records, and no
+// error, if the name doesn't exist.
+func LookupRecords(name string, rrType uint16) ([]dns.RR, *dns.Response, error) {
+	response, queryErr := newClient().Query(name, rrType)
+	if queryErr != nil {
+		// Encountered error while looking up the name - pass through
+		return nil, nil, errors.New(fmt.Sprintf("Failed to resolve '%s': %s", name, queryErr.Error()))
+	}
+
+	// Check if the server found anything
+	if response.Rcode == dns.RcodeNameError {
+		return nil, response, nil
+	} else if response.Rcode != dns.RcodeSuccess {
+		return nil, nil, errors.New(fmt.Sprintf("Failed to resolve '%s': %s answered with %s", name, response.Server, dns.RcodeToString(response.Rcode)))
+	}
+
+	records := response.AnswersFor(name, rrType)
+	authority := "non-authoritative"
+	if response.Authoritative {
+		authority = "authoritative"
+	}
+	transport := "UDP"
+	if response.OverTCP {
+		transport = "TCP"
+	}
+	log.Printf("Received %d %s records from %s over %s (%s, %s)", len(records), dns.TypeToString(rrType), response.Server, transport, authority, response.RTT.String())
 
-	// Iterate over all returned MX records
-	for _, raw := range rawMX {
-		// Check if it's a mexico MX record
-		if strings.HasSuffix(raw.Host, MexicoFakeDomain) {
-			// it is, add to filtered array
-			filteredMX = append(filteredMX, raw)
+	// Validate the whole answer, including CNAME records which may have led us to the records
+	if *requireDNSSEC {
+		if validateErr := validateRecords(response.Answers); validateErr != nil {
+			return nil, nil, validateErr
 		}
 	}
+	return records, response, nil
+}
 
-	// Sort filtered results, based on the priority - or line number, in the words of this esolang :)
-	var records []interpreter.Codeline
-	var smallestPriority uint16 = math.MaxInt16
-	smallestPriorityIndex := 0
+// Looks up the serial of the zone the given domain belongs to
+func LookupSerial(domain string) (uint32, error) {
+	response, queryErr := newClient().Query(domain, dns.TypeSOA)
+	if queryErr != nil {
+		return 0, queryErr
+	}
+	if response.Rcode != dns.RcodeSuccess {
+		return 0, errors.New(fmt.Sprintf("%s answered with %s", response.Server, dns.RcodeToString(response.Rcode)))
+	}
+
+	// If the domain is the apex of its zone, the SOA record is in the answer. Otherwise, it's in the authority section.
+	for _, section := range [][]dns.RR{response.Answers, response.Authority} {
+		for _, r := range section {
+			soa, isSOA := r.Data.(*dns.SOA)
+			if !isSOA || !dns.IsSubdomain(domain, r.Name) {
+				continue
+			}
 
-	// Iterate over filteredMX and delete the record with the smallest priority until we don't have any more filteredMX
-	for len(filteredMX) > 0 {
-		// Iterate over the filteredMX to find the one with the smallest priority
-		for i, f := range filteredMX {
-			if f.Pref < smallestPriority {
-				// Found entry with smaller index than the current one
-				smallestPriority = f.Pref
-				smallestPriorityIndex = i
+			// The serial decides whether a cached program is run again, so it has to be as trustworthy as the program
+			if *requireDNSSEC {
+				if validateErr := validateRecords(signedRRset(section, r.Name, dns.TypeSOA)); validateErr != nil {
+					return 0, validateErr
+				}
 			}
+			return soa.Serial, nil
 		}
+	}
+	return 0, errors.New(fmt.Sprintf("%s didn't send a SOA record", response.Server))
+}
 
-		// Remove mexico fake domain suffix
-		command := strings.TrimSuffix(filteredMX[smallestPriorityIndex].Host, "." + MexicoFakeDomain)
+// Turns the exchange of a mexico MX record back into the command it was compiled from
+func exchangeToCommand(exchange string) string {
+	// Remove mexico fake domain suffix
+	command := exchange[:len(exchange)-len(MexicoFakeDomain)-1]
 
-		// Replace '-' with space.
-		// This reserves the process done by the compiler to transform this command + arg into a FQDN
-		command = strings.Replace(command, "-", " ", 1)
+	// Replace '-' with space.
+	// This reserves the process done by the compiler to transform this command + arg into a FQDN
+	return strings.Replace(command, "-", " ", 1)
+}
 
-		// Add hostname of "smallest" record to the records array, and delete it from filteredMX
-		records = append(records, interpreter.Codeline{
-			Linenumber: int(filteredMX[smallestPriorityIndex].Pref),
-			Code:       command,
-		})
-		filteredMX = append(filteredMX[:smallestPriorityIndex], filteredMX[smallestPriorityIndex + 1:]...)
+// Returns the smallest TTL of the given records, or 0 if there are no records
+func minimumTTL(records []dns.RR) uint32 {
+	var ttl uint32
+	for i, r := range records {
+		if i == 0 || r.TTL < ttl {
+			ttl = r.TTL
+		}
 	}
-
-	// Return filtered and sorted records
-	return records
+	return ttl
 }
@@ -0,0 +1,415 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/maride/mexico/dns"
+	"github.com/maride/mexico/loader"
+	"github.com/maride/mexico/mexico/compiler"
+	"github.com/maride/mexico/mexigo/interpreter"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	zonefilePath  *string
+	useTransfer   *bool
+	transferZone  *string
+	watchInterval *time.Duration
+)
+
+// A ProgramSource delivers a mexico program, e.g. from the live DNS or from a local zonefile
+type ProgramSource interface {
+	// Loads the program, with its code lines sorted by line number
+	Load() (*Program, error)
+
+	// Returns a short description of the source, used for logging
+	String() string
+}
+
+// A ProgramSource which is able to check for new versions of the program after it was loaded
+type RefreshableSource interface {
+	ProgramSource
+
+	// Checks for a new version of the program. Returns the new version, and whether it differs from the previous one.
+	Refresh() (*Program, bool, error)
+}
+
+// A mexico program, together with some information about where it came from
+type Program struct {
+	// The domain the program was loaded for
+	Domain string
+
+	// The code lines of the program, sorted by line number
+	Code []interpreter.Codeline
+
+	// The raw MX and TXT records the program was built from, as received
+	Records []dns.RR
+
+	// The domains of the libraries the program imports, by the name they are imported as
+	Imports map[string]string
+
+	// Whether the program is a library, which other programs may import
+	Library bool
+
+	// The line numbers of the labels a library exports, by their name
+	Symbols map[string]int
+
+	// The number of parts the program is split into, as named by its TXT records, or 0 if unknown
+	Parts int
+
+	// The smallest TTL of all records
+	TTL uint32
+
+	// The serial of the zone the program was loaded from, or 0 if unknown
+	Serial uint32
+
+	// The server (or file) which delivered the records
+	Server string
+
+	// Whether the records came straight from the source, rather than from a cache
+	Authoritative bool
+
+	// Whether the DNSSEC signatures of the records were validated
+	Secure bool
+}
+
+// Loads the program from the DNS
+type dnsSource struct {
+	domain string
+}
+
+// Loads the program from a local zonefile, as written by the mexico compiler
+type zonefileSource struct {
+	path   string
+	domain string
+}
+
+// Compiles the program from a source code file, without putting it into a zone first
+type mxcSource struct {
+	path string
+}
+
+// Loads the program by transferring the zone it's part of
+type transferSource struct {
+	domain  string
+	zone    string
+	records []dns.RR
+	serial  uint32
+}
+
+// Registers flags required for selecting the program source
+func registerSourceFlags() {
+	zonefilePath = flag.String("zonefile", "", "Load the program from the given zonefile instead of the DNS")
+	useTransfer = flag.Bool("axfr", false, "Load the program via zone transfer from the server given with -server")
+	transferZone = flag.String("zone", "", "The zone to transfer, if the program domain isn't the apex of its zone")
+	watchInterval = flag.Duration("watch", 0, "Interval to check for new versions of the program via IXFR while running, requires -axfr")
+}
+
+// Returns the program source selected on the command line
+func getProgramSource(domain string) (ProgramSource, error) {
+	if isSourceFile(domain) {
+		// Source code straight from the compiler's input, handy for trying out programs before publishing them. A zonefile
+		// given as well may still provide the libraries it imports
+		if *requireDNSSEC {
+			return nil, errors.New("Source code files aren't signed, so -dnssec can't validate them. Please leave out -dnssec to run local code")
+		}
+		return &mxcSource{
+			path: domain,
+		}, nil
+	}
+	if strings.HasSuffix(strings.ToLower(domain), ".mxc") {
+		log.Printf("Found no source code file '%s', looking it up as domain", domain)
+	}
+
+	if *zonefilePath != "" {
+		if *requireDNSSEC {
+			return nil, errors.New("Local zonefiles aren't validated, so -dnssec can't be used with -zonefile. Please leave out -dnssec to run local code")
+		}
+
+		// A zonefile was given - the domain is optional then, as the zonefile carries its own origin
+		return &zonefileSource{
+			path:   *zonefilePath,
+			domain: domain,
+		}, nil
+	}
+
+	if domain == "" {
+		// Neither a zonefile nor a domain entered.
+		return nil, errors.New("Please specify a domain to receive code from as first argument, like this: ./mexigo <domain>")
+	}
+
+	if *useTransfer {
+		// Zone transfers are usually not offered by recursive resolvers, so we need a specific server
+		if *dnsServer == "" {
+			return nil, errors.New("Please specify the server to transfer the zone from with -server")
+		}
+
+		zone := *transferZone
+		if zone == "" {
+			zone = domain
+		}
+		source := &transferSource{
+			domain: domain,
+			zone:   zone,
+		}
+
+		// A watched program changes while running, there's no point in caching it
+		if *watchInterval > 0 {
+			return source, nil
+		}
+		return withCache(source, domain)
+	}
+
+	if *watchInterval > 0 {
+		log.Println("Watching for new versions of the program is only supported with -axfr, ignoring -watch")
+	}
+
+	return withCache(&dnsSource{
+		domain: domain,
+	}, domain)
+}
+
+// Checks if the argument names a source code file rather than a domain: it ends in .mxc, and the file exists
+func isSourceFile(arg string) bool {
+	if !strings.HasSuffix(strings.ToLower(arg), ".mxc") {
+		return false
+	}
+	info, statErr := os.Stat(arg)
+	return statErr == nil && !info.IsDir()
+}
+
+// Looks up the MX records of the domain, and of all further parts of the program
+func (s *dnsSource) Load() (*Program, error) {
+	var first *dns.Response
+	loaded, loadErr := loader.Load(s.domain, func(name string, rrType uint16) ([]dns.RR, error) {
+		records, response, lookupErr := LookupRecords(name, rrType)
+		if first == nil {
+			first = response
+		}
+		return records, lookupErr
+	})
+	if loadErr != nil {
+		return nil, loadErr
+	}
+
+	program := newProgram(loaded)
+	program.Server = first.Server
+	program.Authoritative = first.Authoritative
+	program.Secure = *requireDNSSEC
+	if partsErr := program.checkParts(); partsErr != nil {
+		return nil, partsErr
+	}
+	return program, nil
+}
+
+func (s *dnsSource) String() string {
+	return fmt.Sprintf("domain %s", s.domain)
+}
+
+// Parses the zonefile, and extracts the MX records of the domain
+func (s *zonefileSource) Load() (*Program, error) {
+	zone, readErr := dns.ReadZoneFile(s.path, "")
+	if readErr != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to read zonefile '%s': %s", s.path, readErr.Error()))
+	}
+
+	// Fall back to the origin of the zone if no domain was specified
+	domain := s.domain
+	if domain == "" {
+		if zone.Origin == "" {
+			return nil, errors.New(fmt.Sprintf("Zonefile '%s' has no origin, please specify the domain to execute", s.path))
+		}
+		domain = zone.Origin
+	}
+
+	return programFromZone(zone, domain, s.path)
+}
+
+func (s *zonefileSource) String() string {
+	return fmt.Sprintf("zonefile %s", s.path)
+}
+
+// Compiles the source code file, reporting the errors and warnings of the compiler on stderr
+func (s *mxcSource) Load() (*Program, error) {
+	content, readErr := ioutil.ReadFile(s.path)
+	if readErr != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to read source code file '%s': %s", s.path, readErr.Error()))
+	}
+	source := string(content)
+
+	// The program isn't put into MX records, so its line numbers aren't limited by them. Labels are kept for the debugger.
+	module, diagnostics := compiler.CompileWithOptions(source, compiler.Options{
+		File:    s.path,
+		Direct:  true,
+		Symbols: true,
+	})
+	fmt.Fprint(os.Stderr, diagnostics.Format(source))
+	if diagnostics.HasErrors() {
+		return nil, errors.New(fmt.Sprintf("Failed to compile %s, found %d errors", s.path, len(diagnostics.Errors())))
+	}
+
+	if len(module.Code) == 0 {
+		return nil, errors.New(fmt.Sprintf("No code found in %s", s.path))
+	}
+
+	program := Program{
+		Domain:        s.path,
+		Imports:       module.Imports,
+		Library:       module.Library,
+		Symbols:       module.Symbols,
+		Server:        s.path,
+		Authoritative: true,
+	}
+	for _, c := range module.Code {
+		program.Code = append(program.Code, interpreter.Codeline{
+			Linenumber: c.Linenumber,
+			Code:       exchangeToCommand(c.Code),
+		})
+	}
+	return &program, nil
+}
+
+func (s *mxcSource) String() string {
+	return fmt.Sprintf("source code file %s", s.path)
+}
+
+// Transfers the whole zone via AXFR, and extracts the MX records of the domain
+func (s *transferSource) Load() (*Program, error) {
+	transfer, transferErr := newClient().TransferZone(s.zone)
+	if transferErr != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to transfer zone '%s': %s", s.zone, transferErr.Error()))
+	}
+	log.Printf("Transferred %d records of zone '%s' with serial %d", len(transfer.Records), s.zone, transfer.Serial)
+
+	s.records = transfer.Records
+	s.serial = transfer.Serial
+	return s.program()
+}
+
+// Asks for changes of the zone via IXFR, and applies them
+func (s *transferSource) Refresh() (*Program, bool, error) {
+	transfer, transferErr := newClient().TransferIncremental(s.zone, s.serial)
+	if transferErr != nil {
+		return nil, false, errors.New(fmt.Sprintf("Failed to transfer zone '%s': %s", s.zone, transferErr.Error()))
+	}
+	if transfer.Serial == s.serial {
+		// Nothing changed
+		return nil, false, nil
+	}
+
+	s.records = transfer.Apply(s.records)
+	s.serial = transfer.Serial
+	program, programErr := s.program()
+	return program, programErr == nil, programErr
+}
+
+// Extracts the program from the transferred records
+func (s *transferSource) program() (*Program, error) {
+	zone := dns.Zone{
+		Origin:  dns.Fqdn(s.zone),
+		Records: s.records,
+	}
+	program, programErr := programFromZone(&zone, s.domain, *dnsServer)
+	if programErr != nil || !*requireDNSSEC {
+		return program, programErr
+	}
+	if partsErr := program.checkParts(); partsErr != nil {
+		return nil, partsErr
+	}
+
+	// The transfer itself isn't signed, but the records of the program are - including those of further parts
+	records := append([]dns.RR{}, program.Records...)
+	signed := make(map[string]bool)
+	for _, r := range program.Records {
+		if !signed[r.Name] {
+			signed[r.Name] = true
+			records = append(records, zone.Lookup(r.Name, dns.TypeRRSIG)...)
+		}
+	}
+	if validateErr := validateRecords(records); validateErr != nil {
+		return nil, validateErr
+	}
+	program.Secure = true
+	return program, nil
+}
+
+func (s *transferSource) String() string {
+	return fmt.Sprintf("zone transfer of %s from %s", s.zone, *dnsServer)
+}
+
+// Extracts the program of the given domain from the zone, just like the result of a DNS lookup
+func programFromZone(zone *dns.Zone, domain string, server string) (*Program, error) {
+	loaded, loadErr := loader.FromZone(zone, domain)
+	if loadErr != nil {
+		return nil, errors.New(fmt.Sprintf("%s in %s", loadErr.Error(), server))
+	}
+
+	program := newProgram(loaded)
+	program.Server = server
+	program.Authoritative = true
+	if soa := zone.SOA(); soa != nil {
+		program.Serial = soa.Data.(*dns.SOA).Serial
+	}
+	return program, nil
+}
+
+// Converts the loaded program into one the interpreter understands
+func newProgram(loaded *loader.Program) *Program {
+	program := Program{
+		Domain:  loaded.Domain,
+		Records: loaded.Records,
+		Imports: loaded.Imports,
+		Library: loaded.Library,
+		Symbols: loaded.Symbols,
+		Parts:   loaded.Parts,
+		TTL:     minimumTTL(loaded.Records),
+	}
+	for i, c := range loaded.Code {
+		// Only the first of multiple records for the same line will ever be executed, warn about the others
+		if i > 0 && loaded.Code[i-1].Linenumber == c.Linenumber {
+			log.Printf("Line %d is defined more than once, ignoring '%s'", c.Linenumber, c.Code)
+		}
+		program.Code = append(program.Code, interpreter.Codeline{
+			Linenumber: c.Linenumber,
+			Code:       exchangeToCommand(c.Code),
+		})
+	}
+	return &program
+}
+
+// Checks if the number of parts of the program is known, if DNSSEC is required. The signatures only prove that the
+// records of a part are genuine, not that a part doesn't exist - so without the signed number of parts, anyone able to
+// spoof responses could cut the program short by denying its last parts.
+func (p *Program) checkParts() error {
+	if *requireDNSSEC && p.Parts == 0 {
+		return errors.New(fmt.Sprintf("Refusing to run program, %s doesn't name the number of its parts. Please compile it again with a recent version of mexico", p.Domain))
+	}
+	return nil
+}
+
+// Periodically checks for new versions of the program, and hands them over to the interpreter
+func watchProgram(source RefreshableSource, interval time.Duration, updates chan<- []interpreter.Codeline) {
+	for {
+		time.Sleep(interval)
+
+		program, changed, refreshErr := source.Refresh()
+		if refreshErr != nil {
+			log.Printf("Failed to check for a new version of the program: %s", refreshErr.Error())
+			continue
+		}
+		if changed {
+			log.Printf("Found new version %d of the program with %d code lines", program.Serial, len(program.Code))
+			code, _, linkErr := link(program)
+			if linkErr != nil {
+				log.Printf("Failed to link the new version of the program: %s", linkErr.Error())
+				continue
+			}
+			updates <- code
+		}
+	}
+}
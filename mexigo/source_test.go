@@ -0,0 +1,93 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGetProgramSource(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "Fibonacci.mxc")
+	if writeErr := ioutil.WriteFile(file, []byte("  push 1\n  printnum\n"), 0644); writeErr != nil {
+		t.Fatalf("Failed to write source code file: %s", writeErr.Error())
+	}
+	if mkdirErr := os.Mkdir(filepath.Join(dir, "dir.mxc"), 0755); mkdirErr != nil {
+		t.Fatalf("Failed to create directory: %s", mkdirErr.Error())
+	}
+	setFlag(t, "cacheDir", "")
+
+	tests := []struct {
+		name     string
+		arg      string
+		zonefile string
+		dnssec   bool
+
+		// The description of the source, or the part of the expected error
+		source string
+		want   string
+	}{
+		{
+			name:   "source code file",
+			arg:    file,
+			source: "source code file " + file,
+		},
+		{
+			name:   "domain ending in .mxc",
+			arg:    "fibonacci.mxc",
+			source: "domain fibonacci.mxc",
+		},
+		{
+			name:   "directory ending in .mxc",
+			arg:    filepath.Join(dir, "dir.mxc"),
+			source: "domain " + filepath.Join(dir, "dir.mxc"),
+		},
+		{
+			name:     "zonefile",
+			zonefile: "mxc.example.zone",
+			source:   "zonefile mxc.example.zone",
+		},
+		{
+			name:   "validated source code file",
+			arg:    file,
+			dnssec: true,
+			want:   "Source code files aren't signed, so -dnssec can't validate them",
+		},
+		{
+			name:     "validated zonefile",
+			zonefile: "mxc.example.zone",
+			dnssec:   true,
+			want:     "Local zonefiles aren't validated, so -dnssec can't be used with -zonefile",
+		},
+		{
+			name: "neither domain nor zonefile",
+			want: "Please specify a domain to receive code from",
+		},
+	}
+
+	for _, test := range tests {
+		setFlag(t, "zonefile", test.zonefile)
+		if test.dnssec {
+			setFlag(t, "dnssec", "true")
+		} else {
+			setFlag(t, "dnssec", "false")
+		}
+
+		source, sourceErr := getProgramSource(test.arg)
+		if test.want != "" {
+			if sourceErr == nil || !strings.Contains(sourceErr.Error(), test.want) {
+				t.Errorf("%s: got error %v, want one containing %q", test.name, sourceErr, test.want)
+			}
+			continue
+		}
+		if sourceErr != nil {
+			t.Errorf("%s: %s", test.name, sourceErr.Error())
+			continue
+		}
+		if source.String() != test.source {
+			t.Errorf("%s: got %s, want %s", test.name, source.String(), test.source)
+		}
+	}
+}